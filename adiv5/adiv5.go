@@ -0,0 +1,277 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package adiv5 implements the ARM Debug Interface v5: Debug Port power up,
+// Access Port discovery, MEM-AP memory accesses, ROM table walk and Cortex-M
+// core control.
+//
+// It is transport agnostic; swd.Conn implements Port.
+package adiv5
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Port is a Debug Port transport.
+type Port interface {
+	// Read does a single read transfer. AP reads are posted: the value
+	// returned is the result of the previous AP read.
+	Read(ap bool, addr uint8) (uint32, error)
+	// Write does a single write transfer.
+	Write(ap bool, addr uint8, v uint32) error
+}
+
+// Debug Port registers.
+const (
+	DPIDR    uint8 = 0x0
+	ABORT    uint8 = 0x0
+	CTRLSTAT uint8 = 0x4
+	SELECT   uint8 = 0x8
+	RDBUFF   uint8 = 0xC
+)
+
+// CTRL/STAT bits.
+const (
+	CSYSPWRUPACK uint32 = 1 << 31
+	CSYSPWRUPREQ uint32 = 1 << 30
+	CDBGPWRUPACK uint32 = 1 << 29
+	CDBGPWRUPREQ uint32 = 1 << 28
+	WDATAERR     uint32 = 1 << 7
+	STICKYERR    uint32 = 1 << 5
+	STICKYCMP    uint32 = 1 << 4
+	STICKYORUN   uint32 = 1 << 1
+)
+
+// abortClear clears all the sticky flags: ORUNERRCLR, WDERRCLR, STKERRCLR and
+// STKCMPCLR.
+const abortClear = 0x1E
+
+// polls is the number of times a status register is polled before giving up.
+const polls = 100
+
+// Errors.
+var (
+	// ErrTimeout is returned when a status bit is not set in time.
+	ErrTimeout = errors.New("adiv5: timed out")
+	// ErrSticky is wrapped in a FaultError when posted writes set a sticky
+	// error flag, usually because of a bus error.
+	ErrSticky = errors.New("adiv5: sticky error flag set")
+)
+
+// DP is an ADIv5 Debug Port.
+//
+// It is not safe for concurrent use.
+type DP struct {
+	p     Port
+	sel   uint32
+	selOK bool
+}
+
+// New returns a DP on p, with the debug and system domains powered up.
+//
+// The transport must already be initialized; for SWD this means DPIDR was
+// read after the line reset.
+func New(p Port) (*DP, error) {
+	d := &DP{p: p}
+	if err := d.PowerUp(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Port returns the underlying transport.
+func (d *DP) Port() Port {
+	return d.p
+}
+
+// PowerUp clears the sticky errors and requests the debug and system power
+// domains.
+func (d *DP) PowerUp() error {
+	if err := d.p.Write(false, ABORT, abortClear); err != nil {
+		return d.wrap("ABORT", err)
+	}
+	if err := d.p.Write(false, CTRLSTAT, CSYSPWRUPREQ|CDBGPWRUPREQ); err != nil {
+		return d.wrap("CTRL/STAT", err)
+	}
+	for i := 0; i < polls; i++ {
+		v, err := d.p.Read(false, CTRLSTAT)
+		if err != nil {
+			return d.wrap("CTRL/STAT", err)
+		}
+		if v&(CSYSPWRUPACK|CDBGPWRUPACK) == CSYSPWRUPACK|CDBGPWRUPACK {
+			return nil
+		}
+	}
+	return fmt.Errorf("adiv5: power up: %w", ErrTimeout)
+}
+
+// ReadDP reads a Debug Port register.
+func (d *DP) ReadDP(addr uint8) (uint32, error) {
+	v, err := d.p.Read(false, addr)
+	if err != nil {
+		return 0, d.wrap("read DP", err)
+	}
+	return v, nil
+}
+
+// WriteDP writes a Debug Port register.
+func (d *DP) WriteDP(addr uint8, v uint32) error {
+	if addr == SELECT {
+		d.selOK = false
+	}
+	if err := d.p.Write(false, addr, v); err != nil {
+		return d.wrap("write DP", err)
+	}
+	return nil
+}
+
+// ReadAP reads the register addr of the Access Port apsel.
+func (d *DP) ReadAP(apsel, addr uint8) (uint32, error) {
+	if err := d.selectAP(apsel, addr); err != nil {
+		return 0, err
+	}
+	if _, err := d.p.Read(true, addr&0xC); err != nil {
+		return 0, d.wrap("read AP", err)
+	}
+	v, err := d.p.Read(false, RDBUFF)
+	if err != nil {
+		return 0, d.wrap("read AP", err)
+	}
+	return v, nil
+}
+
+// WriteAP writes the register addr of the Access Port apsel.
+func (d *DP) WriteAP(apsel, addr uint8, v uint32) error {
+	if err := d.selectAP(apsel, addr); err != nil {
+		return err
+	}
+	if err := d.p.Write(true, addr&0xC, v); err != nil {
+		return d.wrap("write AP", err)
+	}
+	return nil
+}
+
+// ClearErrors clears the sticky error flags.
+func (d *DP) ClearErrors() error {
+	return d.WriteDP(ABORT, abortClear)
+}
+
+// AP registers common to all Access Ports.
+const (
+	IDR uint8 = 0xFC
+)
+
+// AP is an Access Port found by Discover.
+type AP struct {
+	// Sel is the APSEL value.
+	Sel uint8
+	// IDR is the identification register.
+	IDR uint32
+}
+
+// IsMemAP returns true if the Access Port is a MEM-AP.
+func (a *AP) IsMemAP() bool {
+	return a.IDR>>13&0xF == 0x8
+}
+
+// Type returns the AP type, for example 1 for AHB-AP, 2 for APB-AP.
+func (a *AP) Type() uint8 {
+	return uint8(a.IDR & 0xF)
+}
+
+func (a *AP) String() string {
+	s := "AP"
+	if a.IsMemAP() {
+		s = "MEM-AP"
+		switch a.Type() {
+		case 1:
+			s = "AHB-AP"
+		case 2:
+			s = "APB-AP"
+		case 4:
+			s = "AXI-AP"
+		}
+	}
+	return fmt.Sprintf("%s #%d (IDR %#08x)", s, a.Sel, a.IDR)
+}
+
+// Discover returns the Access Ports.
+//
+// APs are numbered contiguously, so the scan stops at the first one with a
+// zero IDR.
+func (d *DP) Discover() ([]AP, error) {
+	var out []AP
+	for i := 0; i < 256; i++ {
+		v, err := d.ReadAP(uint8(i), IDR)
+		if err != nil {
+			return out, err
+		}
+		if v == 0 {
+			break
+		}
+		out = append(out, AP{Sel: uint8(i), IDR: v})
+	}
+	return out, nil
+}
+
+//
+
+// selectAP updates SELECT if needed.
+func (d *DP) selectAP(apsel, addr uint8) error {
+	s := uint32(apsel)<<24 | uint32(addr&0xF0)
+	if d.selOK && d.sel == s {
+		return nil
+	}
+	if err := d.p.Write(false, SELECT, s); err != nil {
+		d.selOK = false
+		return d.wrap("SELECT", err)
+	}
+	d.sel = s
+	d.selOK = true
+	return nil
+}
+
+// wrap annotates err. If a sticky error flag is set, it is cleared so the
+// following transfers can proceed and a FaultError is returned.
+func (d *DP) wrap(op string, err error) error {
+	stat, err2 := d.p.Read(false, CTRLSTAT)
+	if err2 == nil && stat&(WDATAERR|STICKYERR|STICKYCMP|STICKYORUN) != 0 {
+		_ = d.p.Write(false, ABORT, abortClear)
+		return &FaultError{Op: op, Stat: stat, Err: err}
+	}
+	return fmt.Errorf("adiv5: %s: %w", op, err)
+}
+
+// check returns a FaultError if a sticky error flag is set, which is how
+// errors of posted writes are reported.
+func (d *DP) check(op string) error {
+	stat, err := d.p.Read(false, CTRLSTAT)
+	if err != nil {
+		return fmt.Errorf("adiv5: %s: %w", op, err)
+	}
+	if stat&(WDATAERR|STICKYERR|STICKYCMP|STICKYORUN) != 0 {
+		_ = d.p.Write(false, ABORT, abortClear)
+		return &FaultError{Op: op, Stat: stat, Err: ErrSticky}
+	}
+	return nil
+}
+
+// FaultError is returned when a transfer failed with a sticky error flag set
+// in CTRL/STAT. The flags have been cleared.
+type FaultError struct {
+	Op string
+	// Stat is the CTRL/STAT value before the flags were cleared.
+	Stat uint32
+	// Err is the transport error.
+	Err error
+}
+
+func (f *FaultError) Error() string {
+	return fmt.Sprintf("adiv5: %s: %v (CTRL/STAT %#08x)", f.Op, f.Err, f.Stat)
+}
+
+func (f *FaultError) Unwrap() error {
+	return f.Err
+}
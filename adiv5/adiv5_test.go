@@ -0,0 +1,190 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package adiv5_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"periph.io/x/d2xx/adiv5"
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/swd"
+)
+
+// ident writes the identification registers of a component.
+func ident(mem map[uint32]uint32, addr, cid uint32, pid uint64) {
+	for i := uint32(0); i < 4; i++ {
+		mem[addr+0xFD0+4*i] = uint32(pid>>(32+8*i)) & 0xFF
+		mem[addr+0xFE0+4*i] = uint32(pid>>(8*i)) & 0xFF
+		mem[addr+0xFF0+4*i] = cid >> (8 * i) & 0xFF
+	}
+}
+
+func newTarget(t *testing.T) (*d2xxtest.SWDTarget, *d2xxtest.MemAP, *adiv5.DP) {
+	target := d2xxtest.NewSWDTarget(0x2BA01477)
+	ap := d2xxtest.NewMemAP()
+	ap.Core = &d2xxtest.CortexM{CPUIDValue: 0x410FC241}
+	for a := uint32(0x20000000); a < 0x20001000; a += 4 {
+		ap.Mem[a] = a
+	}
+	// ROM table with the SCS and the DWT.
+	ap.Base = 0xE00FF003
+	ap.Mem[0xE00FF000] = 0xFFF0F003
+	ap.Mem[0xE00FF004] = 0xFFF02002
+	ap.Mem[0xE00FF008] = 0xFFF02003
+	ap.Mem[0xE00FF00C] = 0
+	ident(ap.Mem, 0xE00FF000, 0xB105100D, 0x04000BB4C4)
+	ident(ap.Mem, 0xE000E000, 0xB105E00D, 0x04000BB00C)
+	ident(ap.Mem, 0xE0001000, 0xB105E00D, 0x04003BB002)
+	target.APs = map[uint8]d2xxtest.SWDAP{0: ap, 1: &d2xxtest.MemAP{IDR: 0x14770002, Mem: map[uint32]uint32{}}}
+	s, _, err := swd.New(target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := adiv5.New(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target, ap, d
+}
+
+func TestDP(t *testing.T) {
+	_, _, d := newTarget(t)
+	aps, err := d.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aps) != 2 || !aps[0].IsMemAP() || aps[1].String() != "APB-AP #1 (IDR 0x14770002)" {
+		t.Fatalf("%+v", aps)
+	}
+	comps, err := d.MemAP(0).ROMTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"0xe00ff000: ROM table, ARM part 0x4c4 rev 0",
+		"0xe000e000: generic IP, ARM part 0x00c rev 0",
+		"0xe0001000: generic IP, ARM part 0x002 rev 3",
+	}
+	if len(comps) != len(want) {
+		t.Fatalf("%+v", comps)
+	}
+	for i, w := range want {
+		if s := comps[i].String(); s != w {
+			t.Errorf("#%d: got %q, want %q", i, s, w)
+		}
+	}
+	if comps[1].Depth != 1 {
+		t.Fatalf("unexpected depth %d", comps[1].Depth)
+	}
+}
+
+func TestMemAP(t *testing.T) {
+	_, ap, d := newTarget(t)
+	m := d.MemAP(0)
+	if v, err := m.Read32(0x20000010); err != nil || v != 0x20000010 {
+		t.Fatalf("%#x, %v", v, err)
+	}
+	if err := m.Write16(0x20000012, 0xBEEF); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Write8(0x20000011, 0x55); err != nil {
+		t.Fatal(err)
+	}
+	if ap.Mem[0x20000010] != 0xBEEF5510 {
+		t.Fatalf("%#x", ap.Mem[0x20000010])
+	}
+	if v, err := m.Read16(0x20000012); err != nil || v != 0xBEEF {
+		t.Fatalf("%#x, %v", v, err)
+	}
+	if v, err := m.Read8(0x20000013); err != nil || v != 0xBE {
+		t.Fatalf("%#x, %v", v, err)
+	}
+
+	// Crosses the 1KiB TAR auto-increment boundary.
+	w := make([]uint32, 300)
+	if err := m.ReadBlock32(0x20000200, w); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range w {
+		if v != 0x20000200+uint32(4*i) {
+			t.Fatalf("#%d: %#x", i, v)
+		}
+	}
+	b := make([]byte, 1030)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	if err := m.WriteMem(0x200003FD, b); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(b))
+	if err := m.ReadMem(0x200003FD, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, b) {
+		t.Fatalf("%x", got)
+	}
+	if ap.Mem[0x20000400] != 0x06050403 || ap.Mem[0x200003FC] != 0x020100FC {
+		t.Fatalf("%#x %#x", ap.Mem[0x20000400], ap.Mem[0x200003FC])
+	}
+
+	// Bus errors are reported and cleared.
+	var f *adiv5.FaultError
+	if _, err := m.Read32(0x30000000); !errors.As(err, &f) || f.Stat&adiv5.STICKYERR == 0 {
+		t.Fatalf("expected fault, got %v", err)
+	}
+	if err := m.Write32(0x30000000, 1); !errors.As(err, &f) {
+		t.Fatalf("expected fault, got %v", err)
+	}
+	if err := m.WriteBlock32(0x20000FF8, []uint32{1, 2, 3}); !errors.As(err, &f) {
+		t.Fatalf("expected fault, got %v", err)
+	}
+	if v, err := m.Read32(0x20000FFC); err != nil || v != 2 {
+		t.Fatalf("%#x, %v", v, err)
+	}
+	if _, err := m.Read32(0x20000001); err == nil {
+		t.Fatal("expected unaligned error")
+	}
+}
+
+func TestCortexM(t *testing.T) {
+	_, ap, d := newTarget(t)
+	c := adiv5.NewCortexM(d.MemAP(0))
+	if id, err := c.CPUID(); err != nil || id != 0x410FC241 {
+		t.Fatalf("%#x, %v", id, err)
+	}
+	if err := c.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := c.Halted(); err != nil || !h {
+		t.Fatal(h, err)
+	}
+	if err := c.WriteReg(adiv5.RegPC, 0x08000100); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.ReadReg(adiv5.RegPC); err != nil || v != 0x08000100 {
+		t.Fatalf("%#x, %v", v, err)
+	}
+	if err := c.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if ap.Core.Halted {
+		t.Fatal("expected running")
+	}
+	if err := c.Reset(true); err != nil {
+		t.Fatal(err)
+	}
+	if !ap.Core.Halted || ap.Core.Resets != 1 || ap.Core.DEMCR&1 != 0 {
+		t.Fatalf("%+v", ap.Core)
+	}
+	if err := c.Reset(false); err != nil {
+		t.Fatal(err)
+	}
+	if ap.Core.Halted || ap.Core.Resets != 2 {
+		t.Fatalf("%+v", ap.Core)
+	}
+}
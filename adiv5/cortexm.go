@@ -0,0 +1,165 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package adiv5
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Cortex-M System Control Space registers.
+const (
+	CPUID uint32 = 0xE000ED00
+	AIRCR uint32 = 0xE000ED0C
+	DHCSR uint32 = 0xE000EDF0
+	DCRSR uint32 = 0xE000EDF4
+	DCRDR uint32 = 0xE000EDF8
+	DEMCR uint32 = 0xE000EDFC
+)
+
+// DHCSR bits.
+const (
+	dhcsrKey      = 0xA05F0000
+	dhcsrDebugEn  = 1 << 0
+	dhcsrHalt     = 1 << 1
+	dhcsrRegReady = 1 << 16
+	dhcsrHalted   = 1 << 17
+	dhcsrResetSt  = 1 << 25
+)
+
+const (
+	aircrKey         = 0x05FA0000
+	aircrSysResetReq = 1 << 2
+	demcrVCCoreReset = 1 << 0
+	dcrsrWrite       = 1 << 16
+)
+
+// Core registers, as selected in DCRSR.
+const (
+	RegSP   uint8 = 13
+	RegLR   uint8 = 14
+	RegPC   uint8 = 15
+	RegXPSR uint8 = 16
+	RegMSP  uint8 = 17
+	RegPSP  uint8 = 18
+)
+
+// CortexM controls a Cortex-M core through its System Control Space.
+type CortexM struct {
+	m *MemAP
+}
+
+// NewCortexM returns a Cortex-M core behind the MEM-AP m, usually the AHB-AP
+// 0.
+func NewCortexM(m *MemAP) *CortexM {
+	return &CortexM{m: m}
+}
+
+// MemAP returns the MEM-AP used to access the core.
+func (c *CortexM) MemAP() *MemAP {
+	return c.m
+}
+
+// CPUID returns the CPUID register, which identifies the core.
+func (c *CortexM) CPUID() (uint32, error) {
+	return c.m.Read32(CPUID)
+}
+
+// Halted returns true if the core is in debug state.
+func (c *CortexM) Halted() (bool, error) {
+	v, err := c.m.Read32(DHCSR)
+	return v&dhcsrHalted != 0, err
+}
+
+// Halt enables halting debug and stops the core.
+func (c *CortexM) Halt() error {
+	if err := c.m.Write32(DHCSR, dhcsrKey|dhcsrDebugEn|dhcsrHalt); err != nil {
+		return err
+	}
+	return c.wait(dhcsrHalted)
+}
+
+// Resume restarts the core, keeping halting debug enabled.
+func (c *CortexM) Resume() error {
+	return c.m.Write32(DHCSR, dhcsrKey|dhcsrDebugEn)
+}
+
+// Reset does a system reset through AIRCR.SYSRESETREQ.
+//
+// If halt is true, the core is stopped on the reset vector with
+// DEMCR.VC_CORERESET.
+func (c *CortexM) Reset(halt bool) error {
+	demcr, err := c.m.Read32(DEMCR)
+	if err != nil {
+		return err
+	}
+	if halt {
+		if err := c.m.Write32(DHCSR, dhcsrKey|dhcsrDebugEn); err != nil {
+			return err
+		}
+		if err := c.m.Write32(DEMCR, demcr|demcrVCCoreReset); err != nil {
+			return err
+		}
+	}
+	// Clear S_RESET_ST, which is cleared on read.
+	if _, err := c.m.Read32(DHCSR); err != nil {
+		return err
+	}
+	// The reset may abort the transfer itself.
+	var f *FaultError
+	if err := c.m.Write32(AIRCR, aircrKey|aircrSysResetReq); err != nil && !errors.As(err, &f) {
+		return err
+	}
+	if err := c.wait(dhcsrResetSt); err != nil {
+		return err
+	}
+	if !halt {
+		return nil
+	}
+	if err := c.wait(dhcsrHalted); err != nil {
+		return err
+	}
+	return c.m.Write32(DEMCR, demcr&^demcrVCCoreReset)
+}
+
+// ReadReg reads a core register. The core must be halted.
+func (c *CortexM) ReadReg(r uint8) (uint32, error) {
+	if err := c.m.Write32(DCRSR, uint32(r)); err != nil {
+		return 0, err
+	}
+	if err := c.wait(dhcsrRegReady); err != nil {
+		return 0, err
+	}
+	return c.m.Read32(DCRDR)
+}
+
+// WriteReg writes a core register. The core must be halted.
+func (c *CortexM) WriteReg(r uint8, v uint32) error {
+	if err := c.m.Write32(DCRDR, v); err != nil {
+		return err
+	}
+	if err := c.m.Write32(DCRSR, dcrsrWrite|uint32(r)); err != nil {
+		return err
+	}
+	return c.wait(dhcsrRegReady)
+}
+
+//
+
+// wait polls DHCSR until bit is set. Transfer faults are tolerated since the
+// core may be in reset.
+func (c *CortexM) wait(bit uint32) error {
+	var f *FaultError
+	for i := 0; i < polls; i++ {
+		v, err := c.m.Read32(DHCSR)
+		if err == nil && v&bit != 0 {
+			return nil
+		}
+		if err != nil && !errors.As(err, &f) {
+			return err
+		}
+	}
+	return fmt.Errorf("adiv5: DHCSR %#08x: %w", bit, ErrTimeout)
+}
@@ -0,0 +1,319 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package adiv5
+
+import (
+	"fmt"
+)
+
+// MEM-AP registers.
+const (
+	CSW  uint8 = 0x00
+	TAR  uint8 = 0x04
+	DRW  uint8 = 0x0C
+	BD0  uint8 = 0x10
+	CFG  uint8 = 0xF4
+	BASE uint8 = 0xF8
+)
+
+// CSW fields.
+const (
+	cswSize8   = 0
+	cswSize16  = 1
+	cswSize32  = 2
+	cswAddrInc = 1 << 4
+	// cswDefault is a privileged data access from the debugger.
+	cswDefault = 0x23000000
+)
+
+// tarWrap is the TAR auto-increment boundary. Only the 10 least significant
+// bits are guaranteed to increment.
+const tarWrap = 1024
+
+// MemAP is a MEM-AP, giving access to a memory bus.
+//
+// CSW and TAR are cached to save transfers.
+type MemAP struct {
+	d     *DP
+	sel   uint8
+	csw   uint32
+	cswOK bool
+	tar   uint32
+	tarOK bool
+}
+
+// MemAP returns the MEM-AP apsel.
+func (d *DP) MemAP(apsel uint8) *MemAP {
+	return &MemAP{d: d, sel: apsel}
+}
+
+// DP returns the Debug Port.
+func (m *MemAP) DP() *DP {
+	return m.d
+}
+
+// Base returns the BASE register, which points to the ROM table.
+func (m *MemAP) Base() (uint32, error) {
+	return m.d.ReadAP(m.sel, BASE)
+}
+
+// Read32 reads a word. addr must be 4 bytes aligned.
+func (m *MemAP) Read32(addr uint32) (uint32, error) {
+	if addr&3 != 0 {
+		return 0, fmt.Errorf("adiv5: unaligned address %#08x", addr)
+	}
+	return m.read(addr, cswSize32)
+}
+
+// Write32 writes a word. addr must be 4 bytes aligned.
+func (m *MemAP) Write32(addr, v uint32) error {
+	if addr&3 != 0 {
+		return fmt.Errorf("adiv5: unaligned address %#08x", addr)
+	}
+	return m.write(addr, cswSize32, v)
+}
+
+// Read16 reads a half word. addr must be 2 bytes aligned.
+func (m *MemAP) Read16(addr uint32) (uint16, error) {
+	if addr&1 != 0 {
+		return 0, fmt.Errorf("adiv5: unaligned address %#08x", addr)
+	}
+	v, err := m.read(addr, cswSize16)
+	return uint16(v >> (8 * (addr & 3))), err
+}
+
+// Write16 writes a half word. addr must be 2 bytes aligned.
+func (m *MemAP) Write16(addr uint32, v uint16) error {
+	if addr&1 != 0 {
+		return fmt.Errorf("adiv5: unaligned address %#08x", addr)
+	}
+	return m.write(addr, cswSize16, uint32(v)<<(8*(addr&3)))
+}
+
+// Read8 reads a byte.
+func (m *MemAP) Read8(addr uint32) (byte, error) {
+	v, err := m.read(addr, cswSize8)
+	return byte(v >> (8 * (addr & 3))), err
+}
+
+// Write8 writes a byte.
+func (m *MemAP) Write8(addr uint32, v byte) error {
+	return m.write(addr, cswSize8, uint32(v)<<(8*(addr&3)))
+}
+
+// ReadBlock32 reads consecutive words starting at addr, which must be 4 bytes
+// aligned.
+//
+// The AP reads are pipelined and TAR auto-increments; it is reloaded at each
+// 1KiB boundary.
+func (m *MemAP) ReadBlock32(addr uint32, buf []uint32) error {
+	if addr&3 != 0 {
+		return fmt.Errorf("adiv5: unaligned address %#08x", addr)
+	}
+	if err := m.setCSW(cswSize32 | cswAddrInc); err != nil {
+		return err
+	}
+	m.tarOK = false
+	for len(buf) != 0 {
+		n := int(tarWrap-addr%tarWrap) / 4
+		if n > len(buf) {
+			n = len(buf)
+		}
+		if err := m.d.WriteAP(m.sel, TAR, addr); err != nil {
+			return err
+		}
+		if err := m.d.selectAP(m.sel, DRW); err != nil {
+			return err
+		}
+		op := fmt.Sprintf("read %#08x", addr)
+		for i := 0; i < n; i++ {
+			v, err := m.d.p.Read(true, DRW)
+			if err != nil {
+				return m.fail(op, err)
+			}
+			if i != 0 {
+				buf[i-1] = v
+			}
+		}
+		v, err := m.d.p.Read(false, RDBUFF)
+		if err != nil {
+			return m.fail(op, err)
+		}
+		buf[n-1] = v
+		buf = buf[n:]
+		addr += uint32(4 * n)
+	}
+	return nil
+}
+
+// WriteBlock32 writes consecutive words starting at addr, which must be 4
+// bytes aligned.
+func (m *MemAP) WriteBlock32(addr uint32, buf []uint32) error {
+	if addr&3 != 0 {
+		return fmt.Errorf("adiv5: unaligned address %#08x", addr)
+	}
+	if err := m.setCSW(cswSize32 | cswAddrInc); err != nil {
+		return err
+	}
+	m.tarOK = false
+	op := fmt.Sprintf("write %#08x", addr)
+	for len(buf) != 0 {
+		n := int(tarWrap-addr%tarWrap) / 4
+		if n > len(buf) {
+			n = len(buf)
+		}
+		if err := m.d.WriteAP(m.sel, TAR, addr); err != nil {
+			return err
+		}
+		if err := m.d.selectAP(m.sel, DRW); err != nil {
+			return err
+		}
+		for _, v := range buf[:n] {
+			if err := m.d.p.Write(true, DRW, v); err != nil {
+				return m.fail(op, err)
+			}
+		}
+		buf = buf[n:]
+		addr += uint32(4 * n)
+	}
+	return m.d.check(op)
+}
+
+// ReadMem reads len(b) bytes starting at addr, using word accesses for the
+// aligned part.
+func (m *MemAP) ReadMem(addr uint32, b []byte) error {
+	for ; len(b) != 0 && (addr&3 != 0 || len(b) < 4); addr, b = addr+1, b[1:] {
+		v, err := m.Read8(addr)
+		if err != nil {
+			return err
+		}
+		b[0] = v
+	}
+	if n := len(b) / 4; n != 0 {
+		w := make([]uint32, n)
+		if err := m.ReadBlock32(addr, w); err != nil {
+			return err
+		}
+		for i, v := range w {
+			b[4*i] = byte(v)
+			b[4*i+1] = byte(v >> 8)
+			b[4*i+2] = byte(v >> 16)
+			b[4*i+3] = byte(v >> 24)
+		}
+		addr += uint32(4 * n)
+		b = b[4*n:]
+	}
+	for i := range b {
+		v, err := m.Read8(addr + uint32(i))
+		if err != nil {
+			return err
+		}
+		b[i] = v
+	}
+	return nil
+}
+
+// WriteMem writes b starting at addr, using word accesses for the aligned
+// part.
+func (m *MemAP) WriteMem(addr uint32, b []byte) error {
+	for ; len(b) != 0 && (addr&3 != 0 || len(b) < 4); addr, b = addr+1, b[1:] {
+		if err := m.Write8(addr, b[0]); err != nil {
+			return err
+		}
+	}
+	if n := len(b) / 4; n != 0 {
+		w := make([]uint32, n)
+		for i := range w {
+			w[i] = uint32(b[4*i]) | uint32(b[4*i+1])<<8 | uint32(b[4*i+2])<<16 | uint32(b[4*i+3])<<24
+		}
+		if err := m.WriteBlock32(addr, w); err != nil {
+			return err
+		}
+		addr += uint32(4 * n)
+		b = b[4*n:]
+	}
+	for i, v := range b {
+		if err := m.Write8(addr+uint32(i), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//
+
+// read does a single access of the given size.
+func (m *MemAP) read(addr uint32, size uint32) (uint32, error) {
+	if err := m.setCSW(size); err != nil {
+		return 0, err
+	}
+	if err := m.setTAR(addr); err != nil {
+		return 0, err
+	}
+	if err := m.d.selectAP(m.sel, DRW); err != nil {
+		return 0, err
+	}
+	op := fmt.Sprintf("read %#08x", addr)
+	if _, err := m.d.p.Read(true, DRW); err != nil {
+		return 0, m.fail(op, err)
+	}
+	v, err := m.d.p.Read(false, RDBUFF)
+	if err != nil {
+		return 0, m.fail(op, err)
+	}
+	return v, nil
+}
+
+// write does a single access of the given size and checks for errors.
+func (m *MemAP) write(addr uint32, size uint32, v uint32) error {
+	if err := m.setCSW(size); err != nil {
+		return err
+	}
+	if err := m.setTAR(addr); err != nil {
+		return err
+	}
+	if err := m.d.selectAP(m.sel, DRW); err != nil {
+		return err
+	}
+	op := fmt.Sprintf("write %#08x", addr)
+	if err := m.d.p.Write(true, DRW, v); err != nil {
+		return m.fail(op, err)
+	}
+	return m.d.check(op)
+}
+
+func (m *MemAP) setCSW(v uint32) error {
+	v |= cswDefault
+	if m.cswOK && m.csw == v {
+		return nil
+	}
+	if err := m.d.WriteAP(m.sel, CSW, v); err != nil {
+		m.cswOK = false
+		return err
+	}
+	m.csw = v
+	m.cswOK = true
+	return nil
+}
+
+func (m *MemAP) setTAR(addr uint32) error {
+	if m.tarOK && m.tar == addr {
+		return nil
+	}
+	if err := m.d.WriteAP(m.sel, TAR, addr); err != nil {
+		m.tarOK = false
+		return err
+	}
+	m.tar = addr
+	m.tarOK = true
+	return nil
+}
+
+// fail invalidates the cached registers and wraps err.
+func (m *MemAP) fail(op string, err error) error {
+	m.cswOK = false
+	m.tarOK = false
+	return m.d.wrap(op, err)
+}
@@ -0,0 +1,155 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package adiv5
+
+import (
+	"errors"
+	"fmt"
+
+	"periph.io/x/d2xx/jtag"
+)
+
+// Component classes.
+const (
+	ClassROMTable   = 0x1
+	ClassCoreSight  = 0x9
+	ClassGenericIP  = 0xE
+	ClassPrimeCell  = 0xF
+	maxROMEntries   = 960
+	maxROMDepth     = 8
+	componentIDMask = 0xFFFF0FFF
+	componentID     = 0xB105000D
+)
+
+// Component is a debug component found while walking the ROM tables.
+type Component struct {
+	// Addr is the base address of the component's 4KiB block.
+	Addr uint32
+	// CID is the component identification, from CIDR0~3.
+	CID uint32
+	// PID is the peripheral identification, from PIDR0~7.
+	PID uint64
+	// Depth is the ROM table nesting level, 0 being the top level table.
+	Depth int
+}
+
+// Class returns the component class, e.g. ClassROMTable.
+func (c *Component) Class() uint8 {
+	return uint8(c.CID >> 12 & 0xF)
+}
+
+// Part returns the part number assigned by the designer.
+func (c *Component) Part() uint16 {
+	return uint16(c.PID & 0xFFF)
+}
+
+// Revision returns the part revision.
+func (c *Component) Revision() uint8 {
+	return uint8(c.PID >> 20 & 0xF)
+}
+
+// Designer returns the JEP106 identity of the designer, encoded like in a
+// JTAG IDCODE.
+func (c *Component) Designer() jtag.IDCode {
+	code := uint32(c.PID >> 12 & 0x7F)
+	cont := uint32(c.PID >> 32 & 0xF)
+	return jtag.IDCode((cont<<7|code)<<1 | 1)
+}
+
+func (c *Component) String() string {
+	class := "class " + fmt.Sprint(c.Class())
+	switch c.Class() {
+	case ClassROMTable:
+		class = "ROM table"
+	case ClassCoreSight:
+		class = "CoreSight"
+	case ClassGenericIP:
+		class = "generic IP"
+	case ClassPrimeCell:
+		class = "PrimeCell"
+	}
+	return fmt.Sprintf("%#08x: %s, %s part %#03x rev %d", c.Addr, class, c.Designer().ManufacturerName(), c.Part(), c.Revision())
+}
+
+// ROMTable walks the ROM tables starting at BASE and returns all the
+// components found, depth first.
+//
+// Entries that can't be read, usually because their power domain is off, are
+// skipped.
+func (m *MemAP) ROMTable() ([]Component, error) {
+	base, err := m.Base()
+	if err != nil {
+		return nil, err
+	}
+	// 0xFFFFFFFF is the legacy "no debug entry" value; otherwise bit 0 is the
+	// present bit when bit 1 is set.
+	if base == 0xFFFFFFFF || (base&2 != 0 && base&1 == 0) {
+		return nil, nil
+	}
+	var out []Component
+	seen := map[uint32]bool{}
+	err = m.walk(base&^0xFFF, 0, seen, &out)
+	return out, err
+}
+
+//
+
+func (m *MemAP) walk(addr uint32, depth int, seen map[uint32]bool, out *[]Component) error {
+	seen[addr] = true
+	c, err := m.component(addr)
+	if err != nil {
+		return err
+	}
+	if c.CID&componentIDMask != componentID {
+		if depth == 0 {
+			return fmt.Errorf("adiv5: invalid ROM table CID %#08x at %#08x", c.CID, addr)
+		}
+		return nil
+	}
+	c.Depth = depth
+	*out = append(*out, c)
+	if c.Class() != ClassROMTable || depth >= maxROMDepth {
+		return nil
+	}
+	for i := uint32(0); i < maxROMEntries; i++ {
+		e, err := m.Read32(addr + 4*i)
+		if err != nil {
+			return err
+		}
+		if e == 0 {
+			break
+		}
+		if e&1 == 0 {
+			continue
+		}
+		child := addr + e&^0xFFF
+		if seen[child] {
+			continue
+		}
+		var f *FaultError
+		if err := m.walk(child, depth+1, seen, out); errors.As(err, &f) {
+			continue
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// component reads the identification registers of the component at addr.
+func (m *MemAP) component(addr uint32) (Component, error) {
+	// PIDR4~7, PIDR0~3, CIDR0~3.
+	var r [12]uint32
+	if err := m.ReadBlock32(addr+0xFD0, r[:]); err != nil {
+		return Component{}, err
+	}
+	c := Component{Addr: addr}
+	for i := 0; i < 4; i++ {
+		c.PID |= uint64(r[4+i]&0xFF) << (8 * uint(i))
+		c.PID |= uint64(r[i]&0xFF) << (8 * uint(4+i))
+		c.CID |= (r[8+i] & 0xFF) << (8 * uint(i))
+	}
+	return c, nil
+}
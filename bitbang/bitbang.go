@@ -0,0 +1,234 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package bitbang drives the asynchronous and synchronous bit-bang modes of
+// FTDI devices opened through d2xx.
+//
+// In both modes, each byte written is applied to the 8 data pins at a rate
+// derived from the baud rate generator. In synchronous mode, the pins are
+// sampled before each byte is applied and the samples are returned in the
+// read buffer, one byte per byte written.
+package bitbang
+
+import (
+	"errors"
+	"fmt"
+
+	"periph.io/x/d2xx"
+)
+
+// DefaultChunkSize is the default USB transfer size, which is the d2xx
+// driver's default.
+const DefaultChunkSize = 4096
+
+// Multiplier returns the ratio between the bit-bang sample rate and the baud
+// rate set with SetBaudRate for a device type.
+//
+// The R, X and H series sample at 16 times the baud rate, as documented in
+// AN_232R-01. The older BM and 2232C run at 4 times the baud rate.
+func Multiplier(devType uint32) uint32 {
+	switch devType {
+	case d2xx.DeviceAM, d2xx.DeviceBM, d2xx.Device2232C:
+		return 4
+	default:
+		return 16
+	}
+}
+
+// maxBaud returns the highest baud rate supported by the device type.
+func maxBaud(devType uint32) uint32 {
+	switch devType {
+	case d2xx.Device2232H, d2xx.Device4232H, d2xx.Device232H:
+		return 12000000
+	default:
+		return 3000000
+	}
+}
+
+// Opts is the configuration of an Engine.
+type Opts struct {
+	// Mask selects the output pins; a bit set means output.
+	Mask byte
+	// Sync selects the synchronous bit-bang mode, which captures the pins.
+	Sync bool
+	// Rate is the sample rate in Hz. Defaults to 1MHz.
+	Rate uint32
+	// ChunkSize is the maximum number of bytes per USB transfer. Defaults to
+	// DefaultChunkSize.
+	ChunkSize int
+}
+
+// Engine plays patterns in bit-bang mode.
+//
+// It is not safe for concurrent use.
+type Engine struct {
+	h       d2xx.Handle
+	devType uint32
+	mask    byte
+	sync    bool
+	rate    uint32
+	chunk   int
+	out     byte
+}
+
+// New resets the device and switches it to bit-bang mode.
+func New(h d2xx.Handle, opts *Opts) (*Engine, error) {
+	o := Opts{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Rate == 0 {
+		o.Rate = 1000000
+	}
+	if o.ChunkSize == 0 {
+		o.ChunkSize = DefaultChunkSize
+	}
+	if o.ChunkSize < 64 || o.ChunkSize > 65536 || o.ChunkSize%64 != 0 {
+		return nil, fmt.Errorf("bitbang: invalid chunk size %d", o.ChunkSize)
+	}
+	d, _, _, e := h.GetDeviceInfo()
+	if e != 0 {
+		return nil, toErr("GetDeviceInfo", e)
+	}
+	b := &Engine{h: h, devType: d, mask: o.Mask, sync: o.Sync, chunk: o.ChunkSize}
+	if e := h.ResetDevice(); e != 0 {
+		return nil, toErr("ResetDevice", e)
+	}
+	if e := h.SetUSBParameters(o.ChunkSize, o.ChunkSize); e != 0 {
+		return nil, toErr("SetUSBParameters", e)
+	}
+	if e := h.SetTimeouts(1000, 1000); e != 0 {
+		return nil, toErr("SetTimeouts", e)
+	}
+	if e := h.SetLatencyTimer(1); e != 0 {
+		return nil, toErr("SetLatencyTimer", e)
+	}
+	if _, err := b.SetRate(o.Rate); err != nil {
+		return nil, err
+	}
+	mode := d2xx.BitModeAsyncBitbang
+	if o.Sync {
+		mode = d2xx.BitModeSyncBitbang
+	}
+	if e := h.SetBitMode(o.Mask, mode); e != 0 {
+		return nil, toErr("SetBitMode", e)
+	}
+	return b, nil
+}
+
+// Handle returns the underlying handle.
+func (b *Engine) Handle() d2xx.Handle {
+	return b.h
+}
+
+// Sync returns true in synchronous mode.
+func (b *Engine) Sync() bool {
+	return b.sync
+}
+
+// Rate returns the effective sample rate.
+func (b *Engine) Rate() uint32 {
+	return b.rate
+}
+
+// SetRate sets the sample rate and returns the effective rate, which is
+// rounded to a multiple of the device's multiplier.
+func (b *Engine) SetRate(hz uint32) (uint32, error) {
+	m := Multiplier(b.devType)
+	baud := (hz + m/2) / m
+	if baud == 0 {
+		baud = 1
+	}
+	if max := maxBaud(b.devType); baud > max {
+		return 0, fmt.Errorf("bitbang: rate %dHz is too high; max is %dHz", hz, max*m)
+	}
+	if e := b.h.SetBaudRate(baud); e != 0 {
+		return 0, toErr("SetBaudRate", e)
+	}
+	b.rate = baud * m
+	return b.rate, nil
+}
+
+// Play writes the pattern, chunked to the USB transfer size.
+//
+// In synchronous mode, the pins sampled before each byte is applied are
+// returned. In asynchronous mode, nil is returned.
+func (b *Engine) Play(pattern []byte) ([]byte, error) {
+	var out []byte
+	if b.sync {
+		out = make([]byte, 0, len(pattern))
+	}
+	for len(pattern) != 0 {
+		n := len(pattern)
+		if n > b.chunk {
+			n = b.chunk
+		}
+		if err := b.write(pattern[:n]); err != nil {
+			return out, err
+		}
+		b.out = pattern[n-1]
+		if b.sync {
+			var err error
+			if out, err = b.read(out, n); err != nil {
+				return out, err
+			}
+		}
+		pattern = pattern[n:]
+	}
+	return out, nil
+}
+
+// Pins returns the instantaneous level of the pins.
+func (b *Engine) Pins() (byte, error) {
+	v, e := b.h.GetBitMode()
+	if e != 0 {
+		return 0, toErr("GetBitMode", e)
+	}
+	return v, nil
+}
+
+// Close resets the bit mode. The handle is not closed.
+func (b *Engine) Close() error {
+	if e := b.h.SetBitMode(0, d2xx.BitModeReset); e != 0 {
+		return toErr("SetBitMode", e)
+	}
+	return nil
+}
+
+//
+
+func (b *Engine) write(p []byte) error {
+	for len(p) != 0 {
+		n, e := b.h.Write(p)
+		if e != 0 {
+			return toErr("Write", e)
+		}
+		if n == 0 {
+			return errors.New("bitbang: write timed out")
+		}
+		p = p[n:]
+	}
+	return nil
+}
+
+// read appends n bytes read to out.
+func (b *Engine) read(out []byte, n int) ([]byte, error) {
+	l := len(out)
+	out = out[:l+n]
+	for got := 0; got < n; {
+		r, e := b.h.Read(out[l+got:])
+		if e != 0 {
+			return out[:l+got], toErr("Read", e)
+		}
+		if r == 0 {
+			return out[:l+got], fmt.Errorf("bitbang: read timed out after %d of %d bytes", got, n)
+		}
+		got += r
+	}
+	return out, nil
+}
+
+func toErr(op string, e d2xx.Err) error {
+	return fmt.Errorf("bitbang: %s: %s", op, e)
+}
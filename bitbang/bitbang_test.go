@@ -0,0 +1,97 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package bitbang_test
+
+import (
+	"testing"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/bitbang"
+	"periph.io/x/d2xx/d2xxtest"
+)
+
+// counter counts the USB writes.
+type counter struct {
+	*d2xxtest.BitBang
+	writes int
+}
+
+func (c *counter) Write(b []byte) (int, d2xx.Err) {
+	c.writes++
+	return c.BitBang.Write(b)
+}
+
+func TestEngine_sync(t *testing.T) {
+	f := d2xxtest.NewBitBang()
+	f.Input = func(n int) byte { return byte(n << 4) }
+	h := &counter{BitBang: f}
+	b, err := bitbang.New(h, &bitbang.Opts{Mask: 0x0F, Sync: true, Rate: 1000000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.BitMode != d2xx.BitModeSyncBitbang || f.BitMask != 0x0F || f.Baud != 62500 || b.Rate() != 1000000 {
+		t.Fatalf("mode %#x mask %#x baud %d rate %d", f.BitMode, f.BitMask, f.Baud, b.Rate())
+	}
+	pattern := make([]byte, 10000)
+	for i := range pattern {
+		pattern[i] = byte(i)
+	}
+	got, err := b.Play(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.writes != 3 {
+		t.Fatalf("expected 3 chunks, got %d", h.writes)
+	}
+	if len(got) != len(pattern) {
+		t.Fatalf("got %d samples", len(got))
+	}
+	for i, v := range got {
+		var prev byte
+		if i != 0 {
+			prev = pattern[i-1]
+		}
+		if want := prev&0x0F | byte(i<<4); v != want {
+			t.Fatalf("#%d: got %#x, want %#x", i, v, want)
+		}
+	}
+	if v, err := b.Pins(); err != nil || v&0x0F != 0x0F {
+		t.Fatalf("%#x, %v", v, err)
+	}
+	if err := b.Close(); err != nil || f.BitMode != d2xx.BitModeReset {
+		t.Fatal(f.BitMode, err)
+	}
+}
+
+func TestEngine_async(t *testing.T) {
+	f := d2xxtest.NewBitBang()
+	f.DevType = d2xx.DeviceBM
+	b, err := bitbang.New(f, &bitbang.Opts{Mask: 0xFF, Rate: 100000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Baud != 25000 || f.BitMode != d2xx.BitModeAsyncBitbang {
+		t.Fatal(f.Baud, f.BitMode)
+	}
+	got, err := b.Play([]byte{1, 2, 3})
+	if err != nil || got != nil || string(f.Written()) != "\x01\x02\x03" {
+		t.Fatal(got, err)
+	}
+	if _, err := b.SetRate(20000000); err == nil {
+		t.Fatal("expected rate too high")
+	}
+	if r, err := b.SetRate(1001); err != nil || r != 1000 {
+		t.Fatal(r, err)
+	}
+}
+
+func TestMultiplier(t *testing.T) {
+	if m := bitbang.Multiplier(d2xx.Device232H); m != 16 {
+		t.Fatal(m)
+	}
+	if m := bitbang.Multiplier(d2xx.Device2232C); m != 4 {
+		t.Fatal(m)
+	}
+}
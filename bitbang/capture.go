@@ -0,0 +1,276 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package bitbang
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TriggerKind is the condition that starts a capture.
+type TriggerKind int
+
+// Trigger kinds.
+const (
+	// TriggerNone triggers on the first sample.
+	TriggerNone TriggerKind = iota
+	// TriggerRising triggers when one of the channels in Mask goes high.
+	TriggerRising
+	// TriggerFalling triggers when one of the channels in Mask goes low.
+	TriggerFalling
+	// TriggerEdge triggers when one of the channels in Mask changes.
+	TriggerEdge
+	// TriggerPattern triggers when the channels in Mask match Value.
+	TriggerPattern
+	// TriggerPatternCount triggers Count samples after the channels in Mask
+	// matched Value.
+	TriggerPatternCount
+)
+
+func (t TriggerKind) String() string {
+	switch t {
+	case TriggerNone:
+		return "none"
+	case TriggerRising:
+		return "rising"
+	case TriggerFalling:
+		return "falling"
+	case TriggerEdge:
+		return "edge"
+	case TriggerPattern:
+		return "pattern"
+	case TriggerPatternCount:
+		return "pattern-then-count"
+	default:
+		return fmt.Sprintf("TriggerKind(%d)", int(t))
+	}
+}
+
+// Trigger is a trigger condition.
+type Trigger struct {
+	Kind TriggerKind
+	// Mask selects the channels the condition applies to.
+	Mask byte
+	// Value is the pattern for TriggerPattern and TriggerPatternCount.
+	Value byte
+	// Count is the delay in samples for TriggerPatternCount.
+	Count int
+}
+
+// CaptureOpts is the configuration of a capture.
+type CaptureOpts struct {
+	Trigger Trigger
+	// PreTrigger is the number of samples kept before the trigger.
+	PreTrigger int
+	// Samples is the number of samples captured from the trigger, included.
+	Samples int
+	// Timeout is the maximum time to wait for the trigger. 0 means forever.
+	Timeout time.Duration
+	// Depth is the number of USB transfers kept in flight. Defaults to 2.
+	Depth int
+}
+
+// Capture is the result of a capture.
+type Capture struct {
+	// Samples are the pin samples, one byte per sample.
+	Samples []byte
+	// Trigger is the index of the trigger sample in Samples.
+	Trigger int
+	// Rate is the sample rate in Hz.
+	Rate uint32
+	// Overruns is the number of times the device ran out of data to clock
+	// while the host was busy, leaving a gap in the sampling.
+	Overruns int
+}
+
+// Errors returned by Capture.
+var (
+	// ErrOverrun is returned along the capture when the sampling had gaps.
+	ErrOverrun = errors.New("bitbang: capture overrun; samples are not evenly spaced")
+	// ErrTriggerTimeout is returned when the trigger didn't fire in time.
+	ErrTriggerTimeout = errors.New("bitbang: trigger timed out")
+)
+
+// Capture streams samples until the trigger fires and the requested number of
+// samples is captured.
+//
+// The engine must be in synchronous mode. The output pins keep the last value
+// played.
+//
+// The device only samples when it has data to clock out, so filler bytes are
+// streamed with Depth transfers in flight. Before each read, GetQueueStatus
+// tells how far behind the host is; if all the bytes in flight were already
+// sampled, the device starved and the sampling had a gap. The gaps are
+// counted in Capture.Overruns and ErrOverrun is returned along the samples.
+//
+// On return, the samples still in flight are read and discarded, so the next
+// Play or Pins is in sync.
+func (b *Engine) Capture(opts *CaptureOpts) (c *Capture, err error) {
+	if !b.sync {
+		return nil, errors.New("bitbang: capture requires the synchronous mode")
+	}
+	o := CaptureOpts{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Depth == 0 {
+		o.Depth = 2
+	}
+	if o.Samples <= 0 || o.PreTrigger < 0 || o.Depth < 1 {
+		return nil, errors.New("bitbang: invalid capture options")
+	}
+	var deadline time.Time
+	if o.Timeout > 0 {
+		deadline = time.Now().Add(o.Timeout)
+	}
+	fill := make([]byte, b.chunk)
+	for i := range fill {
+		fill[i] = b.out
+	}
+	buf := make([]byte, b.chunk)
+	t := trigger{Trigger: o.Trigger}
+	pre := newRing(o.PreTrigger)
+	c = &Capture{Rate: b.rate, Trigger: -1}
+	inflight := 0
+	defer func() {
+		if inflight == 0 {
+			return
+		}
+		// Report the failure to resync only if nothing else went wrong.
+		if _, err2 := b.read(make([]byte, 0, inflight), inflight); err2 != nil && (err == nil || err == ErrOverrun) {
+			c, err = nil, err2
+		}
+	}()
+	for i := 0; i < o.Depth; i++ {
+		if err := b.write(fill); err != nil {
+			return nil, err
+		}
+		inflight += len(fill)
+	}
+	for {
+		q, e := b.h.GetQueueStatus()
+		if e != 0 {
+			return nil, toErr("GetQueueStatus", e)
+		}
+		if int(q) >= inflight {
+			c.Overruns++
+		}
+		// Keep the device busy while processing this transfer.
+		if err := b.write(fill); err != nil {
+			return nil, err
+		}
+		inflight += len(fill)
+		got, err := b.read(buf[:0], len(buf))
+		inflight -= len(got)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range got {
+			if c.Trigger < 0 {
+				if !t.match(s) {
+					pre.push(s)
+					continue
+				}
+				c.Samples = pre.appendTo(make([]byte, 0, pre.len()+o.Samples))
+				c.Trigger = len(c.Samples)
+				// Overruns before the trigger don't matter.
+				c.Overruns = 0
+			}
+			c.Samples = append(c.Samples, s)
+			if len(c.Samples)-c.Trigger == o.Samples {
+				if c.Overruns != 0 {
+					return c, ErrOverrun
+				}
+				return c, nil
+			}
+		}
+		if c.Trigger < 0 && !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, ErrTriggerTimeout
+		}
+	}
+}
+
+//
+
+// trigger evaluates a trigger condition sample by sample.
+type trigger struct {
+	Trigger
+	prev    byte
+	started bool
+	// armed is the number of samples since the pattern matched for
+	// TriggerPatternCount, or -1.
+	armed int
+}
+
+func (t *trigger) match(s byte) bool {
+	prev, started := t.prev, t.started
+	t.prev, t.started = s, true
+	switch t.Kind {
+	case TriggerNone:
+		return true
+	case TriggerRising:
+		return started && ^prev&s&t.Mask != 0
+	case TriggerFalling:
+		return started && prev&^s&t.Mask != 0
+	case TriggerEdge:
+		return started && (prev^s)&t.Mask != 0
+	case TriggerPattern:
+		return s&t.Mask == t.Value&t.Mask
+	case TriggerPatternCount:
+		if !started {
+			t.armed = -1
+		}
+		if t.armed < 0 {
+			if s&t.Mask != t.Value&t.Mask {
+				return false
+			}
+			t.armed = 0
+		}
+		if t.armed == t.Count {
+			return true
+		}
+		t.armed++
+		return false
+	}
+	return false
+}
+
+// ring keeps the last n samples.
+type ring struct {
+	buf  []byte
+	next int
+	full bool
+}
+
+func newRing(n int) *ring {
+	return &ring{buf: make([]byte, n)}
+}
+
+func (r *ring) push(s byte) {
+	if len(r.buf) == 0 {
+		return
+	}
+	r.buf[r.next] = s
+	if r.next++; r.next == len(r.buf) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+func (r *ring) len() int {
+	if r.full {
+		return len(r.buf)
+	}
+	return r.next
+}
+
+// appendTo appends the samples, oldest first.
+func (r *ring) appendTo(out []byte) []byte {
+	if r.full {
+		out = append(out, r.buf[r.next:]...)
+	}
+	return append(out, r.buf[:r.next]...)
+}
@@ -0,0 +1,113 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package bitbang_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"periph.io/x/d2xx/bitbang"
+	"periph.io/x/d2xx/d2xxtest"
+)
+
+func newSampler(t *testing.T, input func(n int) byte) (*d2xxtest.BitBang, *bitbang.Engine) {
+	f := d2xxtest.NewBitBang()
+	f.Input = input
+	f.Lag = 64
+	b, err := bitbang.New(f, &bitbang.Opts{Sync: true, Rate: 1000000, ChunkSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, b
+}
+
+func TestCapture_edge(t *testing.T) {
+	_, b := newSampler(t, func(n int) byte {
+		if n >= 5000 {
+			return 0x10
+		}
+		return 0
+	})
+	c, err := b.Capture(&bitbang.CaptureOpts{
+		Trigger:    bitbang.Trigger{Kind: bitbang.TriggerRising, Mask: 0x10},
+		PreTrigger: 100,
+		Samples:    200,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Samples) != 300 || c.Trigger != 100 || c.Overruns != 0 || c.Rate != 1000000 {
+		t.Fatalf("%d samples, trigger %d, %d overruns", len(c.Samples), c.Trigger, c.Overruns)
+	}
+	if c.Samples[99] != 0 || c.Samples[100] != 0x10 || c.Samples[299] != 0x10 {
+		t.Fatalf("%#x %#x", c.Samples[99], c.Samples[100])
+	}
+}
+
+func TestCapture_patternCount(t *testing.T) {
+	_, b := newSampler(t, func(n int) byte { return byte(n) })
+	c, err := b.Capture(&bitbang.CaptureOpts{
+		Trigger: bitbang.Trigger{Kind: bitbang.TriggerPatternCount, Mask: 0xFF, Value: 0x42, Count: 3},
+		// More than what was sampled before the trigger.
+		PreTrigger: 1000,
+		Samples:    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Trigger != 0x45 || c.Samples[c.Trigger] != 0x45 || c.Samples[0] != 0 {
+		t.Fatalf("trigger %d: %#x", c.Trigger, c.Samples[c.Trigger])
+	}
+}
+
+func TestCapture_overrun(t *testing.T) {
+	f, b := newSampler(t, nil)
+	f.Lag = 0
+	c, err := b.Capture(&bitbang.CaptureOpts{Samples: 2000})
+	if err != bitbang.ErrOverrun || c.Overruns == 0 || len(c.Samples) != 2000 {
+		t.Fatal(err)
+	}
+}
+
+func TestCapture_thenPlay(t *testing.T) {
+	in := byte(0x10)
+	f, b := newSampler(t, func(n int) byte { return in })
+	if _, err := b.Capture(&bitbang.CaptureOpts{Samples: 10}); err != nil {
+		t.Fatal(err)
+	}
+	// All the bytes written were sampled and read back.
+	if n, _ := f.GetQueueStatus(); n != 0 || len(f.Written()) != f.Samples {
+		t.Fatalf("%d pending, %d bytes written, %d sampled", n, len(f.Written()), f.Samples)
+	}
+	in = 0xA0
+	got, err := b.Play([]byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte{0xA0, 0xA0, 0xA0}) {
+		t.Fatalf("stale samples %#x", got)
+	}
+}
+
+func TestCapture_timeout(t *testing.T) {
+	_, b := newSampler(t, nil)
+	_, err := b.Capture(&bitbang.CaptureOpts{
+		Trigger: bitbang.Trigger{Kind: bitbang.TriggerPattern, Mask: 0x01, Value: 0x00},
+		Samples: 1,
+		Timeout: 10 * time.Millisecond,
+	})
+	if err != bitbang.ErrTriggerTimeout {
+		t.Fatal(err)
+	}
+}
+
+func TestCapture_nilOpts(t *testing.T) {
+	// Samples is required.
+	_, b := newSampler(t, nil)
+	if _, err := b.Capture(nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package cbus drives the CBUS bit-bang mode of the FT232R, FT232H and FT-X
+// series, which turns up to 4 CBUS pins into GPIOs while the data pins keep
+// working as a UART.
+//
+// Only the pins configured as I/O mode in the EEPROM can be used. The pins
+// are:
+//
+//	FT232R, FT-X: CBUS0, CBUS1, CBUS2, CBUS3
+//	FT232H:       ACBUS5, ACBUS6, ACBUS8, ACBUS9
+package cbus
+
+import (
+	"fmt"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/eeprom"
+)
+
+// Pin is a CBUS bit-bang pin, 0~3. It is the bit in the values passed to
+// SetBitMode and returned by GetBitMode.
+type Pin uint8
+
+// NumPins is the number of CBUS bit-bang pins.
+const NumPins = 4
+
+// GPIO keeps the shadow value and direction of the CBUS pins.
+//
+// Every change is sent immediately, since SetBitMode sets all the pins at
+// once.
+type GPIO struct {
+	h       d2xx.Handle
+	devType uint32
+	avail   byte
+	value   byte
+	dir     byte
+}
+
+// New reads the EEPROM to find the pins usable as GPIO and enables the CBUS
+// bit-bang mode with all the pins as inputs.
+//
+// It fails if no pin is configured as I/O mode.
+func New(h d2xx.Handle) (*GPIO, error) {
+	d, _, _, e := h.GetDeviceInfo()
+	if e != 0 {
+		return nil, toErr("GetDeviceInfo", e)
+	}
+	io, ok := eeprom.IOMode(d)
+	if !ok {
+		return nil, fmt.Errorf("cbus: device type %d doesn't support CBUS bit-bang", d)
+	}
+	ee, err := eeprom.Read(h, d)
+	if err != nil {
+		return nil, fmt.Errorf("cbus: %w", err)
+	}
+	fns, err := eeprom.CBUS(d, ee.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("cbus: %w", err)
+	}
+	g := &GPIO{h: h, devType: d}
+	for p := Pin(0); p < NumPins; p++ {
+		if fns[g.eepromIndex(p)] == io {
+			g.avail |= 1 << p
+		}
+	}
+	if g.avail == 0 {
+		return nil, fmt.Errorf("cbus: no CBUS pin is configured as I/O mode in the EEPROM")
+	}
+	if err := g.send(0, 0); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Available returns the mask of the pins configured as I/O mode.
+func (g *GPIO) Available() byte {
+	return g.avail
+}
+
+// Name returns the device pin name of a CBUS bit-bang pin.
+func (g *GPIO) Name(p Pin) string {
+	if p >= NumPins {
+		return fmt.Sprintf("Pin(%d)", p)
+	}
+	if g.devType == d2xx.Device232H {
+		return fmt.Sprintf("ACBUS%d", g.eepromIndex(p))
+	}
+	return fmt.Sprintf("CBUS%d", p)
+}
+
+// Out sets the pin as an output at the given level.
+func (g *GPIO) Out(p Pin, level bool) error {
+	if err := g.check(p); err != nil {
+		return err
+	}
+	return g.send(set(g.value, p, level), g.dir|1<<p)
+}
+
+// In sets the pin as an input.
+func (g *GPIO) In(p Pin) error {
+	if err := g.check(p); err != nil {
+		return err
+	}
+	return g.send(g.value, g.dir&^(1<<p))
+}
+
+// Write changes the output level of a pin. The pin must be an output.
+func (g *GPIO) Write(p Pin, level bool) error {
+	if err := g.check(p); err != nil {
+		return err
+	}
+	if g.dir&(1<<p) == 0 {
+		return fmt.Errorf("cbus: %s is an input", g.Name(p))
+	}
+	return g.send(set(g.value, p, level), g.dir)
+}
+
+// Level returns the shadow output level of a pin.
+func (g *GPIO) Level(p Pin) bool {
+	return g.value&(1<<p) != 0
+}
+
+// IsOut returns true if the pin is an output.
+func (g *GPIO) IsOut(p Pin) bool {
+	return g.dir&(1<<p) != 0
+}
+
+// Read returns the level of a pin.
+func (g *GPIO) Read(p Pin) (bool, error) {
+	if err := g.check(p); err != nil {
+		return false, err
+	}
+	v, err := g.ReadAll()
+	return v&(1<<p) != 0, err
+}
+
+// ReadAll returns the level of the 4 pins, as read with GetBitMode.
+func (g *GPIO) ReadAll() (byte, error) {
+	v, e := g.h.GetBitMode()
+	if e != 0 {
+		return 0, toErr("GetBitMode", e)
+	}
+	return v & 0x0F, nil
+}
+
+// Close resets the bit mode. The handle is not closed.
+func (g *GPIO) Close() error {
+	if e := g.h.SetBitMode(0, d2xx.BitModeReset); e != 0 {
+		return toErr("SetBitMode", e)
+	}
+	return nil
+}
+
+//
+
+// eepromIndex returns the index of the pin in the EEPROM CBUS fields, or -1
+// if the pin is invalid.
+func (g *GPIO) eepromIndex(p Pin) int {
+	if p >= NumPins {
+		return -1
+	}
+	if g.devType == d2xx.Device232H {
+		return [NumPins]int{5, 6, 8, 9}[p]
+	}
+	return int(p)
+}
+
+func (g *GPIO) check(p Pin) error {
+	if p >= NumPins {
+		return fmt.Errorf("cbus: invalid pin %d", p)
+	}
+	if g.avail&(1<<p) == 0 {
+		return fmt.Errorf("cbus: %s is not configured as I/O mode in the EEPROM", g.Name(p))
+	}
+	return nil
+}
+
+// send sets the pins; the mask is the direction in the high nibble and the
+// value in the low nibble.
+func (g *GPIO) send(value, dir byte) error {
+	if e := g.h.SetBitMode(dir<<4|value&0x0F, d2xx.BitModeCBUSBitbang); e != 0 {
+		return toErr("SetBitMode", e)
+	}
+	g.value, g.dir = value, dir
+	return nil
+}
+
+func set(v byte, p Pin, level bool) byte {
+	if level {
+		return v | 1<<p
+	}
+	return v &^ (1 << p)
+}
+
+func toErr(op string, e d2xx.Err) error {
+	return fmt.Errorf("cbus: %s: %s", op, e)
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package cbus_test
+
+import (
+	"testing"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/cbus"
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/eeprom"
+)
+
+func TestGPIO(t *testing.T) {
+	f := d2xxtest.NewCBUS(d2xx.Device232R)
+	f.Pins = 0x05
+	g, err := cbus.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.BitMode != d2xx.BitModeCBUSBitbang || f.BitMask != 0 || g.Available() != 0x0F {
+		t.Fatalf("%#x %#x %#x", f.BitMode, f.BitMask, g.Available())
+	}
+	if err := g.Out(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Out(3, false); err != nil {
+		t.Fatal(err)
+	}
+	if f.BitMask != 0xA2 || !g.IsOut(1) || !g.Level(1) || g.IsOut(0) {
+		t.Fatalf("%#x", f.BitMask)
+	}
+	if err := g.Write(3, true); err != nil {
+		t.Fatal(err)
+	}
+	if f.BitMask != 0xAA {
+		t.Fatalf("%#x", f.BitMask)
+	}
+	if v, err := g.ReadAll(); err != nil || v != 0x0F {
+		t.Fatalf("%#x %v", v, err)
+	}
+	if err := g.In(1); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Read(1); err != nil || v {
+		t.Fatalf("%t %v", v, err)
+	}
+	if v, err := g.Read(0); err != nil || !v {
+		t.Fatalf("%t %v", v, err)
+	}
+	if err := g.Write(1, true); err == nil {
+		t.Fatal("input pin")
+	}
+	if err := g.Out(4, true); err == nil {
+		t.Fatal("invalid pin")
+	}
+	if err := g.Close(); err != nil || f.BitMode != d2xx.BitModeReset {
+		t.Fatal(err)
+	}
+}
+
+func TestGPIO_eeprom(t *testing.T) {
+	f := d2xxtest.NewCBUS(d2xx.Device232H)
+	// ACBUS6 is back to its default function, tristate.
+	if err := eeprom.SetCBUS(d2xx.Device232H, f.E.Raw, 6, 0); err != nil {
+		t.Fatal(err)
+	}
+	g, err := cbus.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Available() != 0x0D || g.Name(3) != "ACBUS9" {
+		t.Fatalf("%#x %s", g.Available(), g.Name(3))
+	}
+	if n := g.Name(4); n != "Pin(4)" {
+		t.Fatal(n)
+	}
+	if err := g.Out(4, true); err == nil || err.Error() != "cbus: invalid pin 4" {
+		t.Fatal(err)
+	}
+	if err := g.Out(1, true); err == nil || err.Error() != "cbus: ACBUS6 is not configured as I/O mode in the EEPROM" {
+		t.Fatal(err)
+	}
+	calls := f.Calls
+	if _, err := g.Read(1); err == nil || f.Calls != calls {
+		t.Fatal("unavailable pin")
+	}
+
+	f = d2xxtest.NewCBUS(d2xx.DeviceXSeries)
+	f.E.Raw = make([]byte, eeprom.Size(d2xx.DeviceXSeries))
+	if _, err := cbus.New(f); err == nil {
+		t.Fatal("no pin in I/O mode")
+	}
+	f = d2xxtest.NewCBUS(d2xx.Device2232H)
+	if _, err := cbus.New(f); err == nil {
+		t.Fatal("unsupported device")
+	}
+}
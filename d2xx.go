@@ -6,6 +6,7 @@ package d2xx
 
 import (
 	"strconv"
+	"sync"
 )
 
 // Err is the error type returned by d2xx functions.
@@ -77,6 +78,41 @@ func (e Err) String() string {
 // unknown is a forward declaration of ftdi.DevType.
 const unknown = 3
 
+// Device types as returned by Handle.GetDeviceInfo(). They match FT_DEVICE in
+// ftd2xx.h.
+const (
+	DeviceBM       uint32 = 0
+	DeviceAM       uint32 = 1
+	Device100AX    uint32 = 2
+	DeviceUnknown  uint32 = unknown
+	Device2232C    uint32 = 4
+	Device232R     uint32 = 5
+	Device2232H    uint32 = 6
+	Device4232H    uint32 = 7
+	Device232H     uint32 = 8
+	DeviceXSeries  uint32 = 9
+	Device4222H0   uint32 = 10
+	Device4222H12  uint32 = 11
+	Device4222H3   uint32 = 12
+	Device4222Prog uint32 = 13
+	Device900      uint32 = 14
+	Device930      uint32 = 15
+	DeviceUMFTPD3A uint32 = 16
+)
+
+// Bit modes as accepted by Handle.SetBitMode(). They match FT_BITMODE_* in
+// ftd2xx.h.
+const (
+	BitModeReset        byte = 0x00
+	BitModeAsyncBitbang byte = 0x01
+	BitModeMPSSE        byte = 0x02
+	BitModeSyncBitbang  byte = 0x04
+	BitModeMCUHost      byte = 0x08
+	BitModeFastSerial   byte = 0x10
+	BitModeCBUSBitbang  byte = 0x20
+	BitModeSyncFIFO     byte = 0x40
+)
+
 // handle is a d2xx handle.
 //
 // This is the base type which each OS specific implementation adds methods to.
@@ -115,11 +151,41 @@ type Handle interface {
 
 var _ Handle = handle(0)
 
+// Driver is an implementation of the D2XX entry points.
+//
+// The platform driver is used by default. An alternate driver, like a
+// simulated one for unit tests, can be installed with SetDriver.
+type Driver interface {
+	// Version returns the library's version.
+	Version() (uint8, uint8, uint8)
+	// CreateDeviceInfoList discovers the currently found devices.
+	CreateDeviceInfoList() (int, Err)
+	// Open opens the ith device discovered.
+	Open(i int) (Handle, Err)
+	// Rescan rescans the USB bus for new devices.
+	Rescan() Err
+}
+
+// SetDriver installs the driver used by the package level functions and
+// returns the previous one.
+//
+// nil restores the platform driver.
+func SetDriver(d Driver) Driver {
+	if d == nil {
+		d = native{}
+	}
+	driverMu.Lock()
+	defer driverMu.Unlock()
+	old := driver
+	driver = d
+	return old
+}
+
 // Version returns the library's version.
 //
 // 0, 0, 0 is returned if the library is unavailable.
 func Version() (uint8, uint8, uint8) {
-	return version()
+	return getDriver().Version()
 }
 
 // CreateDeviceInfoList discovers the currently found devices.
@@ -130,7 +196,7 @@ func Version() (uint8, uint8, uint8) {
 // On Windows, Missing is returned if the dynamic library is not found at
 // runtime.
 func CreateDeviceInfoList() (int, Err) {
-	return createDeviceInfoList()
+	return getDriver().CreateDeviceInfoList()
 }
 
 // Open opens the ith device discovered.
@@ -141,10 +207,42 @@ func CreateDeviceInfoList() (int, Err) {
 // On Windows, Missing is returned if the dynamic library is not found at
 // runtime.
 func Open(i int) (Handle, Err) {
-	return open(i)
+	return getDriver().Open(i)
 }
 
 // Rescan rescan the USB bus for new devices.
 func Rescan() Err {
+	return getDriver().Rescan()
+}
+
+//
+
+var (
+	driverMu sync.Mutex
+	driver   Driver = native{}
+)
+
+func getDriver() Driver {
+	driverMu.Lock()
+	defer driverMu.Unlock()
+	return driver
+}
+
+// native is the platform driver.
+type native struct{}
+
+func (native) Version() (uint8, uint8, uint8) {
+	return version()
+}
+
+func (native) CreateDeviceInfoList() (int, Err) {
+	return createDeviceInfoList()
+}
+
+func (native) Open(i int) (Handle, Err) {
+	return open(i)
+}
+
+func (native) Rescan() Err {
 	return rescan()
 }
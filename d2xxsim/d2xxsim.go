@@ -0,0 +1,248 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package d2xxsim serves virtual devices described in a JSON file through the
+// regular d2xx API, so programs can run end-to-end without hardware, like in
+// demos and CI.
+//
+// The simulation is installed when the package is imported, typically with a
+// blank import in the main package, and either the D2XX_SIM environment
+// variable names a profiles file or the program is built with the `d2xxsim`
+// tag. With the tag and no file, no device is found; the platform driver is
+// never used.
+//
+// A profiles file looks like:
+//
+//	{
+//	  "devices": [
+//	    {"type": "232H", "serial": "FT000001", "desc": "Demo", "mode": "loopback"},
+//	    {"type": "232R", "serial": "FT000002", "ua": "68656c6c6f", "mode": "echo"}
+//	  ]
+//	}
+//
+// Each Open returns a new handle initialized from the profile; the
+// configuration, EEPROM and user area written through a handle are not kept
+// after Close.
+package d2xxsim
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/mpsse"
+)
+
+// EnvVar is the environment variable naming the profiles file.
+const EnvVar = "D2XX_SIM"
+
+// Modes describing what is connected to a simulated device.
+const (
+	// ModeNone is a device with nothing connected: writes succeed and reads
+	// return no data.
+	ModeNone = ""
+	// ModeEcho is a device with TX wired to RX: the data written is read
+	// back.
+	ModeEcho = "echo"
+	// ModeLoopback is a MPSSE capable device with TDI/DO wired to TDO/DI. The
+	// data written is interpreted as MPSSE commands and the bits shifted out
+	// are read back.
+	ModeLoopback = "loopback"
+)
+
+// Config is the content of a profiles file.
+type Config struct {
+	Devices []Profile `json:"devices"`
+}
+
+// Profile describes a simulated device.
+type Profile struct {
+	// Type is the device type, like "232H" or "FT2232H".
+	Type string `json:"type"`
+	// Vid and Pid default to the FTDI values for the device type.
+	Vid    uint16 `json:"vid,omitempty"`
+	Pid    uint16 `json:"pid,omitempty"`
+	Serial string `json:"serial,omitempty"`
+	Desc   string `json:"desc,omitempty"`
+	// Manufacturer defaults to "FTDI".
+	Manufacturer string `json:"manufacturer,omitempty"`
+	// EEPROM is the hex encoded raw EEPROM image, excluding the strings.
+	// Whitespace is ignored.
+	EEPROM string `json:"eeprom,omitempty"`
+	// UA is the hex encoded EEPROM user area. Whitespace is ignored.
+	UA string `json:"ua,omitempty"`
+	// Mode is one of ModeNone, ModeEcho or ModeLoopback.
+	Mode string `json:"mode,omitempty"`
+}
+
+// Load reads a profiles file and returns a driver serving its devices.
+func Load(r io.Reader) (*d2xxtest.Driver, error) {
+	var c Config
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&c); err != nil {
+		return nil, fmt.Errorf("d2xxsim: %w", err)
+	}
+	return New(&c)
+}
+
+// LoadFile reads the profiles file at path and returns a driver serving its
+// devices.
+func LoadFile(path string) (*d2xxtest.Driver, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("d2xxsim: %w", err)
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// New returns a driver serving the devices in c.
+func New(c *Config) (*d2xxtest.Driver, error) {
+	devs := make([]*d2xxtest.Device, 0, len(c.Devices))
+	for i := range c.Devices {
+		dev, err := c.Devices[i].device()
+		if err != nil {
+			return nil, fmt.Errorf("d2xxsim: device #%d: %w", i, err)
+		}
+		devs = append(devs, dev)
+	}
+	return d2xxtest.NewDriver(devs...), nil
+}
+
+// Install installs the simulation described by the file named by EnvVar as
+// the d2xx driver. If the variable is empty, a simulation without devices is
+// installed.
+func Install() error {
+	d, err := New(&Config{})
+	if p := os.Getenv(EnvVar); p != "" {
+		d, err = LoadFile(p)
+	}
+	if err != nil {
+		return err
+	}
+	d2xx.SetDriver(d)
+	return nil
+}
+
+//
+
+// forced is set with the d2xxsim build tag.
+var forced = false
+
+func init() {
+	if forced || os.Getenv(EnvVar) != "" {
+		// The user explicitly asked for the simulation, so failing silently
+		// would result in using real hardware.
+		if err := Install(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// types maps the device type names to their type and default product ID.
+var types = map[string]struct {
+	t   uint32
+	pid uint16
+}{
+	"BM":    {d2xx.DeviceBM, 0x6001},
+	"AM":    {d2xx.DeviceAM, 0x6001},
+	"100AX": {d2xx.Device100AX, 0x6001},
+	"2232C": {d2xx.Device2232C, 0x6010},
+	"232R":  {d2xx.Device232R, 0x6001},
+	"2232H": {d2xx.Device2232H, 0x6010},
+	"4232H": {d2xx.Device4232H, 0x6011},
+	"232H":  {d2xx.Device232H, 0x6014},
+	"X":     {d2xx.DeviceXSeries, 0x6015},
+}
+
+// device validates the profile and returns the corresponding virtual device.
+func (p *Profile) device() (*d2xxtest.Device, error) {
+	t, ok := types[strings.TrimPrefix(strings.ToUpper(p.Type), "FT")]
+	if !ok {
+		return nil, fmt.Errorf("unknown device type %q", p.Type)
+	}
+	raw, err := decodeHex(p.EEPROM)
+	if err != nil {
+		return nil, fmt.Errorf("eeprom: %w", err)
+	}
+	ua, err := decodeHex(p.UA)
+	if err != nil {
+		return nil, fmt.Errorf("ua: %w", err)
+	}
+	switch p.Mode {
+	case ModeNone, ModeEcho:
+	case ModeLoopback:
+		switch t.t {
+		case d2xx.Device2232C, d2xx.Device2232H, d2xx.Device4232H, d2xx.Device232H:
+		default:
+			return nil, fmt.Errorf("%s has no MPSSE", p.Type)
+		}
+	default:
+		return nil, fmt.Errorf("unknown mode %q", p.Mode)
+	}
+	dev := &d2xxtest.Device{Type: t.t, Vid: p.Vid, Pid: p.Pid, Serial: p.Serial, Desc: p.Desc}
+	if dev.Vid == 0 {
+		dev.Vid = 0x0403
+	}
+	if dev.Pid == 0 {
+		dev.Pid = t.pid
+	}
+	e := d2xx.EEPROM{Raw: raw, Manufacturer: p.Manufacturer, ManufacturerID: "FT", Desc: p.Desc, Serial: p.Serial}
+	if e.Manufacturer == "" {
+		e.Manufacturer = "FTDI"
+	}
+	if len(e.Manufacturer)+len(e.Desc) > 40 {
+		return nil, errors.New("manufacturer and desc must be at most 40 characters")
+	}
+	mode := p.Mode
+	dev.New = func() d2xx.Handle {
+		var f *d2xxtest.Fake
+		var h d2xx.Handle
+		switch mode {
+		case ModeEcho:
+			x := &echo{}
+			f, h = &x.Fake, x
+		case ModeLoopback:
+			m := d2xxtest.NewMPSSE()
+			m.Tie(mpsse.ADBUS1, mpsse.ADBUS2)
+			f, h = &m.Fake, m
+		default:
+			f = &d2xxtest.Fake{}
+			h = f
+		}
+		f.DevType, f.Vid, f.Pid = dev.Type, dev.Vid, dev.Pid
+		f.E = e
+		f.E.Raw = append([]byte(nil), raw...)
+		f.UA = append([]byte(nil), ua...)
+		return h
+	}
+	return dev, nil
+}
+
+// echo is a device with TX wired to RX.
+type echo struct {
+	d2xxtest.Fake
+}
+
+// Write implements d2xx.Handle.
+func (e *echo) Write(b []byte) (int, d2xx.Err) {
+	n, err := e.Fake.Write(b)
+	if n != 0 {
+		e.Data = append(e.Data, append([]byte(nil), b[:n]...))
+	}
+	return n, err
+}
+
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+var _ d2xx.Handle = &echo{}
@@ -0,0 +1,188 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxsim
+
+import (
+	"bytes"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest/conformance"
+)
+
+const profiles = `{
+  "devices": [
+    {"type": "FT232H", "serial": "FT000001", "desc": "Loop", "mode": "loopback", "eeprom": "08 00 00 00"},
+    {"type": "232r", "serial": "FT000002", "ua": "68656c6c6f", "mode": "echo"},
+    {"type": "X", "vid": 4660, "pid": 22136}
+  ]
+}`
+
+func TestInstall(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "sim.json")
+	if err := os.WriteFile(p, []byte(profiles), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvVar, p)
+	if err := Install(); err != nil {
+		t.Fatal(err)
+	}
+	defer d2xx.SetDriver(nil)
+
+	if n, e := d2xx.CreateDeviceInfoList(); n != 3 || e != 0 {
+		t.Fatal(n, e)
+	}
+	h, e := d2xx.Open(2)
+	if e != 0 {
+		t.Fatal(e)
+	}
+	defer h.Close()
+	if d, v, p, e := h.GetDeviceInfo(); d != d2xx.DeviceXSeries || v != 0x1234 || p != 0x5678 || e != 0 {
+		t.Fatal(d, v, p, e)
+	}
+	if _, e := d2xx.Open(2); e == 0 {
+		t.Fatal("opened twice")
+	}
+}
+
+func TestInstall_none(t *testing.T) {
+	t.Setenv(EnvVar, "")
+	if err := Install(); err != nil {
+		t.Fatal(err)
+	}
+	defer d2xx.SetDriver(nil)
+	if n, e := d2xx.CreateDeviceInfoList(); n != 0 || e != 0 {
+		t.Fatal(n, e)
+	}
+}
+
+func TestInstall_missing(t *testing.T) {
+	t.Setenv(EnvVar, filepath.Join(t.TempDir(), "missing.json"))
+	if err := Install(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLoad_echo(t *testing.T) {
+	h := open(t, 1)
+	if d, v, p, e := h.GetDeviceInfo(); d != d2xx.Device232R || v != 0x0403 || p != 0x6001 || e != 0 {
+		t.Fatal(d, v, p, e)
+	}
+	ua := make([]byte, 5)
+	if e := h.EEUARead(ua); e != 0 || string(ua) != "hello" {
+		t.Fatal(string(ua), e)
+	}
+	if n, e := h.Write([]byte("ping")); n != 4 || e != 0 {
+		t.Fatal(n, e)
+	}
+	if n, e := h.GetQueueStatus(); n != 4 || e != 0 {
+		t.Fatal(n, e)
+	}
+	b := make([]byte, 8)
+	if n, e := h.Read(b); n != 4 || e != 0 || string(b[:n]) != "ping" {
+		t.Fatal(string(b[:n]), e)
+	}
+}
+
+func TestLoad_loopback(t *testing.T) {
+	h := open(t, 0)
+	var e d2xx.EEPROM
+	if err := h.EEPROMRead(d2xx.Device232H, &e); err != 0 {
+		t.Fatal(err)
+	}
+	if e.Serial != "FT000001" || e.Desc != "Loop" || e.Manufacturer != "FTDI" || !bytes.Equal(e.Raw, []byte{8, 0, 0, 0}) {
+		t.Fatalf("%+v", e)
+	}
+	// TCK, TDI and TMS as outputs, then clock 2 bytes out and in, MSB first.
+	cmd := []byte{0x80, 0x08, 0x0B, 0x31, 0x01, 0x00, 0xA5, 0x3C, 0x87}
+	if n, err := h.Write(cmd); n != len(cmd) || err != 0 {
+		t.Fatal(n, err)
+	}
+	b := make([]byte, 2)
+	if n, err := h.Read(b); n != 2 || err != 0 || !bytes.Equal(b, []byte{0xA5, 0x3C}) {
+		t.Fatalf("%d %#x %s", n, b, err)
+	}
+}
+
+func TestLoad_conformance(t *testing.T) {
+	d, err := Load(strings.NewReader(profiles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, dev := range d.Devices() {
+		dev := dev
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			conformance.Run(t, func(t *testing.T) d2xx.Handle {
+				return dev.New()
+			})
+		})
+	}
+}
+
+func TestDeps(t *testing.T) {
+	// The package is linked in programs; it must not pull the testing package.
+	seen := map[string]bool{}
+	var walk func(path, dir string)
+	walk = func(path, dir string) {
+		if seen[path] || path == "C" {
+			return
+		}
+		seen[path] = true
+		if path == "testing" {
+			t.Fatalf("%s depends on testing", dir)
+		}
+		p, err := build.Import(path, dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range p.Imports {
+			walk(i, p.Dir)
+		}
+	}
+	walk("periph.io/x/d2xx/d2xxsim", ".")
+}
+
+func TestLoad_errors(t *testing.T) {
+	data := []string{
+		`{"devices": [{"type": "FT9000"}]}`,
+		`{"devices": [{"type": "232H", "eeprom": "0g"}]}`,
+		`{"devices": [{"type": "232H", "ua": "123"}]}`,
+		`{"devices": [{"type": "232R", "mode": "loopback"}]}`,
+		`{"devices": [{"type": "232H", "mode": "magic"}]}`,
+		`{"devices": [{"type": "232H", "desc": "` + strings.Repeat("x", 40) + `"}]}`,
+		`{"devices": [{"type": "232H", "typo": 1}]}`,
+		`{"devices": `,
+	}
+	for i, line := range data {
+		if _, err := Load(strings.NewReader(line)); err == nil || !strings.HasPrefix(err.Error(), "d2xxsim: ") {
+			t.Errorf("#%d: unexpected error %v", i, err)
+		}
+	}
+}
+
+//
+
+func open(t *testing.T, i int) d2xx.Handle {
+	d, err := Load(strings.NewReader(profiles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := d2xx.SetDriver(d)
+	t.Cleanup(func() { d2xx.SetDriver(old) })
+	if n, e := d2xx.CreateDeviceInfoList(); n != 3 || e != 0 {
+		t.Fatal(n, e)
+	}
+	h, e := d2xx.Open(i)
+	if e != 0 {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
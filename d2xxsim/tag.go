@@ -0,0 +1,12 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build d2xxsim
+// +build d2xxsim
+
+package d2xxsim
+
+func init() {
+	forced = true
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"periph.io/x/d2xx"
+)
+
+// BitBang is a fake d2xx.Handle that simulates the 8 data pins in
+// asynchronous and synchronous bit-bang modes.
+type BitBang struct {
+	Fake
+	// Out is the last value written. Only the bits set in BitMask are
+	// driven.
+	Out byte
+	// Input, if set, returns the level of the input pins for the sample n,
+	// counting from the bit mode change. Inputs are pulled up otherwise.
+	Input func(n int) byte
+	// Samples is the number of pin samples taken.
+	Samples int
+	// Lag is the number of bytes written that are kept in the device FIFO
+	// instead of being clocked out immediately. It simulates a host that keeps
+	// ahead of the device; when 0, the device is always waiting for data. A
+	// Read waiting for more samples than available clocks them out.
+	Lag int
+
+	fifo  []byte
+	reply []byte
+}
+
+// NewBitBang returns a simulated FT232R.
+func NewBitBang() *BitBang {
+	return &BitBang{Fake: Fake{DevType: d2xx.Device232R, Vid: 0x0403, Pid: 0x6001}}
+}
+
+// pins returns the current level of the pins and advances the sample counter.
+func (b *BitBang) pins() byte {
+	in := byte(0xFF)
+	if b.Input != nil {
+		in = b.Input(b.Samples)
+	}
+	b.Samples++
+	return b.Out&b.BitMask | in&^b.BitMask
+}
+
+// ResetDevice implements d2xx.Handle.
+func (b *BitBang) ResetDevice() d2xx.Err {
+	if e := b.Fake.ResetDevice(); e != 0 {
+		return e
+	}
+	b.reply = nil
+	return 0
+}
+
+// SetBitMode implements d2xx.Handle.
+func (b *BitBang) SetBitMode(mask, mode byte) d2xx.Err {
+	if b.Closed {
+		return invalidHandle
+	}
+	b.BitMode = mode
+	b.BitMask = mask
+	b.Samples = 0
+	b.fifo = nil
+	b.reply = nil
+	return 0
+}
+
+// GetBitMode implements d2xx.Handle.
+//
+// It returns the instantaneous level of the pins.
+func (b *BitBang) GetBitMode() (byte, d2xx.Err) {
+	if b.Closed {
+		return 0, invalidHandle
+	}
+	return b.pins(), 0
+}
+
+// GetQueueStatus implements d2xx.Handle.
+func (b *BitBang) GetQueueStatus() (uint32, d2xx.Err) {
+	if b.Closed {
+		return 0, invalidHandle
+	}
+	return uint32(len(b.reply)), 0
+}
+
+// Read implements d2xx.Handle.
+func (b *BitBang) Read(p []byte) (int, d2xx.Err) {
+	if b.Closed {
+		return 0, invalidHandle
+	}
+	// While the host waits, the device clocks out the bytes lagging in its
+	// FIFO.
+	for b.BitMode == d2xx.BitModeSyncBitbang && len(b.reply) < len(p) && len(b.fifo) != 0 {
+		b.clock()
+	}
+	n := copy(p, b.reply)
+	b.reply = b.reply[n:]
+	return n, 0
+}
+
+// Write implements d2xx.Handle.
+//
+// In synchronous mode, the pins are sampled before each byte is applied.
+func (b *BitBang) Write(p []byte) (int, d2xx.Err) {
+	if _, e := b.Fake.Write(p); e != 0 {
+		return 0, e
+	}
+	b.fifo = append(b.fifo, p...)
+	for len(b.fifo) > b.Lag {
+		b.clock()
+	}
+	return len(p), 0
+}
+
+//
+
+// clock applies the next byte in the device FIFO.
+func (b *BitBang) clock() {
+	if b.BitMode == d2xx.BitModeSyncBitbang {
+		b.reply = append(b.reply, b.pins())
+	}
+	b.Out = b.fifo[0]
+	b.fifo = b.fifo[1:]
+}
+
+var _ d2xx.Handle = &BitBang{}
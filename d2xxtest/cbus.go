@@ -0,0 +1,54 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/eeprom"
+)
+
+// CBUS is a fake d2xx.Handle that simulates the 4 pins of the CBUS bit-bang
+// mode.
+//
+// The pins configured as inputs read as Pins.
+type CBUS struct {
+	Fake
+	// Calls is the number of SetBitMode calls.
+	Calls int
+}
+
+// NewCBUS returns a simulated device with all the CBUS bit-bang pins
+// configured as I/O mode in the EEPROM.
+//
+// devType must be d2xx.Device232R, d2xx.Device232H or d2xx.DeviceXSeries.
+func NewCBUS(devType uint32) *CBUS {
+	c := &CBUS{Fake: Fake{DevType: devType, Vid: 0x0403, Pins: 0x0F}}
+	switch devType {
+	case d2xx.Device232H:
+		c.Pid = 0x6014
+	case d2xx.DeviceXSeries:
+		c.Pid = 0x6015
+	default:
+		c.Pid = 0x6001
+	}
+	c.E.Raw = make([]byte, eeprom.Size(devType))
+	io, _ := eeprom.IOMode(devType)
+	pins := []int{0, 1, 2, 3}
+	if devType == d2xx.Device232H {
+		pins = []int{5, 6, 8, 9}
+	}
+	for _, p := range pins {
+		_ = eeprom.SetCBUS(devType, c.E.Raw, p, io)
+	}
+	return c
+}
+
+// SetBitMode implements d2xx.Handle.
+func (c *CBUS) SetBitMode(mask, mode byte) d2xx.Err {
+	c.Calls++
+	return c.Fake.SetBitMode(mask, mode)
+}
+
+var _ d2xx.Handle = &CBUS{}
@@ -0,0 +1,258 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package conformance checks that d2xx.Handle implementations, like the fakes
+// in d2xxtest or a simulation, behave like the handles returned by the D2XX
+// driver.
+package conformance
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/mpsse"
+)
+
+// Factory returns a newly opened handle to a device with nothing connected
+// to its pins.
+type Factory func(t *testing.T) d2xx.Handle
+
+// Run checks that handles returned by factory behave like the ones returned by
+// the D2XX driver.
+//
+// Each check runs as a subtest with a new handle. The MPSSE checks are
+// skipped for device types without a MPSSE. Simulations that intentionally
+// don't model a feature can skip checks by name.
+func Run(t *testing.T, factory Factory, skip ...string) {
+	for _, c := range conformance {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			for _, s := range skip {
+				if s == c.name {
+					t.Skip("skipped")
+				}
+			}
+			h := factory(t)
+			closed := false
+			t.Cleanup(func() {
+				if !closed {
+					h.Close()
+				}
+			})
+			c.f(t, h, &closed)
+		})
+	}
+}
+
+//
+
+// FT_INVALID_HANDLE and FT_INVALID_PARAMETER.
+const (
+	invalidHandle    d2xx.Err = 1
+	invalidParameter d2xx.Err = 6
+)
+
+var conformance = []struct {
+	name string
+	f    func(t *testing.T, h d2xx.Handle, closed *bool)
+}{
+	{"GetDeviceInfo", conformDeviceInfo},
+	{"Configure", conformConfigure},
+	{"ReadEmpty", conformReadEmpty},
+	{"Write", conformWrite},
+	{"EEUA", conformEEUA},
+	{"MPSSELoopback", conformLoopback},
+	{"MPSSEBadCommand", conformBadCommand},
+	{"Closed", conformClosed},
+}
+
+func conformDeviceInfo(t *testing.T, h d2xx.Handle, closed *bool) {
+	if _, _, _, e := h.GetDeviceInfo(); e != 0 {
+		t.Fatalf("GetDeviceInfo() = %d", e)
+	}
+}
+
+func conformConfigure(t *testing.T, h d2xx.Handle, closed *bool) {
+	for _, c := range []struct {
+		name string
+		e    d2xx.Err
+	}{
+		{"ResetDevice", h.ResetDevice()},
+		{"SetUSBParameters", h.SetUSBParameters(65536, 65535)},
+		{"SetChars", h.SetChars(0, false, 0, false)},
+		{"SetTimeouts", h.SetTimeouts(100, 100)},
+		{"SetLatencyTimer", h.SetLatencyTimer(2)},
+		{"SetBaudRate", h.SetBaudRate(115200)},
+		{"SetBitMode", h.SetBitMode(0, 0)},
+	} {
+		if c.e != 0 {
+			t.Errorf("%s() = %d", c.name, c.e)
+		}
+	}
+	if _, e := h.GetBitMode(); e != 0 {
+		t.Errorf("GetBitMode() = %d", e)
+	}
+}
+
+// conformReadEmpty checks that a read timing out is not an error.
+func conformReadEmpty(t *testing.T, h d2xx.Handle, closed *bool) {
+	if e := h.SetTimeouts(10, 10); e != 0 {
+		t.Fatalf("SetTimeouts() = %d", e)
+	}
+	if n, e := h.GetQueueStatus(); n != 0 || e != 0 {
+		t.Fatalf("GetQueueStatus() = %d, %d; want 0, 0", n, e)
+	}
+	var b [16]byte
+	if n, e := h.Read(b[:]); n != 0 || e != 0 {
+		t.Fatalf("Read() = %d, %d; want 0, 0", n, e)
+	}
+	if n, e := h.Read(nil); n != 0 || e != 0 {
+		t.Fatalf("Read(nil) = %d, %d; want 0, 0", n, e)
+	}
+}
+
+// conformWrite checks that writes succeed. With nothing connected, a device
+// may not be able to send the data and the write times out, which is not an
+// error.
+func conformWrite(t *testing.T, h d2xx.Handle, closed *bool) {
+	if e := h.SetTimeouts(100, 100); e != 0 {
+		t.Fatalf("SetTimeouts() = %d", e)
+	}
+	if n, e := h.Write([]byte("hello")); n < 0 || n > 5 || e != 0 {
+		t.Fatalf("Write() = %d, %d; want up to 5, 0", n, e)
+	}
+	if n, e := h.Write(nil); n != 0 || e != 0 {
+		t.Fatalf("Write(nil) = %d, %d; want 0, 0", n, e)
+	}
+}
+
+// conformEEUA checks that reading more than the user area size fails.
+func conformEEUA(t *testing.T, h d2xx.Handle, closed *bool) {
+	size, e := h.EEUASize()
+	if e != 0 {
+		t.Fatalf("EEUASize() = %d", e)
+	}
+	if size != 0 {
+		if e := h.EEUARead(make([]byte, size)); e != 0 {
+			t.Fatalf("EEUARead(%d bytes) = %d", size, e)
+		}
+	}
+	if e := h.EEUARead(make([]byte, size+1)); e != invalidParameter {
+		t.Fatalf("EEUARead(%d bytes) = %d; want FT_INVALID_PARAMETER", size+1, e)
+	}
+}
+
+func conformLoopback(t *testing.T, h d2xx.Handle, closed *bool) {
+	initMPSSE(t, h)
+	cmd := []byte{mpsse.LoopbackOn, mpsse.DataOut | mpsse.DataIn | mpsse.WriteFalling, 0x01, 0x00, 0xA5, 0x5A, mpsse.SendImmediate}
+	if n, e := h.Write(cmd); n != len(cmd) || e != 0 {
+		t.Fatalf("Write() = %d, %d", n, e)
+	}
+	waitQueue(t, h, 2)
+	// More than available; the read returns what was received on timeout.
+	var b [4]byte
+	if n, e := h.Read(b[:]); n != 2 || e != 0 || !bytes.Equal(b[:n], []byte{0xA5, 0x5A}) {
+		t.Fatalf("Read() = %#x, %d; want 0xa55a, 0", b[:n], e)
+	}
+	if n, e := h.GetQueueStatus(); n != 0 || e != 0 {
+		t.Fatalf("GetQueueStatus() = %d, %d; want 0, 0", n, e)
+	}
+}
+
+func conformBadCommand(t *testing.T, h d2xx.Handle, closed *bool) {
+	initMPSSE(t, h)
+	if n, e := h.Write([]byte{0xAA, mpsse.SendImmediate}); n != 2 || e != 0 {
+		t.Fatalf("Write() = %d, %d", n, e)
+	}
+	waitQueue(t, h, 2)
+	var b [2]byte
+	if n, e := h.Read(b[:]); n != 2 || e != 0 || b != [2]byte{mpsse.BadCommand, 0xAA} {
+		t.Fatalf("Read() = %#x, %d; want 0xfaaa, 0", b[:n], e)
+	}
+}
+
+// conformClosed checks that all the calls fail after Close.
+func conformClosed(t *testing.T, h d2xx.Handle, closed *bool) {
+	if e := h.Close(); e != 0 {
+		t.Fatalf("Close() = %d", e)
+	}
+	*closed = true
+	var b [1]byte
+	_, _, _, e1 := h.GetDeviceInfo()
+	_, e2 := h.GetQueueStatus()
+	_, e3 := h.Read(b[:])
+	_, e4 := h.Write(b[:])
+	_, e5 := h.GetBitMode()
+	_, e6 := h.EEUASize()
+	for _, c := range []struct {
+		name string
+		e    d2xx.Err
+	}{
+		{"Close", h.Close()},
+		{"ResetDevice", h.ResetDevice()},
+		{"GetDeviceInfo", e1},
+		{"GetQueueStatus", e2},
+		{"Read", e3},
+		{"Write", e4},
+		{"GetBitMode", e5},
+		{"EEUASize", e6},
+		{"SetBitMode", h.SetBitMode(0, 0)},
+		{"SetBaudRate", h.SetBaudRate(9600)},
+		{"SetTimeouts", h.SetTimeouts(1, 1)},
+		{"SetLatencyTimer", h.SetLatencyTimer(2)},
+		{"SetUSBParameters", h.SetUSBParameters(4096, 4096)},
+		{"SetChars", h.SetChars(0, false, 0, false)},
+		{"SetFlowControl", h.SetFlowControl()},
+	} {
+		if c.e != invalidHandle {
+			t.Errorf("%s() after Close = %d; want FT_INVALID_HANDLE", c.name, c.e)
+		}
+	}
+}
+
+// initMPSSE switches the device to MPSSE mode, or skips the test.
+func initMPSSE(t *testing.T, h d2xx.Handle) {
+	d, _, _, e := h.GetDeviceInfo()
+	if e != 0 {
+		t.Fatalf("GetDeviceInfo() = %d", e)
+	}
+	switch d {
+	case d2xx.Device2232C, d2xx.Device2232H, d2xx.Device4232H, d2xx.Device232H:
+	default:
+		t.Skipf("device type %d has no MPSSE", d)
+	}
+	for _, c := range []struct {
+		name string
+		e    d2xx.Err
+	}{
+		{"ResetDevice", h.ResetDevice()},
+		{"SetTimeouts", h.SetTimeouts(100, 100)},
+		{"SetLatencyTimer", h.SetLatencyTimer(2)},
+		{"SetBitMode", h.SetBitMode(0, 0)},
+		{"SetBitMode", h.SetBitMode(0, d2xx.BitModeMPSSE)},
+	} {
+		if c.e != 0 {
+			t.Fatalf("%s() = %d", c.name, c.e)
+		}
+	}
+}
+
+// waitQueue waits for n bytes to be received.
+func waitQueue(t *testing.T, h d2xx.Handle, n uint32) {
+	for start := time.Now(); ; {
+		q, e := h.GetQueueStatus()
+		if e != 0 {
+			t.Fatalf("GetQueueStatus() = %d", e)
+		}
+		if q >= n {
+			return
+		}
+		if time.Since(start) > time.Second {
+			t.Fatalf("GetQueueStatus() = %d; want %d", q, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package conformance_test
+
+import (
+	"io"
+	"testing"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/d2xxtest/conformance"
+	"periph.io/x/d2xx/fastser"
+)
+
+func TestConformance(t *testing.T) {
+	// These simulate a data source in a specific mode.
+	noMPSSE := []string{"MPSSELoopback", "MPSSEBadCommand"}
+	data := []struct {
+		name string
+		f    conformance.Factory
+		skip []string
+	}{
+		{"Fake", func(t *testing.T) d2xx.Handle { return &d2xxtest.Fake{} }, nil},
+		{"Log", func(t *testing.T) d2xx.Handle { return &d2xxtest.Log{H: &d2xxtest.Fake{}, Printf: t.Logf} }, nil},
+		{"Faulty", func(t *testing.T) d2xx.Handle { return &d2xxtest.Faulty{H: d2xxtest.NewMPSSE()} }, nil},
+		{"Timed", func(t *testing.T) d2xx.Handle { return &d2xxtest.Timed{H: d2xxtest.NewMPSSE()} }, nil},
+		{"Recorder", func(t *testing.T) d2xx.Handle { return &d2xxtest.Recorder{H: d2xxtest.NewMPSSE(), W: io.Discard} }, nil},
+		{"MPSSE", func(t *testing.T) d2xx.Handle { return d2xxtest.NewMPSSE() }, nil},
+		{"JTAGChain", func(t *testing.T) d2xx.Handle { return d2xxtest.NewJTAGChain() }, nil},
+		{"SWDTarget", func(t *testing.T) d2xx.Handle { return d2xxtest.NewSWDTarget(0x2BA01477) }, nil},
+		{"MCUBus", func(t *testing.T) d2xx.Handle { return d2xxtest.NewMCUBus() }, nil},
+		{"BitBang", func(t *testing.T) d2xx.Handle { return d2xxtest.NewBitBang() }, nil},
+		{"CBUS", func(t *testing.T) d2xx.Handle { return d2xxtest.NewCBUS(d2xx.Device232R) }, nil},
+		{"FIFO", func(t *testing.T) d2xx.Handle { return d2xxtest.NewFIFO() }, noMPSSE},
+		{"FastSerial", func(t *testing.T) d2xx.Handle { return d2xxtest.NewFastSerial(fastser.ChannelA) }, noMPSSE},
+		{"FT1248", func(t *testing.T) d2xx.Handle { return d2xxtest.NewFT1248(d2xx.Device232H) }, noMPSSE},
+		{"NullModem", func(t *testing.T) d2xx.Handle {
+			a, _ := d2xxtest.NewNullModem(nil)
+			return a
+		}, nil},
+		{"Driver", func(t *testing.T) d2xx.Handle {
+			d := d2xxtest.NewDriver(&d2xxtest.Device{New: func() d2xx.Handle { return d2xxtest.NewMPSSE() }})
+			d.CreateDeviceInfoList()
+			h, e := d.Open(0)
+			if e != 0 {
+				t.Fatal(e)
+			}
+			return h
+		}, nil},
+	}
+	for _, line := range data {
+		t.Run(line.name, func(t *testing.T) {
+			conformance.Run(t, line.f, line.skip...)
+		})
+	}
+}
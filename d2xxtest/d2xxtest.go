@@ -2,7 +2,11 @@
 // Use of this source code is governed under the Apache License, Version 2.0
 // that can be found in the LICENSE file.
 
-// Package d2xxtest defines logging wrapper and fake for unit testing.
+// Package d2xxtest defines logging wrapper, fakes and simulated devices for
+// unit testing.
+//
+// It doesn't depend on the testing package, so the fakes can also back
+// programs, like the d2xxsim simulation.
 package d2xxtest
 
 import (
@@ -12,65 +16,156 @@ import (
 )
 
 // Fake implements a fake d2xx.Handle.
+//
+// It records the configuration set through the handle and the data written,
+// so tests can assert on them. Reads are served from Data.
+//
+// After Close, all calls return FT_INVALID_HANDLE.
 type Fake struct {
 	DevType uint32
 	Vid     uint16
 	Pid     uint16
-	Data    [][]byte
-	UA      []byte
-	E       d2xx.EEPROM
+	// Data is the data returned by Read, one slice per USB transfer.
+	Data [][]byte
+	UA   []byte
+	E    d2xx.EEPROM
+	// EE is the word addressable EEPROM modified by WriteEE and EraseEE.
+	EE [256]uint16
+
+	// Writes is a copy of each buffer passed to Write, in order.
+	Writes [][]byte
+	// BitMask and BitMode are the last values passed to SetBitMode.
+	BitMask byte
+	BitMode byte
+	// Pins is the level of the input pins, returned by GetBitMode.
+	Pins byte
+	// Baud is the last value passed to SetBaudRate.
+	Baud uint32
+	// Latency is the last value passed to SetLatencyTimer.
+	Latency uint8
+	// ReadTimeout and WriteTimeout are the last values passed to SetTimeouts.
+	ReadTimeout  int
+	WriteTimeout int
+	// EventChar, EventEnabled, ErrorChar and ErrorEnabled are the last values
+	// passed to SetChars.
+	EventChar    byte
+	EventEnabled bool
+	ErrorChar    byte
+	ErrorEnabled bool
+	// InSize and OutSize are the last values passed to SetUSBParameters.
+	InSize  int
+	OutSize int
+	// FlowControl is set by SetFlowControl.
+	FlowControl bool
+	// Resets counts the ResetDevice calls.
+	Resets int
+	// Closed is set by Close.
+	Closed bool
+}
+
+// Written returns all the data written, concatenated.
+func (f *Fake) Written() []byte {
+	var out []byte
+	for _, w := range f.Writes {
+		out = append(out, w...)
+	}
+	return out
 }
 
 // Close implements d2xx.Handle.
 func (f *Fake) Close() d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	f.Closed = true
 	return 0
 }
 
 // ResetDevice implements d2xx.Handle.
 func (f *Fake) ResetDevice() d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	f.Resets++
 	return 0
 }
 
 // GetDeviceInfo implements d2xx.Handle.
 func (f *Fake) GetDeviceInfo() (uint32, uint16, uint16, d2xx.Err) {
+	if f.Closed {
+		return 0, 0, 0, invalidHandle
+	}
 	return f.DevType, f.Vid, f.Pid, 0
 }
 
 // EEPROMRead implements d2xx.Handle.
 func (f *Fake) EEPROMRead(devType uint32, e *d2xx.EEPROM) d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
 	*e = f.E
 	return 0
 }
 
 // EEPROMProgram implements d2xx.Handle.
 func (f *Fake) EEPROMProgram(e *d2xx.EEPROM) d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
 	f.E = *e
 	return 0
 }
 
 // EraseEE implements d2xx.Handle.
+//
+// It sets all the EE words to 0xFFFF, the erased state.
 func (f *Fake) EraseEE() d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	for i := range f.EE {
+		f.EE[i] = 0xFFFF
+	}
 	return 0
 }
 
 // WriteEE implements d2xx.Handle.
 func (f *Fake) WriteEE(offset uint8, value uint16) d2xx.Err {
-	return 1
+	if f.Closed {
+		return invalidHandle
+	}
+	f.EE[offset] = value
+	return 0
 }
 
 // EEUASize implements d2xx.Handle.
 func (f *Fake) EEUASize() (int, d2xx.Err) {
+	if f.Closed {
+		return 0, invalidHandle
+	}
 	return len(f.UA), 0
 }
 
 // EEUARead implements d2xx.Handle.
+//
+// Like the driver, it fails with FT_INVALID_PARAMETER when reading more than
+// the user area.
 func (f *Fake) EEUARead(UA []byte) d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	if len(UA) > len(f.UA) {
+		return invalidParameter
+	}
 	copy(UA, f.UA)
 	return 0
 }
 
 // EEUAWrite implements d2xx.Handle.
 func (f *Fake) EEUAWrite(ua []byte) d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
 	f.UA = make([]byte, len(ua))
 	copy(f.UA, ua)
 	return 0
@@ -78,36 +173,63 @@ func (f *Fake) EEUAWrite(ua []byte) d2xx.Err {
 
 // SetChars implements d2xx.Handle.
 func (f *Fake) SetChars(eventChar byte, eventEn bool, errorChar byte, errorEn bool) d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	f.EventChar, f.EventEnabled, f.ErrorChar, f.ErrorEnabled = eventChar, eventEn, errorChar, errorEn
 	return 0
 }
 
 // SetUSBParameters implements d2xx.Handle.
 func (f *Fake) SetUSBParameters(in, out int) d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	f.InSize, f.OutSize = in, out
 	return 0
 }
 
 // SetFlowControl implements d2xx.Handle.
 func (f *Fake) SetFlowControl() d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	f.FlowControl = true
 	return 0
 }
 
 // SetTimeouts implements d2xx.Handle.
 func (f *Fake) SetTimeouts(readMS, writeMS int) d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	f.ReadTimeout, f.WriteTimeout = readMS, writeMS
 	return 0
 }
 
 // SetLatencyTimer implements d2xx.Handle.
 func (f *Fake) SetLatencyTimer(delayMS uint8) d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	f.Latency = delayMS
 	return 0
 }
 
 // SetBaudRate implements d2xx.Handle.
 func (f *Fake) SetBaudRate(hz uint32) d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	f.Baud = hz
 	return 0
 }
 
 // GetQueueStatus implements d2xx.Handle.
 func (f *Fake) GetQueueStatus() (uint32, d2xx.Err) {
+	if f.Closed {
+		return 0, invalidHandle
+	}
 	if len(f.Data) == 0 {
 		return 0, 0
 	}
@@ -121,6 +243,9 @@ func (f *Fake) GetQueueStatus() (uint32, d2xx.Err) {
 
 // Read implements d2xx.Handle.
 func (f *Fake) Read(b []byte) (int, d2xx.Err) {
+	if f.Closed {
+		return 0, invalidHandle
+	}
 	if len(f.Data) == 0 {
 		return 0, 0
 	}
@@ -142,16 +267,44 @@ func (f *Fake) Read(b []byte) (int, d2xx.Err) {
 
 // Write implements d2xx.Handle.
 func (f *Fake) Write(b []byte) (int, d2xx.Err) {
-	return 0, 0
+	if f.Closed {
+		return 0, invalidHandle
+	}
+	f.Writes = append(f.Writes, append([]byte(nil), b...))
+	return len(b), 0
 }
 
 // GetBitMode implements d2xx.Handle.
+//
+// It returns the level of the pins. In the bit-bang modes, the output pins
+// are driven with the last byte written; the other pins read as Pins.
 func (f *Fake) GetBitMode() (byte, d2xx.Err) {
-	return 0, 0
+	if f.Closed {
+		return 0, invalidHandle
+	}
+	switch f.BitMode {
+	case d2xx.BitModeAsyncBitbang, d2xx.BitModeSyncBitbang:
+		var out byte
+		if l := len(f.Writes); l != 0 {
+			if w := f.Writes[l-1]; len(w) != 0 {
+				out = w[len(w)-1]
+			}
+		}
+		return out&f.BitMask | f.Pins&^f.BitMask, 0
+	case d2xx.BitModeCBUSBitbang:
+		dir := f.BitMask >> 4
+		return (f.BitMask&dir | f.Pins&^dir) & 0x0F, 0
+	default:
+		return f.Pins, 0
+	}
 }
 
 // SetBitMode implements d2xx.Handle.
 func (f *Fake) SetBitMode(mask, mode byte) d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	f.BitMask, f.BitMode = mask, mode
 	return 0
 }
 
@@ -307,6 +460,9 @@ func (l *Log) logDefer(fmt string) func(args ...interface{}) {
 
 //
 
+// invalidHandle is FT_INVALID_HANDLE.
+const invalidHandle d2xx.Err = 1
+
 // log10 is a cheap way to find the most significant digit
 func log10(i int64) uint {
 	switch {
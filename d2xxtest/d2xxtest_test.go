@@ -0,0 +1,85 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"bytes"
+	"testing"
+
+	"periph.io/x/d2xx"
+)
+
+func TestFake(t *testing.T) {
+	f := &Fake{DevType: d2xx.Device232R, Data: [][]byte{{1, 2, 3}}}
+	for _, e := range []d2xx.Err{
+		f.SetBaudRate(115200),
+		f.SetLatencyTimer(2),
+		f.SetTimeouts(100, 200),
+		f.SetChars('\n', true, 0, false),
+		f.SetUSBParameters(4096, 512),
+		f.SetFlowControl(),
+		f.ResetDevice(),
+		f.SetBitMode(0xF0, d2xx.BitModeAsyncBitbang),
+	} {
+		if e != 0 {
+			t.Fatal(e)
+		}
+	}
+	if f.Baud != 115200 || f.Latency != 2 || f.ReadTimeout != 100 || f.WriteTimeout != 200 {
+		t.Fatalf("%+v", f)
+	}
+	if f.EventChar != '\n' || !f.EventEnabled || f.ErrorEnabled || f.InSize != 4096 || f.OutSize != 512 || !f.FlowControl || f.Resets != 1 {
+		t.Fatalf("%+v", f)
+	}
+
+	buf := []byte{0xAA, 0x55}
+	if n, e := f.Write(buf); n != 2 || e != 0 {
+		t.Fatal(n, e)
+	}
+	buf[1] = 0x5A
+	if n, e := f.Write(buf[1:]); n != 1 || e != 0 {
+		t.Fatal(n, e)
+	}
+	if len(f.Writes) != 2 || !bytes.Equal(f.Writes[0], []byte{0xAA, 0x55}) || !bytes.Equal(f.Written(), []byte{0xAA, 0x55, 0x5A}) {
+		t.Fatalf("%#x", f.Writes)
+	}
+	// The outputs are driven with the last byte written.
+	f.Pins = 0x03
+	if v, e := f.GetBitMode(); v != 0x53 || e != 0 {
+		t.Fatalf("%#x", v)
+	}
+	if e := f.SetBitMode(0xA5, d2xx.BitModeCBUSBitbang); e != 0 {
+		t.Fatal(e)
+	}
+	if v, _ := f.GetBitMode(); v != 0x01 {
+		t.Fatalf("%#x", v)
+	}
+
+	if e := f.WriteEE(0x10, 0x1234); e != 0 || f.EE[0x10] != 0x1234 {
+		t.Fatal(e)
+	}
+	if e := f.EraseEE(); e != 0 || f.EE[0x10] != 0xFFFF {
+		t.Fatal(e)
+	}
+
+	if e := f.Close(); e != 0 {
+		t.Fatal(e)
+	}
+	if e := f.Close(); e != 1 {
+		t.Fatal(e)
+	}
+	if _, e := f.Read(buf); e.String() != "invalid handle" {
+		t.Fatal(e)
+	}
+	if _, e := f.Write(buf); e != 1 {
+		t.Fatal(e)
+	}
+	if _, _, _, e := f.GetDeviceInfo(); e != 1 {
+		t.Fatal(e)
+	}
+	if e := f.SetBaudRate(9600); e != 1 || f.Baud != 115200 {
+		t.Fatal(e)
+	}
+}
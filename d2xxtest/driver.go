@@ -0,0 +1,187 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"sync"
+
+	"periph.io/x/d2xx"
+)
+
+// Device is a virtual device presented by a Driver.
+type Device struct {
+	Type   uint32
+	Vid    uint16
+	Pid    uint16
+	Serial string
+	Desc   string
+	// New returns the handle of the device on each Open. If nil, a Fake with
+	// the device information and an EEPROM holding Serial and Desc is
+	// returned.
+	New func() d2xx.Handle
+
+	// Opened is set while the device is open. It is protected by the driver
+	// lock; read it with Driver.IsOpen when the driver is used concurrently.
+	Opened bool
+}
+
+// Driver is a simulated d2xx.Driver presenting virtual devices, to be
+// installed with d2xx.SetDriver.
+//
+// Like the D2XX library, CreateDeviceInfoList takes a snapshot of the devices
+// plugged and Open indexes into it. Opening a device that was unplugged since
+// returns FT_DEVICE_NOT_FOUND, opening it twice returns FT_DEVICE_NOT_OPENED.
+// Unplugging an open device makes all the calls on its handle return
+// FT_IO_ERROR.
+//
+// It is safe for concurrent use.
+type Driver struct {
+	// Major, Minor and Build are returned by Version.
+	Major, Minor, Build uint8
+
+	mu      sync.Mutex
+	devices []*Device
+	list    []*Device
+	open    map[*Device]*Faulty
+	rescans int
+}
+
+// NewDriver returns a driver with devices plugged.
+func NewDriver(devices ...*Device) *Driver {
+	return &Driver{Major: 1, Minor: 4, Build: 24, devices: devices, open: map[*Device]*Faulty{}}
+}
+
+// Plug hot-adds a device.
+func (d *Driver) Plug(dev *Device) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.devices = append(d.devices, dev)
+}
+
+// Unplug hot-removes a device. If it is open, its handle is disconnected.
+func (d *Driver) Unplug(dev *Device) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, x := range d.devices {
+		if x == dev {
+			d.devices = append(d.devices[:i:i], d.devices[i+1:]...)
+			break
+		}
+	}
+	if f := d.open[dev]; f != nil {
+		f.Disconnect()
+	}
+}
+
+// Devices returns the devices plugged.
+func (d *Driver) Devices() []*Device {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*Device(nil), d.devices...)
+}
+
+// IsOpen returns true if the device is open.
+func (d *Driver) IsOpen(dev *Device) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return dev.Opened
+}
+
+// Rescans returns the number of Rescan calls.
+func (d *Driver) Rescans() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rescans
+}
+
+// Version implements d2xx.Driver.
+func (d *Driver) Version() (uint8, uint8, uint8) {
+	return d.Major, d.Minor, d.Build
+}
+
+// CreateDeviceInfoList implements d2xx.Driver.
+func (d *Driver) CreateDeviceInfoList() (int, d2xx.Err) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.list = append([]*Device(nil), d.devices...)
+	return len(d.list), 0
+}
+
+// Open implements d2xx.Driver.
+func (d *Driver) Open(i int) (d2xx.Handle, d2xx.Err) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if i < 0 || i >= len(d.list) {
+		return nil, deviceNotFound
+	}
+	dev := d.list[i]
+	if !d.plugged(dev) {
+		return nil, deviceNotFound
+	}
+	if dev.Opened {
+		return nil, deviceNotOpened
+	}
+	var h d2xx.Handle
+	if dev.New != nil {
+		h = dev.New()
+	} else {
+		f := &Fake{DevType: dev.Type, Vid: dev.Vid, Pid: dev.Pid}
+		f.E.Serial = dev.Serial
+		f.E.Desc = dev.Desc
+		h = f
+	}
+	dev.Opened = true
+	f := &Faulty{H: h}
+	d.open[dev] = f
+	return &driverHandle{Faulty: f, d: d, dev: dev}, 0
+}
+
+// Rescan implements d2xx.Driver.
+func (d *Driver) Rescan() d2xx.Err {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rescans++
+	return 0
+}
+
+//
+
+// FT_DEVICE_NOT_FOUND and FT_DEVICE_NOT_OPENED.
+const (
+	deviceNotFound  d2xx.Err = 2
+	deviceNotOpened d2xx.Err = 3
+)
+
+func (d *Driver) plugged(dev *Device) bool {
+	for _, x := range d.devices {
+		if x == dev {
+			return true
+		}
+	}
+	return false
+}
+
+// driverHandle is a handle opened through a Driver.
+type driverHandle struct {
+	*Faulty
+	d      *Driver
+	dev    *Device
+	closed bool
+}
+
+// Close implements d2xx.Handle.
+func (h *driverHandle) Close() d2xx.Err {
+	e := h.Faulty.Close()
+	h.d.mu.Lock()
+	defer h.d.mu.Unlock()
+	if !h.closed {
+		h.closed = true
+		h.dev.Opened = false
+		delete(h.d.open, h.dev)
+	}
+	return e
+}
+
+var _ d2xx.Driver = &Driver{}
@@ -0,0 +1,104 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest_test
+
+import (
+	"testing"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest"
+)
+
+func TestDriver(t *testing.T) {
+	a := &d2xxtest.Device{Type: d2xx.Device232H, Vid: 0x0403, Pid: 0x6014, Serial: "FTA", Desc: "Single RS232-HS"}
+	b := &d2xxtest.Device{Type: d2xx.Device232R, Vid: 0x0403, Pid: 0x6001, Serial: "FTB", Desc: "FT232R USB UART"}
+	d := d2xxtest.NewDriver(a)
+	defer d2xx.SetDriver(d2xx.SetDriver(d))
+
+	if maj, min, build := d2xx.Version(); maj != 1 || min != 4 || build != 24 {
+		t.Fatal(maj, min, build)
+	}
+	d.Plug(b)
+	if n, e := d2xx.CreateDeviceInfoList(); n != 2 || e != 0 {
+		t.Fatal(n, e)
+	}
+	h, e := d2xx.Open(1)
+	if e != 0 {
+		t.Fatal(e)
+	}
+	if dt, vid, pid, e := h.GetDeviceInfo(); dt != d2xx.Device232R || vid != 0x0403 || pid != 0x6001 || e != 0 {
+		t.Fatal(dt, vid, pid, e)
+	}
+	var ee d2xx.EEPROM
+	if e := h.EEPROMRead(d2xx.Device232R, &ee); e != 0 || ee.Serial != "FTB" || ee.Desc != "FT232R USB UART" {
+		t.Fatal(e, ee)
+	}
+	if !d.IsOpen(b) || d.IsOpen(a) {
+		t.Fatal("unexpected open state")
+	}
+	if _, e := d2xx.Open(1); e != 3 {
+		t.Fatal(e)
+	}
+	if e := h.Close(); e != 0 || d.IsOpen(b) {
+		t.Fatal(e)
+	}
+	if _, e := d2xx.Open(2); e != 2 {
+		t.Fatal(e)
+	}
+	if e := d2xx.Rescan(); e != 0 || d.Rescans() != 1 {
+		t.Fatal(e)
+	}
+}
+
+func TestDriver_hotplug(t *testing.T) {
+	a := &d2xxtest.Device{Type: d2xx.Device232H}
+	b := &d2xxtest.Device{Type: d2xx.Device232R}
+	d := d2xxtest.NewDriver(a, b)
+	if n, _ := d.CreateDeviceInfoList(); n != 2 {
+		t.Fatal(n)
+	}
+	h, e := d.Open(0)
+	if e != 0 {
+		t.Fatal(e)
+	}
+	d.Unplug(a)
+	d.Unplug(b)
+	// The open handle is disconnected, the stale list entry is gone.
+	if _, e := h.GetQueueStatus(); e != 4 {
+		t.Fatal(e)
+	}
+	if _, e := d.Open(1); e != 2 {
+		t.Fatal(e)
+	}
+	if e := h.Close(); e != 4 || d.IsOpen(a) {
+		t.Fatal(e)
+	}
+	if n, _ := d.CreateDeviceInfoList(); n != 0 || len(d.Devices()) != 0 {
+		t.Fatal(n)
+	}
+	// Plugged back, it can be opened again.
+	d.Plug(a)
+	if n, _ := d.CreateDeviceInfoList(); n != 1 {
+		t.Fatal(n)
+	}
+	h, e = d.Open(0)
+	if e != 0 {
+		t.Fatal(e)
+	}
+	if _, e := h.GetQueueStatus(); e != 0 {
+		t.Fatal(e)
+	}
+}
+
+func TestDriver_new(t *testing.T) {
+	f := d2xxtest.NewMPSSE()
+	d := d2xxtest.NewDriver(&d2xxtest.Device{New: func() d2xx.Handle { return f }})
+	d.CreateDeviceInfoList()
+	h, _ := d.Open(0)
+	h.Write([]byte{1})
+	if len(f.Writes) != 1 {
+		t.Fatal(f.Writes)
+	}
+}
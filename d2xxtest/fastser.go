@@ -0,0 +1,96 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/eeprom"
+	"periph.io/x/d2xx/fastser"
+)
+
+// FastSerial is a fake d2xx.Handle that simulates one channel of the fast
+// opto-isolated serial interface, down to the frames on the wire.
+type FastSerial struct {
+	Fake
+	// Channel is the channel of the handle.
+	Channel fastser.Channel
+	// Sent are the frames sent by the device on FSDO.
+	Sent []fastser.Frame
+	// CTS is the level of FSCTS. When false, the remote end isn't ready and
+	// writes time out.
+	CTS bool
+	// Dropped is the number of frames received with a framing error or for
+	// the other channel.
+	Dropped int
+
+	rx []byte
+}
+
+// NewFastSerial returns channel ch of a simulated FT2232H with the fast serial
+// interface enabled on both channels.
+func NewFastSerial(ch fastser.Channel) *FastSerial {
+	f := &FastSerial{Fake: Fake{DevType: d2xx.Device2232H, Vid: 0x0403, Pid: 0x6010}, Channel: ch, CTS: true}
+	f.E.Raw = make([]byte, eeprom.Size(d2xx.Device2232H))
+	_ = eeprom.SetFastSerial(d2xx.Device2232H, f.E.Raw, 0, true)
+	_ = eeprom.SetFastSerial(d2xx.Device2232H, f.E.Raw, 1, true)
+	return f
+}
+
+// Receive simulates frames sent by the remote end on FSDI. Only the valid
+// frames for this channel are received.
+func (f *FastSerial) Receive(frames ...fastser.Frame) {
+	for _, fr := range frames {
+		if !fr.Valid() || fr.Channel() != f.Channel {
+			f.Dropped++
+			continue
+		}
+		f.rx = append(f.rx, fr.Data())
+	}
+}
+
+// ResetDevice implements d2xx.Handle.
+func (f *FastSerial) ResetDevice() d2xx.Err {
+	if e := f.Fake.ResetDevice(); e != 0 {
+		return e
+	}
+	f.rx = nil
+	return 0
+}
+
+// GetQueueStatus implements d2xx.Handle.
+func (f *FastSerial) GetQueueStatus() (uint32, d2xx.Err) {
+	if f.Closed {
+		return 0, invalidHandle
+	}
+	return uint32(len(f.rx)), 0
+}
+
+// Read implements d2xx.Handle.
+func (f *FastSerial) Read(b []byte) (int, d2xx.Err) {
+	if f.Closed {
+		return 0, invalidHandle
+	}
+	n := copy(b, f.rx)
+	f.rx = f.rx[n:]
+	return n, 0
+}
+
+// Write implements d2xx.Handle.
+//
+// Each byte is framed with the channel as the port bit.
+func (f *FastSerial) Write(b []byte) (int, d2xx.Err) {
+	if _, e := f.Fake.Write(b); e != 0 {
+		return 0, e
+	}
+	if f.BitMode != d2xx.BitModeFastSerial || !f.CTS {
+		return 0, 0
+	}
+	for _, c := range b {
+		f.Sent = append(f.Sent, fastser.NewFrame(c, f.Channel))
+	}
+	return len(b), 0
+}
+
+var _ d2xx.Handle = &FastSerial{}
@@ -0,0 +1,357 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"periph.io/x/d2xx"
+)
+
+// FaultKind is the kind of fault injected by a Rule.
+type FaultKind int
+
+// Fault kinds.
+const (
+	// FaultError returns Rule.Err without calling the inner handle.
+	FaultError FaultKind = iota
+	// FaultShort transfers fewer bytes than requested in Read and Write.
+	FaultShort
+	// FaultLatency delays the call by Rule.Latency.
+	FaultLatency
+	// FaultDisconnect simulates the device being unplugged: this call and all
+	// the following ones return FT_IO_ERROR.
+	FaultDisconnect
+)
+
+func (f FaultKind) String() string {
+	switch f {
+	case FaultError:
+		return "error"
+	case FaultShort:
+		return "short"
+	case FaultLatency:
+		return "latency"
+	case FaultDisconnect:
+		return "disconnect"
+	default:
+		return fmt.Sprintf("FaultKind(%d)", int(f))
+	}
+}
+
+// Rule is a fault injection rule.
+type Rule struct {
+	// Method is the d2xx.Handle method name the rule applies to, e.g. "Read".
+	// Empty matches all the methods.
+	Method string
+	// Call, if not zero, only matches the Nth call to Method, counting from 1.
+	// When Method is empty, all the calls are counted.
+	Call int
+	// Probability, if not zero, is the probability that a matching call is
+	// faulted, drawn from the generator seeded with Faulty.Seed.
+	Probability float64
+
+	Kind FaultKind
+	// Err is returned by FaultError. Defaults to FT_IO_ERROR.
+	Err d2xx.Err
+	// Short is the number of bytes transferred by FaultShort. If 0 or not
+	// shorter than the request, a random length of at least 1 byte is used.
+	// Transfers of a single byte can't be shortened and are not faulted.
+	Short int
+	// Latency is the delay added by FaultLatency. It advances Faulty.Clock if
+	// set, and sleeps otherwise.
+	Latency time.Duration
+}
+
+// Faulty wraps a d2xx.Handle and injects faults according to rules, to test
+// the error handling of the code using the handle.
+//
+// Faults are deterministic for a given Seed and sequence of calls. All the
+// matching rules are applied in order, until one returns an error.
+//
+// It is safe for concurrent use if H is.
+type Faulty struct {
+	H     d2xx.Handle
+	Rules []Rule
+	Seed  int64
+	// Clock, if set, is advanced by FaultLatency instead of sleeping.
+	Clock *Clock
+
+	mu           sync.Mutex
+	rnd          *rand.Rand
+	calls        map[string]int
+	injected     int
+	disconnected bool
+}
+
+// Injected returns the number of faults injected so far.
+func (f *Faulty) Injected() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.injected
+}
+
+// Disconnected returns true once a FaultDisconnect fired.
+func (f *Faulty) Disconnected() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.disconnected
+}
+
+// Disconnect simulates the device being unplugged: all the following calls
+// return FT_IO_ERROR.
+func (f *Faulty) Disconnect() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.disconnected = true
+}
+
+// Close implements d2xx.Handle.
+//
+// After a disconnect, the inner handle is still closed to release it.
+func (f *Faulty) Close() d2xx.Err {
+	if _, e := f.inject("Close", 0); e != 0 {
+		if f.Disconnected() {
+			f.H.Close()
+		}
+		return e
+	}
+	return f.H.Close()
+}
+
+// ResetDevice implements d2xx.Handle.
+func (f *Faulty) ResetDevice() d2xx.Err {
+	if _, e := f.inject("ResetDevice", 0); e != 0 {
+		return e
+	}
+	return f.H.ResetDevice()
+}
+
+// GetDeviceInfo implements d2xx.Handle.
+func (f *Faulty) GetDeviceInfo() (uint32, uint16, uint16, d2xx.Err) {
+	if _, e := f.inject("GetDeviceInfo", 0); e != 0 {
+		return 0, 0, 0, e
+	}
+	return f.H.GetDeviceInfo()
+}
+
+// EEPROMRead implements d2xx.Handle.
+func (f *Faulty) EEPROMRead(devType uint32, e *d2xx.EEPROM) d2xx.Err {
+	if _, err := f.inject("EEPROMRead", 0); err != 0 {
+		return err
+	}
+	return f.H.EEPROMRead(devType, e)
+}
+
+// EEPROMProgram implements d2xx.Handle.
+func (f *Faulty) EEPROMProgram(e *d2xx.EEPROM) d2xx.Err {
+	if _, err := f.inject("EEPROMProgram", 0); err != 0 {
+		return err
+	}
+	return f.H.EEPROMProgram(e)
+}
+
+// EraseEE implements d2xx.Handle.
+func (f *Faulty) EraseEE() d2xx.Err {
+	if _, e := f.inject("EraseEE", 0); e != 0 {
+		return e
+	}
+	return f.H.EraseEE()
+}
+
+// WriteEE implements d2xx.Handle.
+func (f *Faulty) WriteEE(offset uint8, value uint16) d2xx.Err {
+	if _, e := f.inject("WriteEE", 0); e != 0 {
+		return e
+	}
+	return f.H.WriteEE(offset, value)
+}
+
+// EEUASize implements d2xx.Handle.
+func (f *Faulty) EEUASize() (int, d2xx.Err) {
+	if _, e := f.inject("EEUASize", 0); e != 0 {
+		return 0, e
+	}
+	return f.H.EEUASize()
+}
+
+// EEUARead implements d2xx.Handle.
+func (f *Faulty) EEUARead(ua []byte) d2xx.Err {
+	if _, e := f.inject("EEUARead", 0); e != 0 {
+		return e
+	}
+	return f.H.EEUARead(ua)
+}
+
+// EEUAWrite implements d2xx.Handle.
+func (f *Faulty) EEUAWrite(ua []byte) d2xx.Err {
+	if _, e := f.inject("EEUAWrite", 0); e != 0 {
+		return e
+	}
+	return f.H.EEUAWrite(ua)
+}
+
+// SetChars implements d2xx.Handle.
+func (f *Faulty) SetChars(eventChar byte, eventEn bool, errorChar byte, errorEn bool) d2xx.Err {
+	if _, e := f.inject("SetChars", 0); e != 0 {
+		return e
+	}
+	return f.H.SetChars(eventChar, eventEn, errorChar, errorEn)
+}
+
+// SetUSBParameters implements d2xx.Handle.
+func (f *Faulty) SetUSBParameters(in, out int) d2xx.Err {
+	if _, e := f.inject("SetUSBParameters", 0); e != 0 {
+		return e
+	}
+	return f.H.SetUSBParameters(in, out)
+}
+
+// SetFlowControl implements d2xx.Handle.
+func (f *Faulty) SetFlowControl() d2xx.Err {
+	if _, e := f.inject("SetFlowControl", 0); e != 0 {
+		return e
+	}
+	return f.H.SetFlowControl()
+}
+
+// SetTimeouts implements d2xx.Handle.
+func (f *Faulty) SetTimeouts(readMS, writeMS int) d2xx.Err {
+	if _, e := f.inject("SetTimeouts", 0); e != 0 {
+		return e
+	}
+	return f.H.SetTimeouts(readMS, writeMS)
+}
+
+// SetLatencyTimer implements d2xx.Handle.
+func (f *Faulty) SetLatencyTimer(delayMS uint8) d2xx.Err {
+	if _, e := f.inject("SetLatencyTimer", 0); e != 0 {
+		return e
+	}
+	return f.H.SetLatencyTimer(delayMS)
+}
+
+// SetBaudRate implements d2xx.Handle.
+func (f *Faulty) SetBaudRate(hz uint32) d2xx.Err {
+	if _, e := f.inject("SetBaudRate", 0); e != 0 {
+		return e
+	}
+	return f.H.SetBaudRate(hz)
+}
+
+// GetQueueStatus implements d2xx.Handle.
+func (f *Faulty) GetQueueStatus() (uint32, d2xx.Err) {
+	if _, e := f.inject("GetQueueStatus", 0); e != 0 {
+		return 0, e
+	}
+	return f.H.GetQueueStatus()
+}
+
+// Read implements d2xx.Handle.
+func (f *Faulty) Read(b []byte) (int, d2xx.Err) {
+	n, e := f.inject("Read", len(b))
+	if e != 0 {
+		return 0, e
+	}
+	return f.H.Read(b[:n])
+}
+
+// Write implements d2xx.Handle.
+func (f *Faulty) Write(b []byte) (int, d2xx.Err) {
+	n, e := f.inject("Write", len(b))
+	if e != 0 {
+		return 0, e
+	}
+	return f.H.Write(b[:n])
+}
+
+// GetBitMode implements d2xx.Handle.
+func (f *Faulty) GetBitMode() (byte, d2xx.Err) {
+	if _, e := f.inject("GetBitMode", 0); e != 0 {
+		return 0, e
+	}
+	return f.H.GetBitMode()
+}
+
+// SetBitMode implements d2xx.Handle.
+func (f *Faulty) SetBitMode(mask, mode byte) d2xx.Err {
+	if _, e := f.inject("SetBitMode", 0); e != 0 {
+		return e
+	}
+	return f.H.SetBitMode(mask, mode)
+}
+
+//
+
+// ioError is FT_IO_ERROR.
+const ioError d2xx.Err = 4
+
+// inject applies the rules to a call transferring size bytes. It returns the
+// number of bytes to transfer or the error to return.
+func (f *Faulty) inject(method string, size int) (int, d2xx.Err) {
+	f.mu.Lock()
+	if f.rnd == nil {
+		f.rnd = rand.New(rand.NewSource(f.Seed))
+		f.calls = map[string]int{}
+	}
+	f.calls[method]++
+	f.calls[""]++
+	var delay time.Duration
+	var e d2xx.Err
+	if f.disconnected {
+		e = ioError
+	}
+	for i := 0; e == 0 && i < len(f.Rules); i++ {
+		r := &f.Rules[i]
+		if !f.match(r, method) {
+			continue
+		}
+		switch r.Kind {
+		case FaultError:
+			if e = r.Err; e == 0 {
+				e = ioError
+			}
+		case FaultShort:
+			if size <= 1 {
+				continue
+			}
+			if r.Short > 0 && r.Short < size {
+				size = r.Short
+			} else {
+				size = 1 + f.rnd.Intn(size-1)
+			}
+		case FaultLatency:
+			delay += r.Latency
+		case FaultDisconnect:
+			f.disconnected = true
+			e = ioError
+		}
+		f.injected++
+	}
+	f.mu.Unlock()
+	if delay > 0 {
+		if f.Clock != nil {
+			f.Clock.Advance(delay)
+		} else {
+			time.Sleep(delay)
+		}
+	}
+	return size, e
+}
+
+func (f *Faulty) match(r *Rule, method string) bool {
+	if r.Method != "" && r.Method != method {
+		return false
+	}
+	if r.Call != 0 && f.calls[r.Method] != r.Call {
+		return false
+	}
+	return r.Probability == 0 || f.rnd.Float64() < r.Probability
+}
+
+var _ d2xx.Handle = &Faulty{}
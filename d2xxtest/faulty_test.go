@@ -0,0 +1,126 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest_test
+
+import (
+	"testing"
+	"time"
+
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/mpsse"
+)
+
+func TestFaulty_call(t *testing.T) {
+	f := &d2xxtest.Faulty{
+		H:     &d2xxtest.Fake{},
+		Rules: []d2xxtest.Rule{{Method: "SetBaudRate", Call: 2, Err: 6}},
+	}
+	for i, want := range []int{0, 6, 0} {
+		if e := f.SetBaudRate(9600); int(e) != want {
+			t.Fatalf("#%d: %d", i, e)
+		}
+	}
+	if f.Injected() != 1 {
+		t.Fatal(f.Injected())
+	}
+}
+
+func TestFaulty_short(t *testing.T) {
+	// The MPSSE command queue retries short transfers.
+	f := &d2xxtest.Faulty{
+		H:     d2xxtest.NewMPSSE(),
+		Rules: []d2xxtest.Rule{{Method: "Write", Kind: d2xxtest.FaultShort}, {Method: "Read", Kind: d2xxtest.FaultShort, Short: 1}},
+	}
+	c := mpsse.New(f)
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if f.Injected() < 4 {
+		t.Fatal(f.Injected())
+	}
+	f = &d2xxtest.Faulty{
+		H:     &d2xxtest.Fake{Data: [][]byte{{1, 2, 3}}},
+		Rules: []d2xxtest.Rule{{Method: "Read", Kind: d2xxtest.FaultShort, Short: 2}},
+	}
+	b := make([]byte, 3)
+	if n, e := f.Read(b); n != 2 || e != 0 || b[1] != 2 {
+		t.Fatal(n, e, b)
+	}
+}
+
+func TestFaulty_disconnect(t *testing.T) {
+	inner := &d2xxtest.Fake{}
+	f := &d2xxtest.Faulty{
+		H:     inner,
+		Rules: []d2xxtest.Rule{{Call: 3, Kind: d2xxtest.FaultDisconnect}},
+	}
+	c := mpsse.New(f)
+	if err := c.Init(); err == nil || err.Error() != "mpsse: SetUSBParameters: I/O error" {
+		t.Fatal(err)
+	}
+	if !f.Disconnected() {
+		t.Fatal("expected disconnect")
+	}
+	if _, e := f.GetQueueStatus(); e != 4 {
+		t.Fatal(e)
+	}
+	if e := f.Close(); e != 4 || !inner.Closed {
+		t.Fatal(e)
+	}
+}
+
+func TestFaulty_latency(t *testing.T) {
+	f := &d2xxtest.Faulty{
+		H:     &d2xxtest.Fake{},
+		Rules: []d2xxtest.Rule{{Method: "GetQueueStatus", Kind: d2xxtest.FaultLatency, Latency: 5 * time.Millisecond}},
+	}
+	start := time.Now()
+	if _, e := f.GetQueueStatus(); e != 0 {
+		t.Fatal(e)
+	}
+	if d := time.Since(start); d < 5*time.Millisecond {
+		t.Fatal(d)
+	}
+}
+
+func TestFaulty_seed(t *testing.T) {
+	run := func(seed int64) []bool {
+		f := &d2xxtest.Faulty{
+			H:     &d2xxtest.Fake{},
+			Rules: []d2xxtest.Rule{{Method: "ResetDevice", Probability: 0.5}},
+			Seed:  seed,
+		}
+		var out []bool
+		for i := 0; i < 32; i++ {
+			out = append(out, f.ResetDevice() != 0)
+		}
+		return out
+	}
+	a, b, c := run(1), run(1), run(2)
+	same, faults := true, 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("#%d: not deterministic", i)
+		}
+		if a[i] != c[i] {
+			same = false
+		}
+		if a[i] {
+			faults++
+		}
+	}
+	if same || faults == 0 || faults == len(a) {
+		t.Fatal(a, c)
+	}
+}
+
+func TestFaultKind_String(t *testing.T) {
+	if s := d2xxtest.FaultDisconnect.String(); s != "disconnect" {
+		t.Fatal(s)
+	}
+	if s := d2xxtest.FaultKind(10).String(); s != "FaultKind(10)" {
+		t.Fatal(s)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"sync"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/eeprom"
+)
+
+// FIFO is a fake d2xx.Handle that simulates a device in synchronous 245 FIFO
+// mode, connected to a data source like an FPGA.
+//
+// It is safe for concurrent use.
+type FIFO struct {
+	Fake
+
+	mu sync.Mutex
+	in []byte
+}
+
+// NewFIFO returns a simulated FT232H with its EEPROM configured for the 245
+// FIFO.
+func NewFIFO() *FIFO {
+	f := &FIFO{Fake: Fake{DevType: d2xx.Device232H, Vid: 0x0403, Pid: 0x6014}}
+	f.E.Raw = make([]byte, eeprom.Size(d2xx.Device232H))
+	_ = eeprom.SetFIFO(d2xx.Device232H, f.E.Raw, true)
+	return f
+}
+
+// Feed queues data sent by the source to the host.
+func (f *FIFO) Feed(b []byte) {
+	f.mu.Lock()
+	f.in = append(f.in, b...)
+	f.mu.Unlock()
+}
+
+// Pending returns the number of bytes fed and not yet read.
+func (f *FIFO) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.in)
+}
+
+// Written returns a copy of the data written by the host.
+func (f *FIFO) Written() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Fake.Written()
+}
+
+// ResetDevice implements d2xx.Handle.
+func (f *FIFO) ResetDevice() d2xx.Err {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.in = nil
+	return f.Fake.ResetDevice()
+}
+
+// SetBitMode implements d2xx.Handle.
+func (f *FIFO) SetBitMode(mask, mode byte) d2xx.Err {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Fake.SetBitMode(mask, mode)
+}
+
+// GetQueueStatus implements d2xx.Handle.
+func (f *FIFO) GetQueueStatus() (uint32, d2xx.Err) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Closed {
+		return 0, invalidHandle
+	}
+	return uint32(len(f.in)), 0
+}
+
+// Read implements d2xx.Handle.
+func (f *FIFO) Read(b []byte) (int, d2xx.Err) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Closed {
+		return 0, invalidHandle
+	}
+	n := copy(b, f.in)
+	f.in = f.in[n:]
+	return n, 0
+}
+
+// Write implements d2xx.Handle.
+func (f *FIFO) Write(b []byte) (int, d2xx.Err) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Closed {
+		return 0, invalidHandle
+	}
+	if f.BitMode != d2xx.BitModeSyncFIFO {
+		return 0, 0
+	}
+	return f.Fake.Write(b)
+}
+
+var _ d2xx.Handle = &FIFO{}
@@ -0,0 +1,93 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/eeprom"
+)
+
+// FT1248 is a fake d2xx.Handle that simulates a FT232H or FT-X in FT1248 mode
+// with a MCU attached.
+type FT1248 struct {
+	Fake
+	// MCU, if set, is called with the data written by the host, as read by
+	// the MCU, and returns the data the MCU sends back.
+	MCU func(b []byte) []byte
+	// Programs counts the EEPROMProgram calls.
+	Programs int
+
+	rx []byte
+}
+
+// NewFT1248 returns a simulated device with FT1248 enabled in its EEPROM.
+//
+// devType must be d2xx.Device232H or d2xx.DeviceXSeries.
+func NewFT1248(devType uint32) *FT1248 {
+	f := &FT1248{Fake: Fake{DevType: devType, Vid: 0x0403, Pid: 0x6015}}
+	if devType == d2xx.Device232H {
+		f.Pid = 0x6014
+	}
+	f.E.Raw = make([]byte, eeprom.Size(devType))
+	_ = eeprom.SetFT1248(devType, f.E.Raw, &eeprom.FT1248{Enabled: true})
+	return f
+}
+
+// EEPROMProgram implements d2xx.Handle.
+func (f *FT1248) EEPROMProgram(e *d2xx.EEPROM) d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	f.Programs++
+	f.E = *e
+	f.E.Raw = append([]byte(nil), e.Raw...)
+	return 0
+}
+
+// EEPROMRead implements d2xx.Handle.
+//
+// Unlike Fake, Raw is a copy.
+func (f *FT1248) EEPROMRead(devType uint32, e *d2xx.EEPROM) d2xx.Err {
+	if f.Closed {
+		return invalidHandle
+	}
+	*e = f.E
+	e.Raw = append([]byte(nil), f.E.Raw...)
+	return 0
+}
+
+// GetQueueStatus implements d2xx.Handle.
+func (f *FT1248) GetQueueStatus() (uint32, d2xx.Err) {
+	if f.Closed {
+		return 0, invalidHandle
+	}
+	return uint32(len(f.rx)), 0
+}
+
+// Read implements d2xx.Handle.
+func (f *FT1248) Read(b []byte) (int, d2xx.Err) {
+	if f.Closed {
+		return 0, invalidHandle
+	}
+	n := copy(b, f.rx)
+	f.rx = f.rx[n:]
+	return n, 0
+}
+
+// Write implements d2xx.Handle.
+//
+// Without MCU, nothing reads the data and the write times out.
+func (f *FT1248) Write(b []byte) (int, d2xx.Err) {
+	if _, e := f.Fake.Write(b); e != 0 {
+		return 0, e
+	}
+	if f.MCU == nil {
+		return 0, 0
+	}
+	f.rx = append(f.rx, f.MCU(b)...)
+	return len(b), 0
+}
+
+var _ d2xx.Handle = &FT1248{}
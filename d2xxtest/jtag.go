@@ -0,0 +1,203 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/jtag"
+)
+
+// DR is a simulated JTAG data register.
+type DR struct {
+	// Len is the register length in bits.
+	Len int
+	// Value is loaded in CaptureDR and replaced in UpdateDR. It is LSB first.
+	Value []byte
+	// Update, if set, is called in UpdateDR with the new value.
+	Update func(v []byte)
+}
+
+// TAP is a simulated IEEE 1149.1 TAP.
+type TAP struct {
+	// IRLen is the instruction register length, up to 64 bits.
+	IRLen int
+	// IRCapture is loaded in the instruction register in CaptureIR. The two
+	// least significant bits are always forced to 01 as mandated by IEEE
+	// 1149.1.
+	IRCapture uint64
+	// IDCode is the device identification. If zero, the TAP has no IDCODE
+	// register and BYPASS is selected in TestLogicReset.
+	IDCode uint32
+	// IDCodeIR is the IDCODE instruction.
+	IDCodeIR uint64
+	// Regs are the data registers, keyed by instruction. Instructions not
+	// found select BYPASS.
+	Regs map[uint64]*DR
+
+	// State is the current TAP state.
+	State jtag.State
+	// IR is the current instruction.
+	IR uint64
+	// Idle is the number of TCK cycles spent in RunTestIdle.
+	Idle int
+
+	sr  []bool
+	tdo bool
+}
+
+// Reset moves the TAP to TestLogicReset, as if TRST was asserted.
+func (t *TAP) Reset() {
+	t.State = jtag.TestLogicReset
+	t.resetIR()
+	t.tdo = true
+}
+
+func (t *TAP) resetIR() {
+	if t.IDCode != 0 {
+		t.IR = t.IDCodeIR
+	} else {
+		t.IR = 1<<uint(t.IRLen) - 1
+	}
+}
+
+// clock simulates a TCK rising edge and returns TDO after the following
+// falling edge.
+func (t *TAP) clock(tdi, tms bool) bool {
+	switch t.State {
+	case jtag.RunTestIdle:
+		t.Idle++
+	case jtag.CaptureDR:
+		t.captureDR()
+	case jtag.CaptureIR:
+		t.sr = toBits(t.IRCapture&^3|1, t.IRLen)
+	case jtag.ShiftDR, jtag.ShiftIR:
+		if len(t.sr) != 0 {
+			t.sr = append(t.sr[1:], tdi)
+		}
+	}
+	t.State = t.State.Next(tms)
+	switch t.State {
+	case jtag.TestLogicReset:
+		t.resetIR()
+	case jtag.UpdateIR:
+		t.IR = 0
+		for i, b := range t.sr {
+			if b {
+				t.IR |= 1 << uint(i)
+			}
+		}
+	case jtag.UpdateDR:
+		if r := t.Regs[t.IR]; r != nil && (t.IDCode == 0 || t.IR != t.IDCodeIR) {
+			r.Value = make([]byte, (r.Len+7)/8)
+			for i, b := range t.sr {
+				if b {
+					r.Value[i/8] |= 1 << uint(i%8)
+				}
+			}
+			if r.Update != nil {
+				r.Update(r.Value)
+			}
+		}
+	}
+	switch t.State {
+	case jtag.ShiftDR, jtag.ShiftIR:
+		t.tdo = len(t.sr) != 0 && t.sr[0]
+	default:
+		// TDO is high impedance; it is pulled up.
+		t.tdo = true
+	}
+	return t.tdo
+}
+
+func (t *TAP) captureDR() {
+	if t.IDCode != 0 && t.IR == t.IDCodeIR {
+		t.sr = toBits(uint64(t.IDCode), 32)
+		return
+	}
+	if r := t.Regs[t.IR]; r != nil {
+		t.sr = make([]bool, r.Len)
+		for i := range t.sr {
+			if i/8 < len(r.Value) {
+				t.sr[i] = r.Value[i/8]>>uint(i%8)&1 != 0
+			}
+		}
+		return
+	}
+	// BYPASS captures a zero.
+	t.sr = []bool{false}
+}
+
+func toBits(v uint64, n int) []bool {
+	b := make([]bool, n)
+	for i := range b {
+		b[i] = v>>uint(i)&1 != 0
+	}
+	return b
+}
+
+// JTAGChain is a fake d2xx.Handle that interprets the MPSSE commands written
+// to it and drives a simulated JTAG chain.
+//
+// It uses the standard MPSSE JTAG wiring: ADBUS0 is TCK, ADBUS1 is TDI,
+// ADBUS2 is TDO and ADBUS3 is TMS.
+type JTAGChain struct {
+	mpsseHandle
+	// TAPs is the chain, listed from the one closest to TDO to the one closest
+	// to TDI, like jtag.Controller.Devices.
+	TAPs []*TAP
+	// TRST, if not zero, is the pin number of the active low TAP reset.
+	TRST uint8
+}
+
+// NewJTAGChain returns a simulated FT232H connected to a JTAG chain.
+//
+// All the TAPs are reset.
+func NewJTAGChain(taps ...*TAP) *JTAGChain {
+	j := &JTAGChain{mpsseHandle: newMPSSEHandle(), TAPs: taps}
+	for _, t := range taps {
+		t.Reset()
+	}
+	j.e.clock = j.clock
+	j.e.set = j.set
+	return j
+}
+
+func (j *JTAGChain) clock(pins uint16) uint16 {
+	if j.trstAsserted(pins) {
+		return pins | pinTDO
+	}
+	tms := pins&pinTMS != 0
+	tdi := pins&pinTDI != 0
+	// Sample all the TDO first since they all change on the same edge.
+	for i := len(j.TAPs) - 1; i >= 0; i-- {
+		t := j.TAPs[i]
+		prev := t.tdo
+		t.clock(tdi, tms)
+		tdi = prev
+	}
+	return j.tdo(pins)
+}
+
+func (j *JTAGChain) set(pins uint16) uint16 {
+	if j.trstAsserted(pins) {
+		for _, t := range j.TAPs {
+			t.Reset()
+		}
+	}
+	return j.tdo(pins)
+}
+
+func (j *JTAGChain) trstAsserted(pins uint16) bool {
+	return j.TRST != 0 && pins&(1<<j.TRST) == 0
+}
+
+func (j *JTAGChain) tdo(pins uint16) uint16 {
+	if len(j.TAPs) == 0 || j.TAPs[0].tdo {
+		return pins | pinTDO
+	}
+	return pins &^ pinTDO
+}
+
+var _ d2xx.Handle = &JTAGChain{}
@@ -0,0 +1,46 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"periph.io/x/d2xx"
+)
+
+// MCUBus is a fake FT2232H in MCU host bus emulation mode, connected to a 64
+// KiB memory.
+type MCUBus struct {
+	mpsseHandle
+	// Mem is the memory on the bus.
+	Mem [65536]byte
+	// Reads and Writes count the bus cycles.
+	Reads  int
+	Writes int
+	// Transfers counts the USB writes.
+	Transfers int
+}
+
+// NewMCUBus returns a simulated FT2232H with a memory on its MCU host bus.
+func NewMCUBus() *MCUBus {
+	b := &MCUBus{mpsseHandle: newMPSSEHandle()}
+	b.DevType = d2xx.Device2232H
+	b.Pid = 0x6010
+	b.e.busRead = func(addr uint16) byte {
+		b.Reads++
+		return b.Mem[addr]
+	}
+	b.e.busWrite = func(addr uint16, v byte) {
+		b.Writes++
+		b.Mem[addr] = v
+	}
+	return b
+}
+
+// Write implements d2xx.Handle.
+func (b *MCUBus) Write(p []byte) (int, d2xx.Err) {
+	b.Transfers++
+	return b.mpsseHandle.Write(p)
+}
+
+var _ d2xx.Handle = &MCUBus{}
@@ -0,0 +1,201 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+// MemAP is a simulated ADIv5 MEM-AP on a 32 bits little endian bus.
+//
+// It implements SWDAP.
+type MemAP struct {
+	// IDR is the identification register.
+	IDR uint32
+	// Base is the BASE register, pointing to the ROM table.
+	Base uint32
+	// Mem is the bus content, keyed by word aligned address. Accessing a
+	// missing word is a bus error.
+	Mem map[uint32]uint32
+	// Core, if set, simulates the Cortex-M debug registers in the System
+	// Control Space.
+	Core *CortexM
+	// CSW and TAR are the MEM-AP registers.
+	CSW uint32
+	TAR uint32
+}
+
+// NewMemAP returns an AHB-AP with no ROM table and an empty memory.
+func NewMemAP() *MemAP {
+	return &MemAP{IDR: 0x24770011, Base: 0xFFFFFFFF, Mem: map[uint32]uint32{}}
+}
+
+// ReadAP implements SWDAP.
+func (m *MemAP) ReadAP(addr uint8) (uint32, bool) {
+	switch addr {
+	case 0x00:
+		// DeviceEn is always set.
+		return m.CSW | 1<<6, true
+	case 0x04:
+		return m.TAR, true
+	case 0x0C:
+		v, ok := m.read(m.TAR &^ 3)
+		m.increment()
+		return v, ok
+	case 0x10, 0x14, 0x18, 0x1C:
+		return m.read(m.TAR&^0xF | uint32(addr&0xC))
+	case 0xF4:
+		return 0, true
+	case 0xF8:
+		return m.Base, true
+	case 0xFC:
+		return m.IDR, true
+	}
+	return 0, true
+}
+
+// WriteAP implements SWDAP.
+func (m *MemAP) WriteAP(addr uint8, v uint32) bool {
+	switch addr {
+	case 0x00:
+		m.CSW = v &^ (1 << 6)
+	case 0x04:
+		m.TAR = v
+	case 0x0C:
+		size := uint32(1) << (m.CSW & 7)
+		mask := uint32(0xFFFFFFFF)
+		if size < 4 {
+			mask = (1<<(8*size) - 1) << (8 * (m.TAR & 3))
+		}
+		a := m.TAR &^ 3
+		ok := true
+		if mask != 0xFFFFFFFF {
+			var old uint32
+			if old, ok = m.read(a); ok {
+				v = old&^mask | v&mask
+			}
+		}
+		if ok {
+			ok = m.write(a, v)
+		}
+		m.increment()
+		return ok
+	case 0x10, 0x14, 0x18, 0x1C:
+		return m.write(m.TAR&^0xF|uint32(addr&0xC), v)
+	}
+	return true
+}
+
+// increment updates TAR after a DRW access. Only the 10 least significant
+// bits increment, as allowed by ADIv5.
+func (m *MemAP) increment() {
+	if m.CSW>>4&3 == 1 {
+		size := uint32(1) << (m.CSW & 7)
+		m.TAR = m.TAR&^0x3FF | (m.TAR+size)&0x3FF
+	}
+}
+
+func (m *MemAP) read(a uint32) (uint32, bool) {
+	if m.Core != nil {
+		if v, ok := m.Core.read(a); ok {
+			return v, true
+		}
+	}
+	v, ok := m.Mem[a]
+	return v, ok
+}
+
+func (m *MemAP) write(a, v uint32) bool {
+	if m.Core != nil && m.Core.write(a, v) {
+		return true
+	}
+	if _, ok := m.Mem[a]; !ok {
+		return false
+	}
+	m.Mem[a] = v
+	return true
+}
+
+// CortexM simulates the debug registers of a Cortex-M core.
+type CortexM struct {
+	// CPUIDValue is returned by the CPUID register.
+	CPUIDValue uint32
+	// DebugEn is DHCSR.C_DEBUGEN.
+	DebugEn bool
+	// Halted is DHCSR.S_HALT.
+	Halted bool
+	// DEMCR is the Debug Exception and Monitor Control Register.
+	DEMCR uint32
+	// Regs are the core registers, as numbered in DCRSR.
+	Regs [32]uint32
+	// Resets is the number of system resets requested through AIRCR.
+	Resets int
+
+	resetSt bool
+	dcrdr   uint32
+}
+
+func (c *CortexM) read(a uint32) (uint32, bool) {
+	switch a {
+	case 0xE000ED00:
+		return c.CPUIDValue, true
+	case 0xE000ED0C:
+		return 0xFA050000, true
+	case 0xE000EDF0:
+		// S_REGRDY is always set.
+		v := uint32(1 << 16)
+		if c.DebugEn {
+			v |= 1
+		}
+		if c.Halted {
+			v |= 1<<1 | 1<<17
+		}
+		if c.resetSt {
+			v |= 1 << 25
+			c.resetSt = false
+		}
+		return v, true
+	case 0xE000EDF4:
+		return 0, true
+	case 0xE000EDF8:
+		return c.dcrdr, true
+	case 0xE000EDFC:
+		return c.DEMCR, true
+	}
+	return 0, false
+}
+
+func (c *CortexM) write(a, v uint32) bool {
+	switch a {
+	case 0xE000ED0C:
+		if v>>16 == 0x05FA && v&(1<<2) != 0 {
+			c.Resets++
+			c.resetSt = true
+			c.Halted = c.DebugEn && c.DEMCR&1 != 0
+		}
+	case 0xE000EDF0:
+		if v>>16 != 0xA05F {
+			// Writes without the key are ignored.
+			return true
+		}
+		c.DebugEn = v&1 != 0
+		c.Halted = c.DebugEn && v&(1<<1) != 0
+	case 0xE000EDF4:
+		r := v & 0x7F
+		if int(r) >= len(c.Regs) {
+			return true
+		}
+		if v&(1<<16) != 0 {
+			c.Regs[r] = c.dcrdr
+		} else {
+			c.dcrdr = c.Regs[r]
+		}
+	case 0xE000EDF8:
+		c.dcrdr = v
+	case 0xE000EDFC:
+		c.DEMCR = v
+	default:
+		return false
+	}
+	return true
+}
+
+var _ SWDAP = &MemAP{}
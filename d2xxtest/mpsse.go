@@ -0,0 +1,451 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"time"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/mpsse"
+)
+
+// mpsseEngine interprets the MPSSE commands written to a fake handle.
+//
+// Pins are a 16 bits bitmap where bits 0~7 are ADBUS0~7 and bits 8~15 are
+// ACBUS0~7. ADBUS0 is TCK, ADBUS1 is TDI, ADBUS2 is TDO and ADBUS3 is TMS.
+//
+// Replies are held in the chip buffer until a SendImmediate command, the
+// buffer is full or the latency timer expires.
+type mpsseEngine struct {
+	value     uint16
+	dir       uint16
+	in        uint16
+	openDrain uint16
+	loopback  bool
+	pending   []byte
+	held      []byte
+	heldAt    time.Time
+	reply     []byte
+
+	// clock is called on each TCK rising edge with the state of the pins and
+	// returns the level of the input pins after the following falling edge.
+	clock func(pins uint16) uint16
+	// set is called when the pins are changed by a GPIO command and returns
+	// the level of the input pins.
+	set func(pins uint16) uint16
+	// watch is called on each change of the pins driven, including each clock
+	// edge, and returns the level of all the pins.
+	watch func(value, drive uint16) uint16
+
+	// mcu is set in MCU host bus emulation mode, where busRead and busWrite
+	// are called for the bus cycles. addrHigh is the address high byte kept
+	// by the short address commands.
+	mcu      bool
+	addrHigh byte
+	busRead  func(addr uint16) byte
+	busWrite func(addr uint16, v byte)
+}
+
+const (
+	pinTCK = 1 << 0
+	pinTDI = 1 << 1
+	pinTDO = 1 << 2
+	pinTMS = 1 << 3
+)
+
+// chipBuffer is the size of the reply buffer, minus the two modem status
+// bytes of each USB packet.
+const chipBuffer = 510
+
+// drive returns the pins driven by the chip. Open drain outputs are only
+// driven low.
+func (m *mpsseEngine) drive() uint16 {
+	return m.dir &^ (m.openDrain & m.value)
+}
+
+// pins returns the current level of all the pins.
+//
+// Pins that are not driven by anything read as high, as if pulled up.
+func (m *mpsseEngine) pins() uint16 {
+	d := m.drive()
+	v := m.value&d | m.in&^d
+	if m.loopback {
+		// The loopback is internal; it works even if TDI is not an output.
+		v = v&^pinTDO | (m.value&pinTDI)<<1
+	}
+	return v
+}
+
+// reset clears the command processor state.
+func (m *mpsseEngine) reset() {
+	m.pending = nil
+	m.held = nil
+	m.reply = nil
+	m.loopback = false
+	m.openDrain = 0
+}
+
+// send queues reply bytes in the chip buffer.
+func (m *mpsseEngine) send(b ...byte) {
+	if len(m.held) == 0 {
+		m.heldAt = time.Now()
+	}
+	m.held = append(m.held, b...)
+	if len(m.held) >= chipBuffer {
+		m.flush()
+	}
+}
+
+// flush sends the chip buffer to the host.
+func (m *mpsseEngine) flush() {
+	m.reply = append(m.reply, m.held...)
+	m.held = nil
+}
+
+// expire flushes the chip buffer if the latency timer expired. A latency of 0
+// is the 16ms default.
+func (m *mpsseEngine) expire(latencyMS uint8) {
+	if latencyMS == 0 {
+		latencyMS = 16
+	}
+	if len(m.held) != 0 && time.Since(m.heldAt) >= time.Duration(latencyMS)*time.Millisecond {
+		m.flush()
+	}
+}
+
+// write processes commands. Incomplete commands are kept until more data is
+// written.
+func (m *mpsseEngine) write(b []byte) {
+	m.pending = append(m.pending, b...)
+	for len(m.pending) != 0 {
+		n := cmdLen(m.pending)
+		if m.mcu {
+			if l := mcuCmdLen(m.pending[0]); l != 0 {
+				n = l
+			}
+		}
+		if n < 0 {
+			m.send(mpsse.BadCommand, m.pending[0])
+			m.pending = m.pending[1:]
+			continue
+		}
+		if n > len(m.pending) {
+			return
+		}
+		m.run(m.pending[:n])
+		m.pending = m.pending[n:]
+	}
+}
+
+// cmdLen returns the length of the command at the start of b or -1 if the
+// opcode is invalid. The length may be larger than len(b) when more data is
+// needed.
+func cmdLen(b []byte) int {
+	op := b[0]
+	if op&0x80 == 0 {
+		switch {
+		case op&mpsse.TMSOut != 0:
+			if op&mpsse.BitMode == 0 || op&mpsse.DataOut != 0 {
+				return -1
+			}
+			return 3
+		case op&(mpsse.DataOut|mpsse.DataIn) == 0:
+			return -1
+		case op&mpsse.BitMode != 0:
+			if op&mpsse.DataOut != 0 {
+				return 3
+			}
+			return 2
+		default:
+			if op&mpsse.DataOut == 0 {
+				return 3
+			}
+			if len(b) < 3 {
+				return 3
+			}
+			return 3 + int(b[1]) + int(b[2])<<8 + 1
+		}
+	}
+	switch op {
+	case mpsse.GPIOSetLow, mpsse.GPIOSetHigh, mpsse.ClockDivisor, mpsse.ClockBytes, 0x9C, 0x9D, mpsse.OpenDrain:
+		return 3
+	case mpsse.ClockBits:
+		return 2
+	case mpsse.GPIOGetLow, mpsse.GPIOGetHigh, mpsse.LoopbackOn, mpsse.LoopbackOff,
+		mpsse.SendImmediate, mpsse.WaitHigh, mpsse.WaitLow, mpsse.ClockDiv5Off,
+		mpsse.ClockDiv5On, mpsse.ThreePhaseOn, mpsse.ThreePhaseOff,
+		mpsse.ClockUntilHigh, mpsse.ClockUntilLow, mpsse.AdaptiveOn,
+		mpsse.AdaptiveOff:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// mcuCmdLen returns the length of a MCU host bus command, or 0.
+func mcuCmdLen(op byte) int {
+	switch op {
+	case mpsse.MCURead:
+		return 2
+	case mpsse.MCUReadExt, mpsse.MCUWrite:
+		return 3
+	case mpsse.MCUWriteExt:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// run executes a single complete command.
+func (m *mpsseEngine) run(c []byte) {
+	op := c[0]
+	switch op {
+	case mpsse.GPIOSetLow:
+		m.value = m.value&0xFF00 | uint16(c[1])
+		m.dir = m.dir&0xFF00 | uint16(c[2])
+		m.update()
+	case mpsse.GPIOSetHigh:
+		m.value = m.value&0x00FF | uint16(c[1])<<8
+		m.dir = m.dir&0x00FF | uint16(c[2])<<8
+		m.update()
+	case mpsse.GPIOGetLow:
+		m.send(byte(m.pins()))
+	case mpsse.GPIOGetHigh:
+		m.send(byte(m.pins() >> 8))
+	case mpsse.LoopbackOn:
+		m.loopback = true
+	case mpsse.LoopbackOff:
+		m.loopback = false
+	case mpsse.SendImmediate:
+		m.flush()
+	case mpsse.OpenDrain:
+		m.openDrain = uint16(c[1]) | uint16(c[2])<<8
+		m.notify()
+	case mpsse.ClockBits:
+		for i := 0; i <= int(c[1]); i++ {
+			m.cycle()
+		}
+	case mpsse.ClockBytes:
+		n := (int(c[1]) | int(c[2])<<8 + 1) * 8
+		for i := 0; i < n; i++ {
+			m.cycle()
+		}
+	case mpsse.MCURead:
+		m.send(m.busCycle(m.addrHigh, c[1], false, 0))
+	case mpsse.MCUReadExt:
+		m.send(m.busCycle(c[1], c[2], false, 0))
+	case mpsse.MCUWrite:
+		m.busCycle(m.addrHigh, c[1], true, c[2])
+	case mpsse.MCUWriteExt:
+		m.busCycle(c[1], c[2], true, c[3])
+	default:
+		if op&0x80 == 0 {
+			m.shift(c)
+		}
+		// Other commands only change the timing, which is not simulated.
+	}
+}
+
+// shift executes a data shifting or TMS command.
+//
+// Each bit is a clock cycle made of two edges, the first one leaving the idle
+// level of TCK/SK. The output is set up before the cycle when it changes on
+// the second edge, and the input is sampled just before its edge.
+func (m *mpsseEngine) shift(c []byte) {
+	op := c[0]
+	lsb := op&mpsse.LSBFirst != 0
+	write := op&mpsse.DataOut != 0
+	read := op&mpsse.DataIn != 0
+	pin := uint16(pinTDI)
+	var out []byte
+	var n int
+	switch {
+	case op&mpsse.TMSOut != 0:
+		n = int(c[1]) + 1
+		m.setPin(pinTDI, c[2]&0x80 != 0)
+		m.notify()
+		pin, out, write, lsb = pinTMS, c[2:3], true, true
+	case op&mpsse.BitMode != 0:
+		n = int(c[1]) + 1
+		if write {
+			out = c[2:3]
+		}
+	default:
+		n = (int(c[1]) | int(c[2])<<8 + 1) * 8
+		if write {
+			out = c[3:]
+		}
+	}
+	bit := func(i int) bool {
+		if lsb {
+			return out[i/8]>>uint(i%8)&1 != 0
+		}
+		return out[i/8]>>uint(7-i%8)&1 != 0
+	}
+	// The first edge is falling when the clock idles high.
+	idleHigh := m.value&pinTCK != 0
+	writeFirst := (op&mpsse.WriteFalling != 0) == idleHigh
+	readFirst := (op&mpsse.ReadFalling != 0) == idleHigh
+	var r byte
+	for i := 0; i < n; i++ {
+		if write && !writeFirst && i == 0 {
+			m.setPin(pin, bit(0))
+			m.notify()
+		}
+		var s byte
+		if readFirst {
+			s = m.tdo()
+		}
+		m.edge()
+		if write && writeFirst {
+			m.setPin(pin, bit(i))
+			m.notify()
+		}
+		if !readFirst {
+			s = m.tdo()
+		}
+		m.edge()
+		if write && !writeFirst && i+1 < n {
+			m.setPin(pin, bit(i+1))
+			m.notify()
+		}
+		if lsb {
+			r = r>>1 | s<<7
+		} else {
+			r = r<<1 | s
+		}
+		if read && op&(mpsse.BitMode|mpsse.TMSOut) == 0 && i%8 == 7 {
+			m.send(r)
+			r = 0
+		}
+	}
+	if read && op&(mpsse.BitMode|mpsse.TMSOut) != 0 {
+		m.send(r)
+	}
+}
+
+// tdo returns the level of TDO/DI.
+func (m *mpsseEngine) tdo() byte {
+	return byte(m.pins()>>2) & 1
+}
+
+// cycle clocks one TCK cycle.
+func (m *mpsseEngine) cycle() {
+	m.edge()
+	m.edge()
+}
+
+// edge toggles TCK. The clock callback is called on the rising edges.
+func (m *mpsseEngine) edge() {
+	m.value ^= pinTCK
+	if m.value&pinTCK != 0 && m.clock != nil {
+		m.in = m.clock(m.pins())
+	}
+	m.notify()
+}
+
+// notify reports a change of the pins driven.
+func (m *mpsseEngine) notify() {
+	if m.watch != nil {
+		d := m.drive()
+		m.in = m.watch(m.value&d, d)
+	}
+}
+
+// busCycle runs a MCU host bus read or write cycle.
+//
+// Unconnected data lines read as 0xFF.
+func (m *mpsseEngine) busCycle(hi, lo byte, write bool, v byte) byte {
+	m.addrHigh = hi
+	addr := uint16(hi)<<8 | uint16(lo)
+	if write {
+		if m.busWrite != nil {
+			m.busWrite(addr, v)
+		}
+		return 0
+	}
+	if m.busRead != nil {
+		return m.busRead(addr)
+	}
+	return 0xFF
+}
+
+func (m *mpsseEngine) setPin(p uint16, level bool) {
+	if level {
+		m.value |= p
+	} else {
+		m.value &^= p
+	}
+}
+
+func (m *mpsseEngine) update() {
+	if m.set != nil {
+		m.in = m.set(m.pins())
+	}
+	m.notify()
+}
+
+// mpsseHandle is a fake FT232H that interprets the MPSSE commands written to
+// it.
+type mpsseHandle struct {
+	Fake
+	e mpsseEngine
+}
+
+func newMPSSEHandle() mpsseHandle {
+	return mpsseHandle{
+		Fake: Fake{DevType: d2xx.Device232H, Vid: 0x0403, Pid: 0x6014},
+		e:    mpsseEngine{in: 0xFFFF},
+	}
+}
+
+// ResetDevice implements d2xx.Handle.
+func (m *mpsseHandle) ResetDevice() d2xx.Err {
+	if e := m.Fake.ResetDevice(); e != 0 {
+		return e
+	}
+	m.e.reset()
+	return 0
+}
+
+// GetQueueStatus implements d2xx.Handle.
+func (m *mpsseHandle) GetQueueStatus() (uint32, d2xx.Err) {
+	if m.Closed {
+		return 0, invalidHandle
+	}
+	m.e.expire(m.Latency)
+	return uint32(len(m.e.reply)), 0
+}
+
+// Read implements d2xx.Handle.
+func (m *mpsseHandle) Read(b []byte) (int, d2xx.Err) {
+	if m.Closed {
+		return 0, invalidHandle
+	}
+	m.e.expire(m.Latency)
+	n := copy(b, m.e.reply)
+	m.e.reply = m.e.reply[n:]
+	return n, 0
+}
+
+// Write implements d2xx.Handle.
+func (m *mpsseHandle) Write(b []byte) (int, d2xx.Err) {
+	if m.Closed {
+		return 0, invalidHandle
+	}
+	m.Fake.Write(b)
+	m.e.write(b)
+	return len(b), 0
+}
+
+// SetBitMode implements d2xx.Handle.
+func (m *mpsseHandle) SetBitMode(mask, mode byte) d2xx.Err {
+	if e := m.Fake.SetBitMode(mask, mode); e != 0 {
+		return e
+	}
+	m.e.reset()
+	m.e.mcu = mode == d2xx.BitModeMCUHost
+	return 0
+}
@@ -0,0 +1,410 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"sync"
+	"time"
+
+	"periph.io/x/d2xx"
+)
+
+// Modem and line status bits returned by Serial.GetModemStatus, as returned
+// by FT_GetModemStatus.
+const (
+	ModemCTS uint32 = 0x10
+	ModemDSR uint32 = 0x20
+	ModemRI  uint32 = 0x40
+	ModemDCD uint32 = 0x80
+
+	LineOverrun uint32 = 0x0200
+	LineParity  uint32 = 0x0400
+	LineFraming uint32 = 0x0800
+	LineBreak   uint32 = 0x1000
+)
+
+// Parity values for Serial.SetDataCharacteristics, as FT_PARITY_*.
+const (
+	ParityNone  byte = 0
+	ParityOdd   byte = 1
+	ParityEven  byte = 2
+	ParityMark  byte = 3
+	ParitySpace byte = 4
+)
+
+// NullModemOpts is the configuration of NewNullModem.
+type NullModemOpts struct {
+	// Pace delays each byte by its duration on the line at the sender's baud
+	// rate. When false, bytes are received as soon as they are written.
+	Pace bool
+	// DevType defaults to d2xx.Device232R.
+	DevType uint32
+}
+
+// Serial is one end of a simulated null-modem cable between two UARTs.
+//
+// Bytes written on one end are received by the other. The modem lines are
+// cross-wired: RTS drives the peer's CTS, DTR drives the peer's DSR and DCD.
+// The line settings default to 9600 bauds, 8 data bits, no parity and 1 stop
+// bit. When the settings of the two ends differ, the bytes received are
+// flagged with a framing or parity error in the line status and, when the
+// error character is enabled with SetChars, replaced with it.
+//
+// d2xx.Handle has no modem line control, so it is provided by the methods
+// named after the D2XX functions.
+//
+// It is safe for concurrent use, both ends being typically used by different
+// goroutines.
+type Serial struct {
+	Fake
+	// DataBits, StopBits and Parity are the last values passed to
+	// SetDataCharacteristics.
+	DataBits byte
+	StopBits byte
+	Parity   byte
+
+	l    *link
+	peer *Serial
+	rx   []serialByte
+	// busy is when the transmitter is done with the bytes written so far.
+	busy       time.Time
+	rts, dtr   bool
+	brk        bool
+	lineStatus uint32
+}
+
+// NewNullModem returns the two ends of a null-modem cable.
+func NewNullModem(opts *NullModemOpts) (*Serial, *Serial) {
+	o := NullModemOpts{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.DevType == 0 {
+		o.DevType = d2xx.Device232R
+	}
+	l := &link{pace: o.Pace}
+	a := &Serial{l: l}
+	b := &Serial{l: l}
+	a.peer, b.peer = b, a
+	for _, s := range []*Serial{a, b} {
+		s.Fake = Fake{DevType: o.DevType, Vid: 0x0403, Pid: 0x6001, Baud: 9600}
+		s.DataBits = 8
+	}
+	return a, b
+}
+
+// SetDataCharacteristics sets the data bits (7 or 8), the stop bits (0 for 1
+// stop bit, 2 for 2 stop bits, as FT_STOP_BITS_*) and the parity.
+func (s *Serial) SetDataCharacteristics(bits, stop, parity byte) d2xx.Err {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	if s.Closed {
+		return invalidHandle
+	}
+	if (bits != 7 && bits != 8) || (stop != 0 && stop != 2) || parity > ParitySpace {
+		return invalidParameter
+	}
+	s.DataBits, s.StopBits, s.Parity = bits, stop, parity
+	return 0
+}
+
+// SetRTS sets the RTS line, seen as CTS by the peer.
+func (s *Serial) SetRTS(on bool) d2xx.Err {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	if s.Closed {
+		return invalidHandle
+	}
+	s.rts = on
+	return 0
+}
+
+// SetDTR sets the DTR line, seen as DSR and DCD by the peer.
+func (s *Serial) SetDTR(on bool) d2xx.Err {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	if s.Closed {
+		return invalidHandle
+	}
+	s.dtr = on
+	return 0
+}
+
+// SetBreak holds the TX line low, or releases it.
+//
+// The peer receives a 0 byte flagged with LineBreak when the break starts.
+func (s *Serial) SetBreak(on bool) d2xx.Err {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	if s.Closed {
+		return invalidHandle
+	}
+	if on && !s.brk {
+		s.send(serialByte{err: LineBreak | LineFraming})
+	}
+	s.brk = on
+	return 0
+}
+
+// GetModemStatus returns the modem status in the low byte and the line status
+// in the second byte.
+//
+// The line status accumulates the errors of the bytes received so far,
+// including those still in the receive queue, and is cleared by the call.
+func (s *Serial) GetModemStatus() (uint32, d2xx.Err) {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	if s.Closed {
+		return 0, invalidHandle
+	}
+	for i, n := 0, s.arrived(time.Now()); i < n; i++ {
+		s.lineStatus |= s.rx[i].err
+		s.rx[i].err = 0
+	}
+	v := s.lineStatus
+	s.lineStatus = 0
+	if p := s.peer; !p.Closed {
+		if p.rts {
+			v |= ModemCTS
+		}
+		if p.dtr {
+			v |= ModemDSR | ModemDCD
+		}
+	}
+	return v, 0
+}
+
+// Close implements d2xx.Handle.
+//
+// The peer sees the modem lines drop.
+func (s *Serial) Close() d2xx.Err {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	return s.Fake.Close()
+}
+
+// ResetDevice implements d2xx.Handle.
+//
+// It discards the bytes received.
+func (s *Serial) ResetDevice() d2xx.Err {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	if e := s.Fake.ResetDevice(); e != 0 {
+		return e
+	}
+	s.rx = nil
+	s.lineStatus = 0
+	return 0
+}
+
+// SetChars implements d2xx.Handle.
+func (s *Serial) SetChars(eventChar byte, eventEn bool, errorChar byte, errorEn bool) d2xx.Err {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	return s.Fake.SetChars(eventChar, eventEn, errorChar, errorEn)
+}
+
+// SetFlowControl implements d2xx.Handle.
+//
+// With RTS/CTS flow control, writes stall while the peer's RTS is low.
+func (s *Serial) SetFlowControl() d2xx.Err {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	return s.Fake.SetFlowControl()
+}
+
+// SetTimeouts implements d2xx.Handle.
+func (s *Serial) SetTimeouts(readMS, writeMS int) d2xx.Err {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	return s.Fake.SetTimeouts(readMS, writeMS)
+}
+
+// SetBaudRate implements d2xx.Handle.
+func (s *Serial) SetBaudRate(hz uint32) d2xx.Err {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	if hz == 0 {
+		return invalidParameter
+	}
+	return s.Fake.SetBaudRate(hz)
+}
+
+// GetQueueStatus implements d2xx.Handle.
+func (s *Serial) GetQueueStatus() (uint32, d2xx.Err) {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	if s.Closed {
+		return 0, invalidHandle
+	}
+	return uint32(s.arrived(time.Now())), 0
+}
+
+// Read implements d2xx.Handle.
+//
+// It waits up to the read timeout for the buffer to be filled. A timeout of 0
+// returns the bytes already received.
+func (s *Serial) Read(b []byte) (int, d2xx.Err) {
+	s.l.mu.Lock()
+	deadline := time.Now().Add(time.Duration(s.ReadTimeout) * time.Millisecond)
+	s.l.mu.Unlock()
+	n := 0
+	for {
+		s.l.mu.Lock()
+		if s.Closed {
+			s.l.mu.Unlock()
+			return n, invalidHandle
+		}
+		now := time.Now()
+		a := s.arrived(now)
+		for ; a > 0 && n < len(b); a-- {
+			r := s.rx[0]
+			s.rx = s.rx[1:]
+			s.lineStatus |= r.err
+			b[n] = r.data
+			n++
+		}
+		s.l.mu.Unlock()
+		if n == len(b) || !now.Before(deadline) {
+			return n, 0
+		}
+		time.Sleep(s.l.poll(deadline.Sub(now)))
+	}
+}
+
+// Write implements d2xx.Handle.
+//
+// With flow control enabled, it waits up to the write timeout for the CTS
+// line, and returns the number of bytes sent before the timeout.
+func (s *Serial) Write(b []byte) (int, d2xx.Err) {
+	s.l.mu.Lock()
+	// Record the write once, even if it is sent in several polls.
+	if _, e := s.Fake.Write(b); e != 0 {
+		s.l.mu.Unlock()
+		return 0, e
+	}
+	deadline := time.Now().Add(time.Duration(s.WriteTimeout) * time.Millisecond)
+	s.l.mu.Unlock()
+	n := 0
+	for {
+		s.l.mu.Lock()
+		if s.Closed {
+			s.l.mu.Unlock()
+			return n, invalidHandle
+		}
+		for ; n < len(b) && (!s.FlowControl || s.peer.rts); n++ {
+			s.send(serialByte{data: b[n]})
+		}
+		s.l.mu.Unlock()
+		now := time.Now()
+		if n == len(b) || !now.Before(deadline) {
+			return n, 0
+		}
+		time.Sleep(s.l.poll(deadline.Sub(now)))
+	}
+}
+
+//
+
+// invalidParameter is FT_INVALID_PARAMETER.
+const invalidParameter d2xx.Err = 6
+
+// link is the state shared by the two ends of the cable.
+type link struct {
+	mu   sync.Mutex
+	pace bool
+}
+
+// poll returns how long to wait before checking again.
+func (l *link) poll(left time.Duration) time.Duration {
+	if d := 100 * time.Microsecond; left > d {
+		return d
+	}
+	return left
+}
+
+// serialByte is a byte on the line.
+type serialByte struct {
+	data byte
+	// at is when the byte is fully received.
+	at  time.Time
+	err uint32
+}
+
+// bits returns the number of bits of a character, including the start bit.
+func (s *Serial) bits() int {
+	n := 1 + int(s.DataBits) + 1
+	if s.Parity != ParityNone {
+		n++
+	}
+	if s.StopBits == 2 {
+		n++
+	}
+	return n
+}
+
+// send transmits a byte to the peer. It must be called with the lock held.
+func (s *Serial) send(c serialByte) {
+	p := s.peer
+	now := time.Now()
+	c.at = now
+	if s.l.pace {
+		if s.busy.After(c.at) {
+			c.at = s.busy
+		}
+		c.at = c.at.Add(time.Duration(s.bits()) * time.Second / time.Duration(s.Baud))
+		s.busy = c.at
+	}
+	if p.Closed || s.brk {
+		return
+	}
+	if c.err == 0 {
+		c.err = s.mismatch(p)
+	}
+	if c.err&(LineFraming|LineParity) != 0 && p.ErrorEnabled {
+		c.data = p.ErrorChar
+	}
+	if p.DataBits == 7 {
+		c.data &= 0x7F
+	}
+	if len(p.rx) >= 65536 {
+		p.lineStatus |= LineOverrun
+		return
+	}
+	p.rx = append(p.rx, c)
+}
+
+// mismatch returns the line errors seen by the receiver p of a byte sent by s.
+func (s *Serial) mismatch(p *Serial) uint32 {
+	// UARTs tolerate a few percent of baud rate difference.
+	d := int64(s.Baud) - int64(p.Baud)
+	if d < 0 {
+		d = -d
+	}
+	if d*100 > int64(p.Baud)*3 || s.DataBits != p.DataBits {
+		return LineFraming
+	}
+	if s.Parity != p.Parity {
+		if p.Parity == ParityNone {
+			// The parity bit is sampled as the stop bit.
+			return LineFraming
+		}
+		return LineParity
+	}
+	if p.StopBits > s.StopBits {
+		return LineFraming
+	}
+	return 0
+}
+
+// arrived returns the number of bytes fully received at now.
+func (s *Serial) arrived(now time.Time) int {
+	n := 0
+	for ; n < len(s.rx) && !s.rx[n].at.After(now); n++ {
+	}
+	return n
+}
+
+var _ d2xx.Handle = &Serial{}
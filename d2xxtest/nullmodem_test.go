@@ -0,0 +1,184 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"periph.io/x/d2xx/d2xxtest"
+)
+
+func TestNullModem(t *testing.T) {
+	a, b := d2xxtest.NewNullModem(nil)
+	if n, e := a.Write([]byte("hello")); n != 5 || e != 0 {
+		t.Fatal(n, e)
+	}
+	if n, e := b.GetQueueStatus(); n != 5 || e != 0 {
+		t.Fatal(n, e)
+	}
+	buf := make([]byte, 8)
+	if n, e := b.Read(buf); n != 5 || e != 0 || string(buf[:n]) != "hello" {
+		t.Fatal(n, e, buf)
+	}
+	if s, _ := b.GetModemStatus(); s != 0 {
+		t.Fatalf("%#x", s)
+	}
+	// Nothing echoed back.
+	if n, _ := a.GetQueueStatus(); n != 0 {
+		t.Fatal(n)
+	}
+}
+
+func TestNullModem_modemLines(t *testing.T) {
+	a, b := d2xxtest.NewNullModem(nil)
+	a.SetRTS(true)
+	if s, _ := b.GetModemStatus(); s != d2xxtest.ModemCTS {
+		t.Fatalf("%#x", s)
+	}
+	a.SetRTS(false)
+	a.SetDTR(true)
+	if s, _ := b.GetModemStatus(); s != d2xxtest.ModemDSR|d2xxtest.ModemDCD {
+		t.Fatalf("%#x", s)
+	}
+	if s, _ := a.GetModemStatus(); s != 0 {
+		t.Fatalf("%#x", s)
+	}
+	a.Close()
+	if s, _ := b.GetModemStatus(); s != 0 {
+		t.Fatalf("%#x", s)
+	}
+}
+
+func TestNullModem_flowControl(t *testing.T) {
+	a, b := d2xxtest.NewNullModem(nil)
+	a.SetFlowControl()
+	a.SetTimeouts(0, 10)
+	if n, e := a.Write([]byte{1, 2}); n != 0 || e != 0 {
+		t.Fatal(n, e)
+	}
+	b.SetRTS(true)
+	if n, e := a.Write([]byte{1, 2}); n != 2 || e != 0 {
+		t.Fatal(n, e)
+	}
+	// Each Write is recorded once, even when blocked.
+	if len(a.Writes) != 2 {
+		t.Fatalf("%d writes recorded", len(a.Writes))
+	}
+}
+
+func TestNullModem_mismatch(t *testing.T) {
+	data := []struct {
+		name   string
+		set    func(a, b *d2xxtest.Serial)
+		status uint32
+		want   byte
+	}{
+		{
+			"baud",
+			func(a, b *d2xxtest.Serial) { b.SetBaudRate(115200) },
+			d2xxtest.LineFraming,
+			'x',
+		},
+		{
+			"baud_tolerance",
+			func(a, b *d2xxtest.Serial) { a.SetBaudRate(9700) },
+			0,
+			'x',
+		},
+		{
+			"parity",
+			func(a, b *d2xxtest.Serial) {
+				a.SetDataCharacteristics(8, 0, d2xxtest.ParityOdd)
+				b.SetDataCharacteristics(8, 0, d2xxtest.ParityEven)
+			},
+			d2xxtest.LineParity,
+			'x',
+		},
+		{
+			"unexpected_parity",
+			func(a, b *d2xxtest.Serial) { a.SetDataCharacteristics(8, 0, d2xxtest.ParityEven) },
+			d2xxtest.LineFraming,
+			'x',
+		},
+		{
+			"stop_bits",
+			func(a, b *d2xxtest.Serial) { b.SetDataCharacteristics(8, 2, d2xxtest.ParityNone) },
+			d2xxtest.LineFraming,
+			'x',
+		},
+		{
+			"error_char",
+			func(a, b *d2xxtest.Serial) {
+				a.SetDataCharacteristics(7, 0, d2xxtest.ParityNone)
+				b.SetChars(0, false, '?', true)
+			},
+			d2xxtest.LineFraming,
+			'?',
+		},
+	}
+	for _, line := range data {
+		t.Run(line.name, func(t *testing.T) {
+			a, b := d2xxtest.NewNullModem(nil)
+			line.set(a, b)
+			a.Write([]byte{'x'})
+			if s, _ := b.GetModemStatus(); s != line.status {
+				t.Fatalf("%#x", s)
+			}
+			// The status is cleared once read.
+			if s, _ := b.GetModemStatus(); s != 0 {
+				t.Fatalf("%#x", s)
+			}
+			var buf [1]byte
+			if n, _ := b.Read(buf[:]); n != 1 || buf[0] != line.want {
+				t.Fatal(n, buf)
+			}
+		})
+	}
+	a, _ := d2xxtest.NewNullModem(nil)
+	if e := a.SetDataCharacteristics(9, 0, 0); e == 0 {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNullModem_break(t *testing.T) {
+	a, b := d2xxtest.NewNullModem(nil)
+	a.SetBreak(true)
+	// Lost during the break.
+	a.Write([]byte{1})
+	a.SetBreak(false)
+	a.Write([]byte{2})
+	buf := make([]byte, 4)
+	if n, _ := b.Read(buf); n != 2 || !bytes.Equal(buf[:n], []byte{0, 2}) {
+		t.Fatal(n, buf)
+	}
+	if s, _ := b.GetModemStatus(); s != d2xxtest.LineBreak|d2xxtest.LineFraming {
+		t.Fatalf("%#x", s)
+	}
+}
+
+func TestNullModem_pace(t *testing.T) {
+	a, b := d2xxtest.NewNullModem(&d2xxtest.NullModemOpts{Pace: true})
+	a.SetBaudRate(100000)
+	b.SetBaudRate(100000)
+	b.SetTimeouts(1000, 0)
+	// 100 bytes of 10 bits take 10ms.
+	start := time.Now()
+	a.Write(make([]byte, 100))
+	if n, _ := b.GetQueueStatus(); n == 100 {
+		t.Fatal("not paced")
+	}
+	buf := make([]byte, 100)
+	if n, e := b.Read(buf); n != 100 || e != 0 {
+		t.Fatal(n, e)
+	}
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Fatal(d)
+	}
+	if s, _ := b.GetModemStatus(); s != 0 {
+		t.Fatalf("%#x", s)
+	}
+}
@@ -0,0 +1,376 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/mpsse"
+)
+
+// Peripheral is a simulated device connected to the pins of a MPSSE fake.
+//
+// Pins are a 16 bits bitmap where bit n is mpsse.Pin(n).
+type Peripheral interface {
+	// Update is called each time the level of the pins may have changed and
+	// returns the level of the pins driven by the peripheral.
+	//
+	// It may be called several times with the same levels until the bus
+	// settles, so edges must be detected against the previous levels.
+	Update(pins uint16) (value, drive uint16)
+}
+
+// MPSSE is a fake d2xx.Handle that interprets the MPSSE commands written to
+// it and drives simulated peripherals connected to its pins.
+//
+// The bus is wired-AND: a pin is low if any of the chip or the peripherals
+// drive it low, and is pulled up when nothing drives it. The chip only drives
+// low the pins configured as open drain with the OpenDrain command.
+type MPSSE struct {
+	mpsseHandle
+	// Peripherals are the devices connected to the pins.
+	Peripherals []Peripheral
+
+	nets  []uint16
+	out   []pinDrive
+	level uint16
+}
+
+// NewMPSSE returns a simulated FT232H connected to peripherals.
+func NewMPSSE(p ...Peripheral) *MPSSE {
+	m := &MPSSE{mpsseHandle: newMPSSEHandle(), Peripherals: p, level: 0xFFFF}
+	m.e.watch = m.resolve
+	return m
+}
+
+// Tie connects pins together, like ADBUS1 and ADBUS2 for I²C SDA.
+func (m *MPSSE) Tie(pins ...mpsse.Pin) {
+	var n uint16
+	for _, p := range pins {
+		n |= 1 << p
+	}
+	m.nets = append(m.nets, n)
+	m.e.in = m.resolve(m.e.value&m.e.drive(), m.e.drive())
+}
+
+// Pins returns the level of the pins.
+func (m *MPSSE) Pins() uint16 {
+	return m.level
+}
+
+//
+
+// pinDrive is the output of a peripheral.
+type pinDrive struct {
+	value, drive uint16
+}
+
+// resolve settles the bus and returns the level of the pins.
+func (m *MPSSE) resolve(value, drive uint16) uint16 {
+	if len(m.out) != len(m.Peripherals) {
+		m.out = make([]pinDrive, len(m.Peripherals))
+	}
+	l := m.wired(value, drive)
+	for i := 0; i < 16; i++ {
+		for j, p := range m.Peripherals {
+			m.out[j].value, m.out[j].drive = p.Update(l)
+		}
+		n := m.wired(value, drive)
+		if n == l {
+			break
+		}
+		l = n
+	}
+	m.level = l
+	return l
+}
+
+// wired returns the level of the pins with the current outputs.
+func (m *MPSSE) wired(value, drive uint16) uint16 {
+	l := value | ^drive
+	for _, o := range m.out {
+		l &= o.value | ^o.drive
+	}
+	for _, n := range m.nets {
+		if l&n != n {
+			l &^= n
+		}
+	}
+	return l
+}
+
+// SPIDevice is a simulated SPI device.
+//
+// The chip select is active low. Only full bytes are recorded.
+type SPIDevice struct {
+	CLK, MOSI, MISO, CS mpsse.Pin
+	// Mode is the SPI mode 0~3; bit 1 is CPOL, bit 0 is CPHA.
+	Mode int
+	// LSBFirst shifts the least significant bit first.
+	LSBFirst bool
+	// Reply returns the byte to shift out on MISO, given the bytes received
+	// so far in the transaction. If nil, MISO is not driven and reads high.
+	Reply func(rx []byte) byte
+
+	// Transactions are the bytes received, one slice per selection.
+	Transactions [][]byte
+
+	prev     uint16
+	started  bool
+	selected bool
+	bit      int
+	rx, tx   byte
+	miso     bool
+}
+
+// Update implements Peripheral.
+func (s *SPIDevice) Update(pins uint16) (uint16, uint16) {
+	prev := s.prev
+	if !s.started {
+		prev = pins
+		s.started = true
+	}
+	s.prev = pins
+	sel := pins&(1<<s.CS) == 0
+	if sel && (!s.selected || prev&(1<<s.CS) != 0) {
+		s.selected = true
+		s.Transactions = append(s.Transactions, []byte{})
+		s.bit, s.rx = 0, 0
+		s.load()
+		if s.Mode&1 == 0 {
+			s.out()
+		}
+	} else if !sel {
+		s.selected = false
+	}
+	if s.selected && (pins^prev)&(1<<s.CLK) != 0 {
+		clk := pins&(1<<s.CLK) != 0
+		leading := clk != (s.Mode&2 != 0)
+		if leading == (s.Mode&1 == 0) {
+			s.sample(pins&(1<<s.MOSI) != 0)
+		} else {
+			s.out()
+		}
+	}
+	if !s.selected || s.Reply == nil {
+		return 0, 0
+	}
+	m := uint16(1) << s.MISO
+	if s.miso {
+		return m, m
+	}
+	return 0, m
+}
+
+func (s *SPIDevice) load() {
+	if s.Reply != nil {
+		t := s.Transactions[len(s.Transactions)-1]
+		s.tx = s.Reply(append([]byte(nil), t...))
+	}
+}
+
+// out drives the current bit on MISO.
+func (s *SPIDevice) out() {
+	if s.LSBFirst {
+		s.miso = s.tx>>uint(s.bit)&1 != 0
+	} else {
+		s.miso = s.tx>>uint(7-s.bit)&1 != 0
+	}
+}
+
+// sample reads a bit from MOSI.
+func (s *SPIDevice) sample(v bool) {
+	b := byte(0)
+	if v {
+		b = 1
+	}
+	if s.LSBFirst {
+		s.rx |= b << uint(s.bit)
+	} else {
+		s.rx |= b << uint(7-s.bit)
+	}
+	if s.bit++; s.bit == 8 {
+		i := len(s.Transactions) - 1
+		s.Transactions[i] = append(s.Transactions[i], s.rx)
+		s.bit, s.rx = 0, 0
+		s.load()
+	}
+}
+
+// I2CTransfer is a transfer addressed to an I2CDevice.
+type I2CTransfer struct {
+	Read bool
+	Data []byte
+}
+
+// I2CDevice is a simulated I²C target.
+type I2CDevice struct {
+	// Addr is the 7 bits address.
+	Addr     uint8
+	SCL, SDA mpsse.Pin
+	// Receive is called with each byte written and returns whether it is
+	// acknowledged. If nil, all the bytes are acknowledged.
+	Receive func(b byte) bool
+	// Send returns the next byte to be read. If nil, 0xFF is read.
+	Send func() byte
+
+	// Transfers are the transfers addressed to the device.
+	Transfers []I2CTransfer
+
+	prev    uint16
+	started bool
+	state   int
+	bit     int
+	sr      byte
+	ack     bool
+	sda     bool
+}
+
+// I2C target states.
+const (
+	i2cIdle = iota
+	i2cAddr
+	i2cWrite
+	i2cRead
+)
+
+// Update implements Peripheral.
+func (d *I2CDevice) Update(pins uint16) (uint16, uint16) {
+	prev := d.prev
+	if !d.started {
+		prev = pins
+		d.started = true
+	}
+	d.prev = pins
+	scl, sda := uint16(1)<<d.SCL, uint16(1)<<d.SDA
+	switch {
+	case prev&scl != 0 && pins&scl != 0 && prev&sda != 0 && pins&sda == 0:
+		// Start or repeated start.
+		d.state, d.bit, d.sr, d.sda = i2cAddr, 0, 0, false
+	case prev&scl != 0 && pins&scl != 0 && prev&sda == 0 && pins&sda != 0:
+		// Stop.
+		d.state, d.sda = i2cIdle, false
+	case prev&scl == 0 && pins&scl != 0:
+		d.rising(pins&sda != 0)
+	case prev&scl != 0 && pins&scl == 0:
+		d.falling()
+	}
+	if d.sda {
+		return 0, sda
+	}
+	return 0, 0
+}
+
+func (d *I2CDevice) rising(sda bool) {
+	if d.state == i2cIdle {
+		return
+	}
+	if d.bit < 8 && d.state != i2cRead {
+		d.sr <<= 1
+		if sda {
+			d.sr |= 1
+		}
+	}
+	if d.bit == 8 && d.state == i2cRead {
+		// The controller acknowledges with a low level.
+		d.ack = !sda
+	}
+	d.bit++
+}
+
+func (d *I2CDevice) falling() {
+	switch {
+	case d.state == i2cIdle:
+	case d.bit == 8 && d.state == i2cAddr:
+		d.ack = d.sr>>1 == d.Addr
+		if d.ack {
+			d.Transfers = append(d.Transfers, I2CTransfer{Read: d.sr&1 != 0})
+		}
+		d.sda = d.ack
+	case d.bit == 8 && d.state == i2cWrite:
+		t := &d.Transfers[len(d.Transfers)-1]
+		t.Data = append(t.Data, d.sr)
+		d.ack = d.Receive == nil || d.Receive(d.sr)
+		d.sda = d.ack
+	case d.bit == 8 && d.state == i2cRead:
+		// Release SDA for the controller acknowledge.
+		d.sda = false
+	case d.bit == 9:
+		d.bit, d.sda = 0, false
+		switch {
+		case !d.ack:
+			d.state = i2cIdle
+		case d.state == i2cAddr && d.Transfers[len(d.Transfers)-1].Read, d.state == i2cRead:
+			d.state = i2cRead
+			d.sr = 0xFF
+			if d.Send != nil {
+				d.sr = d.Send()
+			}
+			t := &d.Transfers[len(d.Transfers)-1]
+			t.Data = append(t.Data, d.sr)
+			d.sda = d.sr&0x80 == 0
+		default:
+			d.state, d.sr = i2cWrite, 0
+		}
+	case d.state == i2cRead:
+		d.sda = d.sr>>uint(7-d.bit)&1 == 0
+	}
+}
+
+// TAPChain connects a chain of simulated TAPs to JTAG pins.
+type TAPChain struct {
+	TCK, TDI, TDO, TMS mpsse.Pin
+	// TAPs is the chain, listed from the one closest to TDO to the one closest
+	// to TDI, like jtag.Controller.Devices.
+	TAPs []*TAP
+
+	prev    uint16
+	started bool
+	tdo     bool
+}
+
+// NewTAPChain returns a chain on the standard MPSSE JTAG pins: ADBUS0 is TCK,
+// ADBUS1 is TDI, ADBUS2 is TDO and ADBUS3 is TMS.
+//
+// All the TAPs are reset.
+func NewTAPChain(taps ...*TAP) *TAPChain {
+	for _, t := range taps {
+		t.Reset()
+	}
+	return &TAPChain{TCK: mpsse.ADBUS0, TDI: mpsse.ADBUS1, TDO: mpsse.ADBUS2, TMS: mpsse.ADBUS3, TAPs: taps, tdo: true}
+}
+
+// Update implements Peripheral.
+//
+// The TAPs sample TDI and TMS on the rising edge of TCK and change TDO on the
+// falling edge.
+func (c *TAPChain) Update(pins uint16) (uint16, uint16) {
+	prev := c.prev
+	if !c.started {
+		prev = pins
+		c.started = true
+	}
+	c.prev = pins
+	tck := uint16(1) << c.TCK
+	switch {
+	case prev&tck == 0 && pins&tck != 0:
+		tdi := pins&(1<<c.TDI) != 0
+		tms := pins&(1<<c.TMS) != 0
+		for i := len(c.TAPs) - 1; i >= 0; i-- {
+			t := c.TAPs[i]
+			prev := t.tdo
+			t.clock(tdi, tms)
+			tdi = prev
+		}
+	case prev&tck != 0 && pins&tck == 0:
+		c.tdo = len(c.TAPs) == 0 || c.TAPs[0].tdo
+	}
+	m := uint16(1) << c.TDO
+	if c.tdo {
+		return m, m
+	}
+	return 0, m
+}
+
+var _ d2xx.Handle = &MPSSE{}
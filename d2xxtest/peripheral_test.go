@@ -0,0 +1,232 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/jtag"
+	"periph.io/x/d2xx/mpsse"
+)
+
+func TestMPSSE_commands(t *testing.T) {
+	m := d2xxtest.NewMPSSE()
+	// Loopback, then a bad opcode. Nothing is sent before SendImmediate.
+	m.Write([]byte{
+		mpsse.GPIOSetLow, 0x00, 0x0B,
+		mpsse.LoopbackOn,
+		mpsse.DataOut | mpsse.DataIn | mpsse.WriteFalling, 0x01, 0x00, 0xA5, 0x5A,
+		0xAB,
+	})
+	if n, _ := m.GetQueueStatus(); n != 0 {
+		t.Fatal(n)
+	}
+	m.Write([]byte{mpsse.SendImmediate})
+	buf := make([]byte, 8)
+	if n, _ := m.Read(buf); !bytes.Equal(buf[:n], []byte{0xA5, 0x5A, mpsse.BadCommand, 0xAB}) {
+		t.Fatalf("%#x", buf[:n])
+	}
+	// Without loopback, TDO is pulled up. TDI keeps the last bit.
+	m.Write([]byte{
+		mpsse.LoopbackOff,
+		mpsse.DataOut | mpsse.DataIn | mpsse.WriteFalling, 0x00, 0x00, 0xA5,
+		mpsse.GPIOGetLow,
+		mpsse.SendImmediate,
+	})
+	if n, _ := m.Read(buf); !bytes.Equal(buf[:n], []byte{0xFF, 0xF6}) {
+		t.Fatalf("%#x", buf[:n])
+	}
+	// The latency timer flushes the chip buffer.
+	m.SetLatencyTimer(1)
+	m.Write([]byte{mpsse.GPIOGetHigh})
+	time.Sleep(2 * time.Millisecond)
+	if n, _ := m.GetQueueStatus(); n != 1 {
+		t.Fatal(n)
+	}
+}
+
+func TestMPSSE_config(t *testing.T) {
+	m := d2xxtest.NewMPSSE()
+	j := d2xxtest.NewJTAGChain()
+	w := d2xxtest.NewSWDTarget(0x2BA01477)
+	b := d2xxtest.NewMCUBus()
+	data := []struct {
+		h d2xx.Handle
+		f *d2xxtest.Fake
+	}{{m, &m.Fake}, {j, &j.Fake}, {w, &w.Fake}, {b, &b.Fake}}
+	for _, line := range data {
+		line.h.ResetDevice()
+		line.h.SetBitMode(0x0B, d2xx.BitModeMPSSE)
+		line.h.Write([]byte{mpsse.GPIOSetLow, 0x00, 0x0B})
+		f := line.f
+		if f.Resets != 1 || f.BitMask != 0x0B || f.BitMode != d2xx.BitModeMPSSE {
+			t.Fatalf("%T: %d %#x %#x", line.h, f.Resets, f.BitMask, f.BitMode)
+		}
+		if w := f.Written(); !bytes.Equal(w, []byte{mpsse.GPIOSetLow, 0x00, 0x0B}) {
+			t.Fatalf("%T: %#x", line.h, w)
+		}
+	}
+}
+
+func TestMPSSE_spi(t *testing.T) {
+	for mode := 0; mode < 4; mode += 3 {
+		dev := &d2xxtest.SPIDevice{
+			CLK: mpsse.ADBUS0, MOSI: mpsse.ADBUS1, MISO: mpsse.ADBUS2, CS: mpsse.ADBUS3,
+			Mode: mode,
+			// A JEDEC ID read.
+			Reply: func(rx []byte) byte {
+				if len(rx) > 3 {
+					return 0xFF
+				}
+				return []byte{0, 0xEF, 0x40, 0x18}[len(rx)]
+			},
+		}
+		c := mpsse.New(d2xxtest.NewMPSSE(dev))
+		if err := c.Init(); err != nil {
+			t.Fatal(err)
+		}
+		idle := byte(0)
+		if mode == 3 {
+			idle = 1
+		}
+		c.SetGPIO(0, 0x08|idle, 0x0B)
+		c.SetGPIO(0, idle, 0x0B)
+		r := c.ShiftBytes(mpsse.DataOut|mpsse.DataIn|mpsse.WriteFalling, []byte{0x9F, 0, 0, 0}, 4)
+		c.SetGPIO(0, 0x08|idle, 0x0B)
+		if err := c.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(r, []byte{0, 0xEF, 0x40, 0x18}) {
+			t.Fatalf("mode %d: %#x", mode, r)
+		}
+		if len(dev.Transactions) != 1 || !bytes.Equal(dev.Transactions[0], []byte{0x9F, 0, 0, 0}) {
+			t.Fatalf("mode %d: %#x", mode, dev.Transactions)
+		}
+	}
+}
+
+func TestMPSSE_i2c(t *testing.T) {
+	data := []byte{0xA5, 0x5A}
+	dev := &d2xxtest.I2CDevice{
+		Addr: 0x50, SCL: mpsse.ADBUS0, SDA: mpsse.ADBUS1,
+		Send: func() byte {
+			b := data[0]
+			data = data[1:]
+			return b
+		},
+	}
+	m := d2xxtest.NewMPSSE(dev)
+	m.Tie(mpsse.ADBUS1, mpsse.ADBUS2)
+	c := mpsse.New(m)
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Queue(mpsse.OpenDrain, 0x03, 0x00)
+	start := func() {
+		c.SetGPIO(0, 0x03, 0x03)
+		c.SetGPIO(0, 0x01, 0x03)
+		c.SetGPIO(0, 0x00, 0x03)
+	}
+	write := func(b byte) []byte {
+		c.ShiftBytes(mpsse.DataOut|mpsse.WriteFalling, []byte{b}, 1)
+		return c.ShiftBits(mpsse.DataOut|mpsse.DataIn|mpsse.WriteFalling, 0x80, 1)
+	}
+	read := func(ack bool) []byte {
+		r := c.ShiftBytes(mpsse.DataOut|mpsse.DataIn|mpsse.WriteFalling, []byte{0xFF}, 1)
+		v := byte(0x80)
+		if ack {
+			v = 0
+		}
+		c.ShiftBits(mpsse.DataOut|mpsse.WriteFalling, v, 1)
+		return r
+	}
+	start()
+	a1 := write(0x50 << 1)
+	a2 := write(0x10)
+	c.SetGPIO(0, 0x02, 0x03)
+	start()
+	a3 := write(0x50<<1 | 1)
+	r1 := read(true)
+	r2 := read(false)
+	c.SetGPIO(0, 0x00, 0x03)
+	c.SetGPIO(0, 0x01, 0x03)
+	c.SetGPIO(0, 0x03, 0x03)
+	// Another address is not acknowledged.
+	start()
+	a4 := write(0x51 << 1)
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if a1[0] != 0 || a2[0] != 0 || a3[0] != 0 || a4[0] != 1 {
+		t.Fatal(a1, a2, a3, a4)
+	}
+	if r1[0] != 0xA5 || r2[0] != 0x5A {
+		t.Fatalf("%#x %#x", r1, r2)
+	}
+	want := []d2xxtest.I2CTransfer{{Data: []byte{0x10}}, {Read: true, Data: []byte{0xA5, 0x5A}}}
+	if len(dev.Transfers) != len(want) {
+		t.Fatalf("%+v", dev.Transfers)
+	}
+	for i := range want {
+		if dev.Transfers[i].Read != want[i].Read || !bytes.Equal(dev.Transfers[i].Data, want[i].Data) {
+			t.Fatalf("%+v", dev.Transfers)
+		}
+	}
+}
+
+func TestMPSSE_jtag(t *testing.T) {
+	chain := d2xxtest.NewTAPChain(
+		&d2xxtest.TAP{IRLen: 6, IDCode: 0x13631093, IDCodeIR: 0x09},
+		&d2xxtest.TAP{IRLen: 4, IDCode: 0x4BA00477, IDCodeIR: 0x0E},
+	)
+	c, err := jtag.New(d2xxtest.NewMPSSE(chain), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devs, err := c.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 2 || devs[0].IDCode != 0x13631093 || devs[1].IDCode != 0x4BA00477 {
+		t.Fatalf("%+v", devs)
+	}
+}
+
+func TestFake_overrides(t *testing.T) {
+	b := d2xxtest.NewBitBang()
+	s := d2xxtest.NewFastSerial(0)
+	f := d2xxtest.NewFT1248(d2xx.Device232H)
+	data := []struct {
+		h d2xx.Handle
+		f *d2xxtest.Fake
+	}{{b, &b.Fake}, {s, &s.Fake}, {f, &f.Fake}}
+	for _, line := range data {
+		line := line
+		t.Run(fmt.Sprintf("%T", line.h), func(t *testing.T) {
+			if e := line.h.ResetDevice(); e != 0 || line.f.Resets != 1 {
+				t.Fatal(line.f.Resets, e)
+			}
+			line.h.Write([]byte{1, 2})
+			if w := line.f.Written(); !bytes.Equal(w, []byte{1, 2}) {
+				t.Fatalf("%#x", w)
+			}
+			line.h.Close()
+			if e := line.h.ResetDevice(); e != 1 {
+				t.Fatal(e)
+			}
+			if _, e := line.h.Write([]byte{3}); e != 1 {
+				t.Fatal(e)
+			}
+			if len(line.f.Writes) != 1 {
+				t.Fatal(line.f.Writes)
+			}
+		})
+	}
+}
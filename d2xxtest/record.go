@@ -0,0 +1,460 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"periph.io/x/d2xx"
+)
+
+// Entry is a recorded call.
+//
+// Args and Ret follow the Call conventions, so a recording can be replayed as
+// a Script.
+type Entry struct {
+	Call
+	// At is the time of the call since the recording started.
+	At time.Duration
+}
+
+// Recorder wraps a d2xx.Handle and writes all the calls, with their arguments,
+// results and timestamps, to W in a compact binary format.
+//
+// Read the recording back with ReadRecording.
+type Recorder struct {
+	H d2xx.Handle
+	W io.Writer
+
+	mu    sync.Mutex
+	start time.Time
+	last  time.Duration
+	err   error
+}
+
+// Err returns the first error writing the recording.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close implements d2xx.Handle.
+func (r *Recorder) Close() d2xx.Err {
+	at := r.now()
+	e := r.H.Close()
+	r.record(at, "Close", nil, nil, e)
+	return e
+}
+
+// ResetDevice implements d2xx.Handle.
+func (r *Recorder) ResetDevice() d2xx.Err {
+	at := r.now()
+	e := r.H.ResetDevice()
+	r.record(at, "ResetDevice", nil, nil, e)
+	return e
+}
+
+// GetDeviceInfo implements d2xx.Handle.
+func (r *Recorder) GetDeviceInfo() (uint32, uint16, uint16, d2xx.Err) {
+	at := r.now()
+	d, v, p, e := r.H.GetDeviceInfo()
+	r.record(at, "GetDeviceInfo", nil, []interface{}{d, v, p}, e)
+	return d, v, p, e
+}
+
+// EEPROMRead implements d2xx.Handle.
+func (r *Recorder) EEPROMRead(devType uint32, ee *d2xx.EEPROM) d2xx.Err {
+	at := r.now()
+	e := r.H.EEPROMRead(devType, ee)
+	r.record(at, "EEPROMRead", []interface{}{devType}, []interface{}{*ee}, e)
+	return e
+}
+
+// EEPROMProgram implements d2xx.Handle.
+func (r *Recorder) EEPROMProgram(ee *d2xx.EEPROM) d2xx.Err {
+	at := r.now()
+	e := r.H.EEPROMProgram(ee)
+	r.record(at, "EEPROMProgram", []interface{}{*ee}, nil, e)
+	return e
+}
+
+// EraseEE implements d2xx.Handle.
+func (r *Recorder) EraseEE() d2xx.Err {
+	at := r.now()
+	e := r.H.EraseEE()
+	r.record(at, "EraseEE", nil, nil, e)
+	return e
+}
+
+// WriteEE implements d2xx.Handle.
+func (r *Recorder) WriteEE(offset uint8, value uint16) d2xx.Err {
+	at := r.now()
+	e := r.H.WriteEE(offset, value)
+	r.record(at, "WriteEE", []interface{}{offset, value}, nil, e)
+	return e
+}
+
+// EEUASize implements d2xx.Handle.
+func (r *Recorder) EEUASize() (int, d2xx.Err) {
+	at := r.now()
+	n, e := r.H.EEUASize()
+	r.record(at, "EEUASize", nil, []interface{}{n}, e)
+	return n, e
+}
+
+// EEUARead implements d2xx.Handle.
+func (r *Recorder) EEUARead(ua []byte) d2xx.Err {
+	at := r.now()
+	e := r.H.EEUARead(ua)
+	r.record(at, "EEUARead", []interface{}{len(ua)}, []interface{}{ua}, e)
+	return e
+}
+
+// EEUAWrite implements d2xx.Handle.
+func (r *Recorder) EEUAWrite(ua []byte) d2xx.Err {
+	at := r.now()
+	e := r.H.EEUAWrite(ua)
+	r.record(at, "EEUAWrite", []interface{}{ua}, nil, e)
+	return e
+}
+
+// SetChars implements d2xx.Handle.
+func (r *Recorder) SetChars(eventChar byte, eventEn bool, errorChar byte, errorEn bool) d2xx.Err {
+	at := r.now()
+	e := r.H.SetChars(eventChar, eventEn, errorChar, errorEn)
+	r.record(at, "SetChars", []interface{}{eventChar, eventEn, errorChar, errorEn}, nil, e)
+	return e
+}
+
+// SetUSBParameters implements d2xx.Handle.
+func (r *Recorder) SetUSBParameters(in, out int) d2xx.Err {
+	at := r.now()
+	e := r.H.SetUSBParameters(in, out)
+	r.record(at, "SetUSBParameters", []interface{}{in, out}, nil, e)
+	return e
+}
+
+// SetFlowControl implements d2xx.Handle.
+func (r *Recorder) SetFlowControl() d2xx.Err {
+	at := r.now()
+	e := r.H.SetFlowControl()
+	r.record(at, "SetFlowControl", nil, nil, e)
+	return e
+}
+
+// SetTimeouts implements d2xx.Handle.
+func (r *Recorder) SetTimeouts(readMS, writeMS int) d2xx.Err {
+	at := r.now()
+	e := r.H.SetTimeouts(readMS, writeMS)
+	r.record(at, "SetTimeouts", []interface{}{readMS, writeMS}, nil, e)
+	return e
+}
+
+// SetLatencyTimer implements d2xx.Handle.
+func (r *Recorder) SetLatencyTimer(delayMS uint8) d2xx.Err {
+	at := r.now()
+	e := r.H.SetLatencyTimer(delayMS)
+	r.record(at, "SetLatencyTimer", []interface{}{delayMS}, nil, e)
+	return e
+}
+
+// SetBaudRate implements d2xx.Handle.
+func (r *Recorder) SetBaudRate(hz uint32) d2xx.Err {
+	at := r.now()
+	e := r.H.SetBaudRate(hz)
+	r.record(at, "SetBaudRate", []interface{}{hz}, nil, e)
+	return e
+}
+
+// GetQueueStatus implements d2xx.Handle.
+func (r *Recorder) GetQueueStatus() (uint32, d2xx.Err) {
+	at := r.now()
+	n, e := r.H.GetQueueStatus()
+	r.record(at, "GetQueueStatus", nil, []interface{}{n}, e)
+	return n, e
+}
+
+// Read implements d2xx.Handle.
+func (r *Recorder) Read(b []byte) (int, d2xx.Err) {
+	at := r.now()
+	n, e := r.H.Read(b)
+	r.record(at, "Read", []interface{}{len(b)}, []interface{}{b[:n]}, e)
+	return n, e
+}
+
+// Write implements d2xx.Handle.
+func (r *Recorder) Write(b []byte) (int, d2xx.Err) {
+	at := r.now()
+	n, e := r.H.Write(b)
+	r.record(at, "Write", []interface{}{b}, []interface{}{n}, e)
+	return n, e
+}
+
+// GetBitMode implements d2xx.Handle.
+func (r *Recorder) GetBitMode() (byte, d2xx.Err) {
+	at := r.now()
+	v, e := r.H.GetBitMode()
+	r.record(at, "GetBitMode", nil, []interface{}{v}, e)
+	return v, e
+}
+
+// SetBitMode implements d2xx.Handle.
+func (r *Recorder) SetBitMode(mask, mode byte) d2xx.Err {
+	at := r.now()
+	e := r.H.SetBitMode(mask, mode)
+	r.record(at, "SetBitMode", []interface{}{mask, mode}, nil, e)
+	return e
+}
+
+// ReadRecording reads a recording written by a Recorder.
+func ReadRecording(r io.Reader) ([]Entry, error) {
+	br := bufio.NewReader(r)
+	var hdr [len(recordMagic)]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil || string(hdr[:]) != recordMagic {
+		return nil, errors.New("d2xxtest: not a recording")
+	}
+	var out []Entry
+	var at time.Duration
+	for {
+		m, err := br.ReadByte()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if int(m) >= len(recordMethods) {
+			return nil, fmt.Errorf("d2xxtest: recording: invalid method %d", m)
+		}
+		e := Entry{Call: Call{Method: recordMethods[m]}}
+		d, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		at += time.Duration(d) * time.Microsecond
+		e.At = at
+		if e.Args, err = readValues(br); err != nil {
+			return nil, err
+		}
+		if e.Ret, err = readValues(br); err != nil {
+			return nil, err
+		}
+		v, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		e.Err = d2xx.Err(v)
+		out = append(out, e)
+	}
+}
+
+// Replay returns a Script that serves a recording back and fails the test on
+// the first call that diverges from it.
+func Replay(t TB, entries []Entry) *Script {
+	e := make([]Expectation, len(entries))
+	for i := range entries {
+		e[i] = entries[i].Call
+	}
+	return NewScript(t, e...)
+}
+
+//
+
+// recordMagic starts a recording.
+const recordMagic = "d2xxrec\x01"
+
+// recordMethods are the methods, indexed by their code in the recordings.
+// Append only.
+var recordMethods = []string{
+	"Close", "ResetDevice", "GetDeviceInfo", "EEPROMRead", "EEPROMProgram",
+	"EraseEE", "WriteEE", "EEUASize", "EEUARead", "EEUAWrite", "SetChars",
+	"SetUSBParameters", "SetFlowControl", "SetTimeouts", "SetLatencyTimer",
+	"SetBaudRate", "GetQueueStatus", "Read", "Write", "GetBitMode",
+	"SetBitMode",
+}
+
+// Value tags in the recordings.
+const (
+	tagUint byte = iota
+	tagInt
+	tagBool
+	tagBytes
+	tagEEPROM
+)
+
+func (r *Recorder) now() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.start.IsZero() {
+		r.start = time.Now()
+		if _, err := io.WriteString(r.W, recordMagic); err != nil {
+			r.err = err
+		}
+	}
+	return time.Since(r.start)
+}
+
+// record writes a call.
+//
+// Timestamps are stored in microseconds relative to the previous call.
+func (r *Recorder) record(at time.Duration, method string, args, ret []interface{}, e d2xx.Err) {
+	var b bytes.Buffer
+	for i, m := range recordMethods {
+		if m == method {
+			b.WriteByte(byte(i))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Concurrent calls may complete out of order.
+	at = at.Truncate(time.Microsecond)
+	if at < r.last {
+		at = r.last
+	}
+	putUvarint(&b, uint64((at-r.last)/time.Microsecond))
+	r.last = at
+	writeValues(&b, args)
+	writeValues(&b, ret)
+	putUvarint(&b, uint64(e))
+	if r.err == nil {
+		_, r.err = r.W.Write(b.Bytes())
+	}
+}
+
+func writeValues(b *bytes.Buffer, v []interface{}) {
+	putUvarint(b, uint64(len(v)))
+	for _, x := range v {
+		switch x := x.(type) {
+		case uint8:
+			b.WriteByte(tagUint)
+			putUvarint(b, uint64(x))
+		case uint16:
+			b.WriteByte(tagUint)
+			putUvarint(b, uint64(x))
+		case uint32:
+			b.WriteByte(tagUint)
+			putUvarint(b, uint64(x))
+		case int:
+			b.WriteByte(tagInt)
+			var buf [binary.MaxVarintLen64]byte
+			b.Write(buf[:binary.PutVarint(buf[:], int64(x))])
+		case bool:
+			b.WriteByte(tagBool)
+			if x {
+				b.WriteByte(1)
+			} else {
+				b.WriteByte(0)
+			}
+		case []byte:
+			b.WriteByte(tagBytes)
+			putBytes(b, x)
+		case d2xx.EEPROM:
+			b.WriteByte(tagEEPROM)
+			putBytes(b, x.Raw)
+			for _, s := range []string{x.Manufacturer, x.ManufacturerID, x.Desc, x.Serial} {
+				putBytes(b, []byte(s))
+			}
+		default:
+			panic(fmt.Sprintf("d2xxtest: can't record %T", x))
+		}
+	}
+}
+
+func readValues(r *bufio.Reader) ([]interface{}, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, truncated(err)
+	}
+	if n > 16 {
+		return nil, fmt.Errorf("d2xxtest: recording: %d values", n)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	out := make([]interface{}, n)
+	for i := range out {
+		tag, err := r.ReadByte()
+		if err != nil {
+			return nil, truncated(err)
+		}
+		switch tag {
+		case tagUint:
+			v, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, truncated(err)
+			}
+			out[i] = uint32(v)
+		case tagInt:
+			v, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, truncated(err)
+			}
+			out[i] = int(v)
+		case tagBool:
+			v, err := r.ReadByte()
+			if err != nil {
+				return nil, truncated(err)
+			}
+			out[i] = v != 0
+		case tagBytes:
+			if out[i], err = getBytes(r); err != nil {
+				return nil, err
+			}
+		case tagEEPROM:
+			var f [5][]byte
+			for j := range f {
+				if f[j], err = getBytes(r); err != nil {
+					return nil, err
+				}
+			}
+			out[i] = d2xx.EEPROM{Raw: f[0], Manufacturer: string(f[1]), ManufacturerID: string(f[2]), Desc: string(f[3]), Serial: string(f[4])}
+		default:
+			return nil, fmt.Errorf("d2xxtest: recording: invalid tag %d", tag)
+		}
+	}
+	return out, nil
+}
+
+func putUvarint(b *bytes.Buffer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func putBytes(b *bytes.Buffer, d []byte) {
+	putUvarint(b, uint64(len(d)))
+	b.Write(d)
+}
+
+func getBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, truncated(err)
+	}
+	if n > 1<<24 {
+		return nil, fmt.Errorf("d2xxtest: recording: %d bytes value", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, truncated(err)
+	}
+	return b, nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.New("d2xxtest: recording is truncated")
+	}
+	return err
+}
+
+var _ d2xx.Handle = &Recorder{}
@@ -0,0 +1,85 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/mpsse"
+)
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	inner := d2xxtest.NewMPSSE()
+	inner.E = d2xx.EEPROM{Raw: []byte{1, 2, 3}, Desc: "FT232H", Serial: "FT1234"}
+	r := &d2xxtest.Recorder{H: inner, W: &buf}
+	session := func(h d2xx.Handle) {
+		c := mpsse.New(h)
+		if err := c.Init(); err != nil {
+			t.Fatal(err)
+		}
+		c.SetGPIO(0, 0x08, 0x0B)
+		v := c.GetGPIO(0)
+		if err := c.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if v[0] != 0xFC {
+			t.Fatalf("%#x", v)
+		}
+		var e d2xx.EEPROM
+		if err := h.EEPROMRead(d2xx.Device232H, &e); err != 0 || e.Serial != "FT1234" {
+			t.Fatal(err, e)
+		}
+		h.SetChars(0, true, 1, false)
+		h.Close()
+	}
+	session(r)
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > 256 {
+		t.Fatalf("recording is %d bytes", buf.Len())
+	}
+	entries, err := d2xxtest.ReadRecording(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) < 10 || entries[0].Method != "GetDeviceInfo" || entries[len(entries)-1].Method != "Close" {
+		t.Fatalf("%+v", entries)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].At < entries[i-1].At {
+			t.Fatalf("#%d: %s < %s", i, entries[i].At, entries[i-1].At)
+		}
+	}
+	session(d2xxtest.Replay(t, entries))
+
+	// A different session diverges.
+	rec := &recorder{TB: t}
+	s := d2xxtest.Replay(rec, entries)
+	s.GetDeviceInfo()
+	s.ResetDevice()
+	s.SetUSBParameters(4096, 4096)
+	if len(rec.errs) != 1 || !strings.Contains(rec.errs[0], "want: SetUSBParameters(65536, 65535)") {
+		t.Fatalf("%q", rec.errs)
+	}
+}
+
+func TestReadRecording_invalid(t *testing.T) {
+	if _, err := d2xxtest.ReadRecording(strings.NewReader("foo")); err == nil {
+		t.Fatal("expected error")
+	}
+	var buf bytes.Buffer
+	r := &d2xxtest.Recorder{H: &d2xxtest.Fake{}, W: &buf}
+	r.Write([]byte{1, 2, 3})
+	b := buf.Bytes()
+	if _, err := d2xxtest.ReadRecording(bytes.NewReader(b[:len(b)-2])); err == nil || err.Error() != "d2xxtest: recording is truncated" {
+		t.Fatal(err)
+	}
+}
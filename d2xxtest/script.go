@@ -0,0 +1,463 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"fmt"
+	"strings"
+
+	"periph.io/x/d2xx"
+)
+
+// Call is an expected call to a Script.
+type Call struct {
+	// Method is the d2xx.Handle method name, e.g. "Write".
+	Method string
+	// Args are the expected arguments. Nil means any. Numbers are compared by
+	// value whatever their type.
+	//
+	// The buffer passed to Read and EEUARead is represented by its length. The
+	// EEPROM passed to EEPROMRead is omitted; the one passed to EEPROMProgram
+	// is compared by value.
+	Args []interface{}
+	// Ret are the values returned, except the error:
+	//
+	//   - Read, EEUARead: the []byte copied to the buffer
+	//   - EEPROMRead: the d2xx.EEPROM copied
+	//   - Write: the int count; defaults to all the bytes
+	//   - GetQueueStatus: uint32
+	//   - GetBitMode: byte
+	//   - GetDeviceInfo: uint32, uint16, uint16
+	//   - EEUASize: int
+	Ret []interface{}
+	// Err is the error returned.
+	Err d2xx.Err
+}
+
+func (c *Call) String() string {
+	if c.Args == nil {
+		return c.Method + "(...)"
+	}
+	return formatCall(c.Method, c.Args)
+}
+
+// Expectation is an element of a Script transcript: a Call or an AnyOrder
+// group.
+type Expectation interface {
+	calls() ([]Call, bool)
+}
+
+func (c Call) calls() ([]Call, bool) {
+	return []Call{c}, false
+}
+
+// AnyOrder is a group of calls that can happen in any order, before the next
+// element of the transcript.
+type AnyOrder []Call
+
+func (a AnyOrder) calls() ([]Call, bool) {
+	return append([]Call(nil), a...), true
+}
+
+// TB is the subset of testing.TB used by Script.
+type TB interface {
+	Cleanup(f func())
+	Errorf(format string, args ...interface{})
+	Helper()
+}
+
+// Script is a d2xx.Handle that checks each call against a transcript and
+// returns the canned responses.
+//
+// On the first mismatch, the test fails with the expected and actual calls;
+// from then on, all the calls return FT_OTHER_ERROR. The test also fails if
+// calls of the transcript were not made when the test completes.
+type Script struct {
+	t      TB
+	groups [][]Call
+	order  []bool
+	n      int
+	failed bool
+}
+
+// NewScript returns a Script for a transcript.
+func NewScript(t TB, transcript ...Expectation) *Script {
+	s := &Script{t: t}
+	for _, e := range transcript {
+		c, unordered := e.calls()
+		if len(c) != 0 {
+			s.groups = append(s.groups, c)
+			s.order = append(s.order, !unordered)
+		}
+	}
+	t.Cleanup(func() {
+		if !s.failed && len(s.groups) != 0 {
+			t.Errorf("d2xxtest: %d expected calls were not made; next is %s", s.Remaining(), s.want())
+		}
+	})
+	return s
+}
+
+// Remaining returns the number of calls of the transcript not made yet.
+func (s *Script) Remaining() int {
+	n := 0
+	for _, g := range s.groups {
+		n += len(g)
+	}
+	return n
+}
+
+// Close implements d2xx.Handle.
+func (s *Script) Close() d2xx.Err {
+	return s.errOnly("Close")
+}
+
+// ResetDevice implements d2xx.Handle.
+func (s *Script) ResetDevice() d2xx.Err {
+	return s.errOnly("ResetDevice")
+}
+
+// GetDeviceInfo implements d2xx.Handle.
+func (s *Script) GetDeviceInfo() (uint32, uint16, uint16, d2xx.Err) {
+	c := s.next("GetDeviceInfo")
+	if c == nil {
+		return 0, 0, 0, otherError
+	}
+	var d uint32
+	var v, p uint16
+	s.ret(c, &d, &v, &p)
+	return d, v, p, c.Err
+}
+
+// EEPROMRead implements d2xx.Handle.
+func (s *Script) EEPROMRead(devType uint32, e *d2xx.EEPROM) d2xx.Err {
+	c := s.next("EEPROMRead", devType)
+	if c == nil {
+		return otherError
+	}
+	s.ret(c, e)
+	return c.Err
+}
+
+// EEPROMProgram implements d2xx.Handle.
+func (s *Script) EEPROMProgram(e *d2xx.EEPROM) d2xx.Err {
+	return s.errOnly("EEPROMProgram", *e)
+}
+
+// EraseEE implements d2xx.Handle.
+func (s *Script) EraseEE() d2xx.Err {
+	return s.errOnly("EraseEE")
+}
+
+// WriteEE implements d2xx.Handle.
+func (s *Script) WriteEE(offset uint8, value uint16) d2xx.Err {
+	return s.errOnly("WriteEE", offset, value)
+}
+
+// EEUASize implements d2xx.Handle.
+func (s *Script) EEUASize() (int, d2xx.Err) {
+	c := s.next("EEUASize")
+	if c == nil {
+		return 0, otherError
+	}
+	var n int
+	s.ret(c, &n)
+	return n, c.Err
+}
+
+// EEUARead implements d2xx.Handle.
+func (s *Script) EEUARead(ua []byte) d2xx.Err {
+	c := s.next("EEUARead", len(ua))
+	if c == nil {
+		return otherError
+	}
+	s.readRet(c, ua)
+	return c.Err
+}
+
+// EEUAWrite implements d2xx.Handle.
+func (s *Script) EEUAWrite(ua []byte) d2xx.Err {
+	return s.errOnly("EEUAWrite", ua)
+}
+
+// SetChars implements d2xx.Handle.
+func (s *Script) SetChars(eventChar byte, eventEn bool, errorChar byte, errorEn bool) d2xx.Err {
+	return s.errOnly("SetChars", eventChar, eventEn, errorChar, errorEn)
+}
+
+// SetUSBParameters implements d2xx.Handle.
+func (s *Script) SetUSBParameters(in, out int) d2xx.Err {
+	return s.errOnly("SetUSBParameters", in, out)
+}
+
+// SetFlowControl implements d2xx.Handle.
+func (s *Script) SetFlowControl() d2xx.Err {
+	return s.errOnly("SetFlowControl")
+}
+
+// SetTimeouts implements d2xx.Handle.
+func (s *Script) SetTimeouts(readMS, writeMS int) d2xx.Err {
+	return s.errOnly("SetTimeouts", readMS, writeMS)
+}
+
+// SetLatencyTimer implements d2xx.Handle.
+func (s *Script) SetLatencyTimer(delayMS uint8) d2xx.Err {
+	return s.errOnly("SetLatencyTimer", delayMS)
+}
+
+// SetBaudRate implements d2xx.Handle.
+func (s *Script) SetBaudRate(hz uint32) d2xx.Err {
+	return s.errOnly("SetBaudRate", hz)
+}
+
+// GetQueueStatus implements d2xx.Handle.
+func (s *Script) GetQueueStatus() (uint32, d2xx.Err) {
+	c := s.next("GetQueueStatus")
+	if c == nil {
+		return 0, otherError
+	}
+	var n uint32
+	s.ret(c, &n)
+	return n, c.Err
+}
+
+// Read implements d2xx.Handle.
+func (s *Script) Read(b []byte) (int, d2xx.Err) {
+	c := s.next("Read", len(b))
+	if c == nil {
+		return 0, otherError
+	}
+	return s.readRet(c, b), c.Err
+}
+
+// Write implements d2xx.Handle.
+func (s *Script) Write(b []byte) (int, d2xx.Err) {
+	c := s.next("Write", b)
+	if c == nil {
+		return 0, otherError
+	}
+	n := len(b)
+	s.ret(c, &n)
+	return n, c.Err
+}
+
+// GetBitMode implements d2xx.Handle.
+func (s *Script) GetBitMode() (byte, d2xx.Err) {
+	c := s.next("GetBitMode")
+	if c == nil {
+		return 0, otherError
+	}
+	var v byte
+	s.ret(c, &v)
+	return v, c.Err
+}
+
+// SetBitMode implements d2xx.Handle.
+func (s *Script) SetBitMode(mask, mode byte) d2xx.Err {
+	return s.errOnly("SetBitMode", mask, mode)
+}
+
+//
+
+// otherError is FT_OTHER_ERROR.
+const otherError d2xx.Err = 18
+
+func (s *Script) errOnly(method string, args ...interface{}) d2xx.Err {
+	c := s.next(method, args...)
+	if c == nil {
+		return otherError
+	}
+	return c.Err
+}
+
+// next matches a call against the transcript.
+func (s *Script) next(method string, args ...interface{}) *Call {
+	s.t.Helper()
+	s.n++
+	if s.failed {
+		return nil
+	}
+	if len(s.groups) == 0 {
+		s.fail("unexpected call #%d %s; the transcript is complete", s.n, formatCall(method, args))
+		return nil
+	}
+	g := s.groups[0]
+	cands := g
+	if s.order[0] {
+		cands = g[:1]
+	}
+	for i := range cands {
+		if !cands[i].match(method, args) {
+			continue
+		}
+		c := cands[i]
+		s.groups[0] = append(g[:i:i], g[i+1:]...)
+		if len(s.groups[0]) == 0 {
+			s.groups = s.groups[1:]
+			s.order = s.order[1:]
+		}
+		return &c
+	}
+	msg := fmt.Sprintf("call #%d mismatch\n  want: %s\n  got:  %s", s.n, s.want(), formatCall(method, args))
+	if len(cands) == 1 && cands[0].Method == method {
+		msg += diffArgs(cands[0].Args, args)
+	}
+	s.fail("%s", msg)
+	return nil
+}
+
+func (s *Script) fail(format string, args ...interface{}) {
+	s.t.Helper()
+	s.failed = true
+	s.t.Errorf("d2xxtest: "+format, args...)
+}
+
+// want describes the calls expected next.
+func (s *Script) want() string {
+	g := s.groups[0]
+	if s.order[0] {
+		return g[0].String()
+	}
+	var l []string
+	for i := range g {
+		l = append(l, g[i].String())
+	}
+	return "any of " + strings.Join(l, ", ")
+}
+
+// ret assigns the canned return values to the pointers.
+func (s *Script) ret(c *Call, dst ...interface{}) {
+	s.t.Helper()
+	for i, r := range c.Ret {
+		if i >= len(dst) {
+			s.fail("%s: too many return values", c)
+			return
+		}
+		ok := false
+		switch d := dst[i].(type) {
+		case *uint32:
+			*d, ok = toUint32(r)
+		case *uint16:
+			var v uint32
+			v, ok = toUint32(r)
+			*d = uint16(v)
+		case *byte:
+			var v uint32
+			v, ok = toUint32(r)
+			*d = byte(v)
+		case *int:
+			var v uint32
+			v, ok = toUint32(r)
+			*d = int(v)
+		case *d2xx.EEPROM:
+			var e d2xx.EEPROM
+			if e, ok = r.(d2xx.EEPROM); ok {
+				*d = e
+				d.Raw = append([]byte(nil), e.Raw...)
+			}
+		}
+		if !ok {
+			s.fail("%s: invalid return value %#v", c, r)
+			return
+		}
+	}
+}
+
+// readRet copies the canned data to b.
+func (s *Script) readRet(c *Call, b []byte) int {
+	s.t.Helper()
+	if len(c.Ret) == 0 {
+		return 0
+	}
+	d, ok := c.Ret[0].([]byte)
+	if !ok || len(d) > len(b) {
+		s.fail("%s: invalid return value %#v for a %d bytes buffer", c, c.Ret[0], len(b))
+		return 0
+	}
+	return copy(b, d)
+}
+
+func (c *Call) match(method string, args []interface{}) bool {
+	if c.Method != method {
+		return false
+	}
+	if c.Args == nil {
+		return true
+	}
+	if len(c.Args) != len(args) {
+		return false
+	}
+	for i := range args {
+		if formatArg(c.Args[i]) != formatArg(args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatCall(method string, args []interface{}) string {
+	l := make([]string, len(args))
+	for i, a := range args {
+		l[i] = formatArg(a)
+	}
+	return method + "(" + strings.Join(l, ", ") + ")"
+}
+
+// formatArg formats numbers by value and bytes in hexadecimal.
+func formatArg(a interface{}) string {
+	switch v := a.(type) {
+	case []byte:
+		return fmt.Sprintf("[% x]", v)
+	case d2xx.EEPROM:
+		return fmt.Sprintf("{Raw:[% x] %q %q %q %q}", v.Raw, v.Manufacturer, v.ManufacturerID, v.Desc, v.Serial)
+	default:
+		return fmt.Sprint(a)
+	}
+}
+
+// diffArgs points at the first difference in the arguments.
+func diffArgs(want, got []interface{}) string {
+	if len(want) != len(got) {
+		return fmt.Sprintf("\n  %d arguments instead of %d", len(got), len(want))
+	}
+	for i := range want {
+		w, ok1 := want[i].([]byte)
+		g, ok2 := got[i].([]byte)
+		if ok1 && ok2 {
+			for j := 0; j < len(w) || j < len(g); j++ {
+				switch {
+				case j >= len(w):
+					return fmt.Sprintf("\n  %d extra bytes from offset %d", len(g)-len(w), j)
+				case j >= len(g):
+					return fmt.Sprintf("\n  %d missing bytes from offset %d", len(w)-len(g), j)
+				case w[j] != g[j]:
+					return fmt.Sprintf("\n  first difference at offset %d: want 0x%02x, got 0x%02x", j, w[j], g[j])
+				}
+			}
+			continue
+		}
+		if formatArg(want[i]) != formatArg(got[i]) {
+			return fmt.Sprintf("\n  argument %d: want %s, got %s", i, formatArg(want[i]), formatArg(got[i]))
+		}
+	}
+	return ""
+}
+
+func toUint32(v interface{}) (uint32, bool) {
+	switch n := v.(type) {
+	case int:
+		return uint32(n), true
+	case uint32:
+		return n, true
+	case uint16:
+		return uint32(n), true
+	case uint8:
+		return uint32(n), true
+	default:
+		return 0, false
+	}
+}
+
+var _ d2xx.Handle = &Script{}
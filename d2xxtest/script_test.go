@@ -0,0 +1,133 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/mpsse"
+)
+
+func TestScript_mpsse(t *testing.T) {
+	s := d2xxtest.NewScript(t,
+		d2xxtest.Call{Method: "Write", Args: []interface{}{[]byte{0xAA, mpsse.SendImmediate}}},
+		d2xxtest.Call{Method: "Read", Ret: []interface{}{[]byte{mpsse.BadCommand, 0xAA}}},
+		d2xxtest.Call{Method: "Write", Args: []interface{}{[]byte{0xAB, mpsse.SendImmediate}}},
+		d2xxtest.Call{Method: "Read", Args: []interface{}{2}, Ret: []interface{}{[]byte{mpsse.BadCommand}}},
+		d2xxtest.Call{Method: "Read", Args: []interface{}{1}, Ret: []interface{}{[]byte{0xAB}}},
+		d2xxtest.AnyOrder{
+			{Method: "SetLatencyTimer", Args: []interface{}{1}},
+			{Method: "GetQueueStatus", Ret: []interface{}{3}},
+		},
+		d2xxtest.Call{Method: "SetBitMode", Args: []interface{}{0, d2xx.BitModeReset}, Err: 4},
+	)
+	if err := mpsse.New(s).Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if n, e := s.GetQueueStatus(); n != 3 || e != 0 {
+		t.Fatal(n, e)
+	}
+	if e := s.SetLatencyTimer(1); e != 0 {
+		t.Fatal(e)
+	}
+	if e := s.SetBitMode(0, d2xx.BitModeReset); e != 4 {
+		t.Fatal(e)
+	}
+	if s.Remaining() != 0 {
+		t.Fatal(s.Remaining())
+	}
+}
+
+func TestScript_mismatch(t *testing.T) {
+	r := &recorder{TB: t}
+	s := d2xxtest.NewScript(r,
+		d2xxtest.Call{Method: "Write", Args: []interface{}{[]byte{0x80, 0x00, 0x0B}}},
+		d2xxtest.Call{Method: "Close"},
+	)
+	if _, e := s.Write([]byte{0x80, 0x08, 0x0B}); e == 0 {
+		t.Fatal("expected error")
+	}
+	want := "d2xxtest: call #1 mismatch\n  want: Write([80 00 0b])\n  got:  Write([80 08 0b])\n  first difference at offset 1: want 0x00, got 0x08"
+	if len(r.errs) != 1 || r.errs[0] != want {
+		t.Fatalf("%q", r.errs)
+	}
+	// Later calls fail silently.
+	if e := s.Close(); e == 0 || len(r.errs) != 1 {
+		t.Fatal(e, r.errs)
+	}
+	r.cleanup()
+	if len(r.errs) != 1 {
+		t.Fatal(r.errs)
+	}
+}
+
+func TestScript_anyOrder(t *testing.T) {
+	r := &recorder{TB: t}
+	s := d2xxtest.NewScript(r,
+		d2xxtest.AnyOrder{
+			{Method: "SetBaudRate", Args: []interface{}{9600}},
+			{Method: "SetTimeouts"},
+		},
+	)
+	s.SetTimeouts(1, 2)
+	s.ResetDevice()
+	want := "d2xxtest: call #2 mismatch\n  want: any of SetBaudRate(9600)\n  got:  ResetDevice()"
+	if len(r.errs) != 1 || r.errs[0] != want {
+		t.Fatalf("%q", r.errs)
+	}
+}
+
+func TestScript_incomplete(t *testing.T) {
+	r := &recorder{TB: t}
+	s := d2xxtest.NewScript(r,
+		d2xxtest.Call{Method: "ResetDevice"},
+		d2xxtest.Call{Method: "SetBaudRate", Args: []interface{}{115200}},
+		d2xxtest.Call{Method: "Close"},
+	)
+	s.ResetDevice()
+	r.cleanup()
+	if len(r.errs) != 1 || !strings.Contains(r.errs[0], "2 expected calls were not made; next is SetBaudRate(115200)") {
+		t.Fatalf("%q", r.errs)
+	}
+	s.SetBaudRate(115200)
+	s.Close()
+	if len(r.errs) != 1 {
+		t.Fatalf("%q", r.errs)
+	}
+	s.Close()
+	if len(r.errs) != 2 || r.errs[1] != "d2xxtest: unexpected call #4 Close(); the transcript is complete" {
+		t.Fatalf("%q", r.errs)
+	}
+}
+
+//
+
+// recorder records the failures instead of failing the test.
+type recorder struct {
+	testing.TB
+	errs     []string
+	cleanups []func()
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *recorder) cleanup() {
+	for _, f := range r.cleanups {
+		f()
+	}
+	r.cleanups = nil
+}
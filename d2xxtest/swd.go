@@ -0,0 +1,332 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"periph.io/x/d2xx"
+)
+
+// SWDAP is a simulated ADIv5 Access Port.
+type SWDAP interface {
+	// ReadAP returns the register at addr, including the bank from DP
+	// SELECT. It returns false on error, which sets STICKYERR.
+	ReadAP(addr uint8) (uint32, bool)
+	// WriteAP writes the register at addr, including the bank from DP
+	// SELECT. It returns false on error, which sets STICKYERR.
+	WriteAP(addr uint8, v uint32) bool
+}
+
+// DP CTRL/STAT bits.
+const (
+	swdSTICKYORUN  = 1 << 1
+	swdSTICKYCMP   = 1 << 4
+	swdSTICKYERR   = 1 << 5
+	swdWDATAERR    = 1 << 7
+	swdCDBGPWRUP   = 1 << 28
+	swdCSYSPWRUP   = 1 << 30
+	swdStickyFlags = swdSTICKYORUN | swdSTICKYCMP | swdSTICKYERR | swdWDATAERR
+)
+
+// SWD protocol phases.
+const (
+	swdJTAG  = iota // JTAG mode, waiting for the JTAG-to-SWD sequence
+	swdLock         // Waiting for a line reset
+	swdReset        // In a line reset, waiting for an idle cycle
+	swdIdle
+	swdRequest
+	swdResponse
+	swdTurnaround
+	swdData
+)
+
+// SWDTarget is a fake d2xx.Handle that interprets the MPSSE commands written
+// to it and drives a simulated ARM SWD Debug Port.
+//
+// It uses the resistor wiring: ADBUS0 is SWCLK, ADBUS1 drives SWDIO through a
+// resistor and ADBUS2 reads SWDIO. The target starts in JTAG mode and must be
+// switched to SWD with the JTAG-to-SWD sequence.
+type SWDTarget struct {
+	mpsseHandle
+	// DPIDR is the Debug Port identification.
+	DPIDR uint32
+	// APs are the Access Ports, keyed by APSEL. Reads of missing APs return
+	// zero.
+	APs map[uint8]SWDAP
+	// Wait is the number of following requests answered with WAIT.
+	Wait int
+	// CtrlStat and Select are the DP registers.
+	CtrlStat uint32
+	Select   uint32
+	// Requests is the number of requests acknowledged with OK.
+	Requests int
+
+	phase    int
+	ones     int
+	match    int
+	prevOnes int
+	n        int
+	req      byte
+	data     uint64
+	resp     uint64
+	nresp    int
+	write    bool
+	driving  bool
+	out      bool
+	rdbuff   uint32
+}
+
+// NewSWDTarget returns a simulated FT232H connected to a SWD target.
+func NewSWDTarget(dpidr uint32) *SWDTarget {
+	s := &SWDTarget{mpsseHandle: newMPSSEHandle(), DPIDR: dpidr}
+	s.e.clock = s.clock
+	s.e.set = s.swdio
+	return s
+}
+
+// swdio returns the pins with ADBUS2 set to the SWDIO level.
+func (s *SWDTarget) swdio(pins uint16) uint16 {
+	if s.level(pins) {
+		return pins | pinTDO
+	}
+	return pins &^ pinTDO
+}
+
+// level returns the SWDIO level. The target wins over the resistor.
+func (s *SWDTarget) level(pins uint16) bool {
+	if s.driving {
+		return s.out
+	}
+	return pins&pinTDI != 0
+}
+
+// clock simulates a SWCLK rising edge.
+func (s *SWDTarget) clock(pins uint16) uint16 {
+	if s.driving || s.phase == swdResponse {
+		s.respond()
+		return s.swdio(pins)
+	}
+	b := pins&pinTDI != 0
+	if b {
+		s.ones++
+	} else {
+		s.ones = 0
+	}
+	if s.phase == swdJTAG {
+		s.detectSwitch(b)
+		return s.swdio(pins)
+	}
+	if s.ones >= 50 {
+		s.phase = swdReset
+		return s.swdio(pins)
+	}
+	switch s.phase {
+	case swdReset:
+		if !b {
+			s.phase = swdIdle
+		}
+	case swdIdle:
+		if b {
+			s.phase = swdRequest
+			s.req = 1
+			s.n = 1
+		}
+	case swdRequest:
+		if b {
+			s.req |= 1 << uint(s.n)
+		}
+		if s.n++; s.n == 8 {
+			s.request()
+		}
+	case swdTurnaround:
+		s.phase = swdData
+		s.data = 0
+		s.n = 0
+	case swdData:
+		if b {
+			s.data |= 1 << uint(s.n)
+		}
+		if s.n++; s.n == 33 {
+			s.phase = swdIdle
+			s.writeData()
+		}
+	}
+	return s.swdio(pins)
+}
+
+// detectSwitch looks for at least 50 ones followed by 0xE79E LSB first.
+func (s *SWDTarget) detectSwitch(b bool) {
+	const seq = 0xE79E
+	if s.match > 0 {
+		if b == (seq>>uint(s.match)&1 != 0) {
+			if s.match++; s.match == 16 {
+				s.phase = swdLock
+				s.match = 0
+			}
+			return
+		}
+		s.match = 0
+	}
+	// The first bit of the sequence is a zero, so the ones count was reset by
+	// this bit.
+	if !b && s.prevOnes >= 50 {
+		s.match = 1
+	}
+	s.prevOnes = s.ones
+}
+
+// respond outputs the next response bit, releasing SWDIO once done.
+func (s *SWDTarget) respond() {
+	if s.nresp == 0 {
+		s.driving = false
+		s.phase = swdIdle
+		if s.write {
+			s.phase = swdTurnaround
+		}
+		return
+	}
+	s.driving = true
+	s.out = s.resp&1 != 0
+	s.resp >>= 1
+	s.nresp--
+}
+
+// request decodes a complete request packet and prepares the response.
+func (s *SWDTarget) request() {
+	r := s.req
+	s.phase = swdIdle
+	if r&0x80 == 0 || r&0x40 != 0 || parity4(r>>1&0xF) != r>>5&1 {
+		// Protocol error: the target doesn't drive the line.
+		return
+	}
+	ap := r&2 != 0
+	read := r&4 != 0
+	addr := (r >> 3 & 3) << 2
+	s.phase = swdResponse
+	s.write = false
+	if s.Wait > 0 {
+		s.Wait--
+		s.ack(2)
+		return
+	}
+	if s.fault(ap, addr) {
+		s.ack(4)
+		return
+	}
+	s.Requests++
+	if !read {
+		s.ack(1)
+		s.write = true
+		s.req = r
+		return
+	}
+	var v uint32
+	switch {
+	case ap:
+		v = s.rdbuff
+		n, ok := uint32(0), true
+		if a := s.APs[uint8(s.Select>>24)]; a != nil {
+			n, ok = a.ReadAP(uint8(s.Select&0xF0) | addr)
+		}
+		if !ok {
+			s.CtrlStat |= swdSTICKYERR
+		}
+		s.rdbuff = n
+	case addr == 0x0:
+		v = s.DPIDR
+	case addr == 0x4:
+		v = s.ctrlStat()
+	default:
+		v = s.rdbuff
+	}
+	s.ack(1)
+	s.resp |= uint64(v)<<3 | uint64(parity32(v))<<35
+	s.nresp += 33
+}
+
+// fault returns true if the request must be answered with FAULT.
+func (s *SWDTarget) fault(ap bool, addr uint8) bool {
+	if !ap && addr <= 4 {
+		// DPIDR, ABORT and CTRL/STAT are always accessible.
+		return false
+	}
+	if s.CtrlStat&swdStickyFlags != 0 {
+		return true
+	}
+	if ap && s.CtrlStat&swdCDBGPWRUP == 0 {
+		s.CtrlStat |= swdSTICKYERR
+		return true
+	}
+	return false
+}
+
+func (s *SWDTarget) ack(a byte) {
+	s.resp = uint64(a)
+	s.nresp = 3
+}
+
+func (s *SWDTarget) ctrlStat() uint32 {
+	v := s.CtrlStat
+	// Power up acknowledges follow the requests.
+	if v&swdCDBGPWRUP != 0 {
+		v |= swdCDBGPWRUP << 1
+	}
+	if v&swdCSYSPWRUP != 0 {
+		v |= swdCSYSPWRUP << 1
+	}
+	return v
+}
+
+// writeData applies a write transfer once the data phase is complete.
+func (s *SWDTarget) writeData() {
+	v := uint32(s.data)
+	if byte(s.data>>32)&1 != parity32(v) {
+		s.CtrlStat |= swdWDATAERR
+		return
+	}
+	r := s.req
+	addr := (r >> 3 & 3) << 2
+	if r&2 != 0 {
+		if a := s.APs[uint8(s.Select>>24)]; a != nil && !a.WriteAP(uint8(s.Select&0xF0)|addr, v) {
+			s.CtrlStat |= swdSTICKYERR
+		}
+		return
+	}
+	switch addr {
+	case 0x0:
+		// ABORT.
+		if v&(1<<1) != 0 {
+			s.CtrlStat &^= swdSTICKYCMP
+		}
+		if v&(1<<2) != 0 {
+			s.CtrlStat &^= swdSTICKYERR
+		}
+		if v&(1<<3) != 0 {
+			s.CtrlStat &^= swdWDATAERR
+		}
+		if v&(1<<4) != 0 {
+			s.CtrlStat &^= swdSTICKYORUN
+		}
+	case 0x4:
+		// Sticky flags and acknowledges are read only.
+		s.CtrlStat = s.CtrlStat&swdStickyFlags | v&^(swdStickyFlags|swdCDBGPWRUP<<1|swdCSYSPWRUP<<1)
+	case 0x8:
+		s.Select = v
+	}
+}
+
+func parity4(v byte) byte {
+	return (v ^ v>>1 ^ v>>2 ^ v>>3) & 1
+}
+
+func parity32(v uint32) byte {
+	v ^= v >> 16
+	v ^= v >> 8
+	v ^= v >> 4
+	v ^= v >> 2
+	v ^= v >> 1
+	return byte(v & 1)
+}
+
+var _ d2xx.Handle = &SWDTarget{}
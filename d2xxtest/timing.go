@@ -0,0 +1,315 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"periph.io/x/d2xx"
+)
+
+// Clock is a virtual clock. It only moves when advanced, so the time spent in
+// simulated calls is deterministic and costs no wall time.
+//
+// The zero value starts at 0. It is safe for concurrent use.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Duration
+}
+
+// Now returns the time elapsed since the start of the clock.
+func (c *Clock) Now() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now += d
+}
+
+// Timing is the cost of the d2xx.Handle calls, as charged by Timed.
+type Timing struct {
+	ResetDevice    time.Duration
+	GetQueueStatus time.Duration
+	// Read is the cost of a Read right after GetQueueStatus, served from the
+	// data already received by the driver.
+	Read time.Duration
+	// ReadNoStatus and ReadNoStatusMax bound the cost of a Read not preceded
+	// by GetQueueStatus. The cost is drawn uniformly in the range.
+	ReadNoStatus    time.Duration
+	ReadNoStatusMax time.Duration
+	Write           time.Duration
+	SetBitMode      time.Duration
+	// Other is the cost of the other calls doing a USB round trip, like the
+	// configuration and EEPROM calls. GetDeviceInfo and Close are free.
+	Other time.Duration
+	// PerByte is added for each byte read or written.
+	PerByte time.Duration
+}
+
+// TimingFor returns the default timing of a device type.
+//
+// The Hi-Speed devices (FT2232H, FT4232H, FT232H) use the values documented
+// on d2xx.Handle. The other devices are Full-Speed, where each round trip
+// waits for a 1ms USB frame.
+func TimingFor(devType uint32) Timing {
+	switch devType {
+	case d2xx.Device2232H, d2xx.Device4232H, d2xx.Device232H:
+		return Timing{
+			ResetDevice:     1200 * time.Microsecond,
+			GetQueueStatus:  60 * time.Microsecond,
+			Read:            5 * time.Microsecond,
+			ReadNoStatus:    300 * time.Microsecond,
+			ReadNoStatusMax: 800 * time.Microsecond,
+			Write:           100 * time.Microsecond,
+			SetBitMode:      100 * time.Microsecond,
+			Other:           100 * time.Microsecond,
+			PerByte:         25 * time.Nanosecond,
+		}
+	default:
+		return Timing{
+			ResetDevice:     3 * time.Millisecond,
+			GetQueueStatus:  time.Millisecond,
+			Read:            5 * time.Microsecond,
+			ReadNoStatus:    time.Millisecond,
+			ReadNoStatusMax: 2 * time.Millisecond,
+			Write:           time.Millisecond,
+			SetBitMode:      time.Millisecond,
+			Other:           time.Millisecond,
+			PerByte:         time.Microsecond,
+		}
+	}
+}
+
+// Timed wraps a d2xx.Handle and charges the cost of each call against a
+// virtual clock, to unit test the latency budget and the number of USB round
+// trips of protocol code without sleeping.
+//
+// The costs are deterministic for a given Seed and sequence of calls.
+//
+// It is safe for concurrent use if H is.
+type Timed struct {
+	H d2xx.Handle
+	// Clock is advanced by each call. It can be shared by several handles. If
+	// nil, a new clock is used.
+	Clock *Clock
+	// Timing is the cost of the calls. If zero, it defaults to TimingFor the
+	// device type returned by H.GetDeviceInfo on the first call.
+	Timing Timing
+	Seed   int64
+
+	once       sync.Once
+	mu         sync.Mutex
+	rnd        *rand.Rand
+	status     bool
+	roundTrips int
+}
+
+// Now returns the time on the clock.
+func (t *Timed) Now() time.Duration {
+	t.init()
+	return t.Clock.Now()
+}
+
+// RoundTrips returns the number of calls that did a USB round trip. A Read
+// right after GetQueueStatus doesn't.
+func (t *Timed) RoundTrips() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.roundTrips
+}
+
+// Close implements d2xx.Handle.
+func (t *Timed) Close() d2xx.Err {
+	t.charge("Close", 0)
+	return t.H.Close()
+}
+
+// ResetDevice implements d2xx.Handle.
+func (t *Timed) ResetDevice() d2xx.Err {
+	t.charge("ResetDevice", 0)
+	return t.H.ResetDevice()
+}
+
+// GetDeviceInfo implements d2xx.Handle.
+func (t *Timed) GetDeviceInfo() (uint32, uint16, uint16, d2xx.Err) {
+	t.charge("GetDeviceInfo", 0)
+	return t.H.GetDeviceInfo()
+}
+
+// EEPROMRead implements d2xx.Handle.
+func (t *Timed) EEPROMRead(devType uint32, e *d2xx.EEPROM) d2xx.Err {
+	t.charge("EEPROMRead", 0)
+	return t.H.EEPROMRead(devType, e)
+}
+
+// EEPROMProgram implements d2xx.Handle.
+func (t *Timed) EEPROMProgram(e *d2xx.EEPROM) d2xx.Err {
+	t.charge("EEPROMProgram", 0)
+	return t.H.EEPROMProgram(e)
+}
+
+// EraseEE implements d2xx.Handle.
+func (t *Timed) EraseEE() d2xx.Err {
+	t.charge("EraseEE", 0)
+	return t.H.EraseEE()
+}
+
+// WriteEE implements d2xx.Handle.
+func (t *Timed) WriteEE(offset uint8, value uint16) d2xx.Err {
+	t.charge("WriteEE", 0)
+	return t.H.WriteEE(offset, value)
+}
+
+// EEUASize implements d2xx.Handle.
+func (t *Timed) EEUASize() (int, d2xx.Err) {
+	t.charge("EEUASize", 0)
+	return t.H.EEUASize()
+}
+
+// EEUARead implements d2xx.Handle.
+func (t *Timed) EEUARead(ua []byte) d2xx.Err {
+	t.charge("EEUARead", 0)
+	return t.H.EEUARead(ua)
+}
+
+// EEUAWrite implements d2xx.Handle.
+func (t *Timed) EEUAWrite(ua []byte) d2xx.Err {
+	t.charge("EEUAWrite", 0)
+	return t.H.EEUAWrite(ua)
+}
+
+// SetChars implements d2xx.Handle.
+func (t *Timed) SetChars(eventChar byte, eventEn bool, errorChar byte, errorEn bool) d2xx.Err {
+	t.charge("SetChars", 0)
+	return t.H.SetChars(eventChar, eventEn, errorChar, errorEn)
+}
+
+// SetUSBParameters implements d2xx.Handle.
+func (t *Timed) SetUSBParameters(in, out int) d2xx.Err {
+	t.charge("SetUSBParameters", 0)
+	return t.H.SetUSBParameters(in, out)
+}
+
+// SetFlowControl implements d2xx.Handle.
+func (t *Timed) SetFlowControl() d2xx.Err {
+	t.charge("SetFlowControl", 0)
+	return t.H.SetFlowControl()
+}
+
+// SetTimeouts implements d2xx.Handle.
+func (t *Timed) SetTimeouts(readMS, writeMS int) d2xx.Err {
+	t.charge("SetTimeouts", 0)
+	return t.H.SetTimeouts(readMS, writeMS)
+}
+
+// SetLatencyTimer implements d2xx.Handle.
+func (t *Timed) SetLatencyTimer(delayMS uint8) d2xx.Err {
+	t.charge("SetLatencyTimer", 0)
+	return t.H.SetLatencyTimer(delayMS)
+}
+
+// SetBaudRate implements d2xx.Handle.
+func (t *Timed) SetBaudRate(hz uint32) d2xx.Err {
+	t.charge("SetBaudRate", 0)
+	return t.H.SetBaudRate(hz)
+}
+
+// GetQueueStatus implements d2xx.Handle.
+func (t *Timed) GetQueueStatus() (uint32, d2xx.Err) {
+	t.charge("GetQueueStatus", 0)
+	return t.H.GetQueueStatus()
+}
+
+// Read implements d2xx.Handle.
+func (t *Timed) Read(b []byte) (int, d2xx.Err) {
+	n, e := t.H.Read(b)
+	t.charge("Read", n)
+	return n, e
+}
+
+// Write implements d2xx.Handle.
+func (t *Timed) Write(b []byte) (int, d2xx.Err) {
+	n, e := t.H.Write(b)
+	t.charge("Write", n)
+	return n, e
+}
+
+// GetBitMode implements d2xx.Handle.
+func (t *Timed) GetBitMode() (byte, d2xx.Err) {
+	t.charge("GetBitMode", 0)
+	return t.H.GetBitMode()
+}
+
+// SetBitMode implements d2xx.Handle.
+func (t *Timed) SetBitMode(mask, mode byte) d2xx.Err {
+	t.charge("SetBitMode", 0)
+	return t.H.SetBitMode(mask, mode)
+}
+
+//
+
+// init sets the defaults on first use.
+func (t *Timed) init() {
+	t.once.Do(func() {
+		if t.Clock == nil {
+			t.Clock = &Clock{}
+		}
+		if t.Timing == (Timing{}) {
+			d, _, _, _ := t.H.GetDeviceInfo()
+			t.Timing = TimingFor(d)
+		}
+	})
+}
+
+// charge advances the clock by the cost of a call transferring size bytes.
+func (t *Timed) charge(method string, size int) {
+	t.init()
+	tm := &t.Timing
+	t.mu.Lock()
+	var cost time.Duration
+	roundTrip := true
+	switch method {
+	case "Close", "GetDeviceInfo":
+		roundTrip = false
+	case "ResetDevice":
+		cost = tm.ResetDevice
+	case "GetQueueStatus":
+		cost = tm.GetQueueStatus
+	case "Read":
+		if t.status {
+			cost = tm.Read
+			roundTrip = false
+		} else {
+			cost = tm.ReadNoStatus
+			if r := tm.ReadNoStatusMax - cost; r > 0 {
+				if t.rnd == nil {
+					t.rnd = rand.New(rand.NewSource(t.Seed))
+				}
+				cost += time.Duration(t.rnd.Int63n(int64(r) + 1))
+			}
+		}
+	case "Write":
+		cost = tm.Write
+	case "SetBitMode":
+		cost = tm.SetBitMode
+	default:
+		cost = tm.Other
+	}
+	t.status = method == "GetQueueStatus"
+	if roundTrip {
+		t.roundTrips++
+	}
+	t.mu.Unlock()
+	t.Clock.Advance(cost + time.Duration(size)*tm.PerByte)
+}
+
+var _ d2xx.Handle = &Timed{}
@@ -0,0 +1,116 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package d2xxtest_test
+
+import (
+	"testing"
+	"time"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest"
+)
+
+func TestTimed(t *testing.T) {
+	f := &d2xxtest.Fake{Data: [][]byte{{1, 2, 3, 4}, {5, 6}}}
+	h := &d2xxtest.Timed{H: f, Timing: d2xxtest.TimingFor(d2xx.Device232H)}
+	steps := []struct {
+		f    func()
+		cost time.Duration
+	}{
+		{func() { h.ResetDevice() }, 1200 * time.Microsecond},
+		{func() { h.SetBitMode(0, d2xx.BitModeMPSSE) }, 100 * time.Microsecond},
+		{func() { h.Write(make([]byte, 40)) }, 101 * time.Microsecond},
+		{func() { h.GetQueueStatus() }, 60 * time.Microsecond},
+		{func() { h.Read(make([]byte, 4)) }, 5*time.Microsecond + 100*time.Nanosecond},
+		{func() { h.GetDeviceInfo() }, 0},
+		{func() { h.SetLatencyTimer(1) }, 100 * time.Microsecond},
+	}
+	for i, s := range steps {
+		before := h.Now()
+		s.f()
+		if d := h.Now() - before; d != s.cost {
+			t.Fatalf("#%d: cost %s, want %s", i, d, s.cost)
+		}
+	}
+	// Without GetQueueStatus.
+	before := h.Now()
+	if n, _ := h.Read(make([]byte, 2)); n != 2 {
+		t.Fatal(n)
+	}
+	if d := h.Now() - before; d < 300*time.Microsecond || d > 800*time.Microsecond+50*time.Nanosecond {
+		t.Fatalf("unexpected cost %s", d)
+	}
+	if n := h.RoundTrips(); n != 6 {
+		t.Fatalf("got %d round trips, want 6", n)
+	}
+}
+
+func TestTimed_defaultTiming(t *testing.T) {
+	data := []struct {
+		h    d2xx.Handle
+		want time.Duration
+	}{
+		{d2xxtest.NewMPSSE(), 100 * time.Microsecond},
+		{d2xxtest.NewBitBang(), time.Millisecond},
+	}
+	for i, line := range data {
+		h := &d2xxtest.Timed{H: line.h}
+		h.SetBitMode(0, 0)
+		if n := h.Now(); n != line.want {
+			t.Errorf("#%d: got %s, want %s", i, n, line.want)
+		}
+	}
+}
+
+func TestTimed_deterministic(t *testing.T) {
+	run := func(seed int64) time.Duration {
+		h := &d2xxtest.Timed{H: &d2xxtest.Fake{}, Timing: d2xxtest.TimingFor(d2xx.Device232R), Seed: seed}
+		for i := 0; i < 10; i++ {
+			h.Read(make([]byte, 1))
+		}
+		return h.Now()
+	}
+	a := run(1)
+	if a < 10*time.Millisecond || a > 20*time.Millisecond {
+		t.Fatalf("unexpected time %s", a)
+	}
+	if b := run(1); a != b {
+		t.Fatalf("%s != %s", a, b)
+	}
+}
+
+func TestTimed_sharedClock(t *testing.T) {
+	c := &d2xxtest.Clock{}
+	a := &d2xxtest.Timed{H: &d2xxtest.Fake{}, Clock: c, Timing: d2xxtest.TimingFor(d2xx.Device232H)}
+	b := &d2xxtest.Timed{H: &d2xxtest.Fake{}, Clock: c, Timing: d2xxtest.TimingFor(d2xx.Device2232C)}
+	a.SetBitMode(0, 0)
+	b.SetBitMode(0, 0)
+	if n := c.Now(); n != 1100*time.Microsecond {
+		t.Fatal(n)
+	}
+	c.Advance(time.Second)
+	if n := a.Now(); n != time.Second+1100*time.Microsecond {
+		t.Fatal(n)
+	}
+}
+
+func TestFaulty_clock(t *testing.T) {
+	c := &d2xxtest.Clock{}
+	f := &d2xxtest.Faulty{
+		H:     &d2xxtest.Fake{},
+		Rules: []d2xxtest.Rule{{Method: "Write", Kind: d2xxtest.FaultLatency, Latency: time.Hour}},
+		Clock: c,
+	}
+	start := time.Now()
+	if n, e := f.Write([]byte{1}); n != 1 || e != 0 {
+		t.Fatal(n, e)
+	}
+	if d := time.Since(start); d > time.Minute {
+		t.Fatal("slept")
+	}
+	if n := c.Now(); n != time.Hour {
+		t.Fatal(n)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package decode decodes UART, SPI and I2C traffic from pin samples, as
+// captured with bitbang.Engine.Capture and converted with wave.FromBytes.
+//
+// Channels are selected by their bit in the samples. Each event carries the
+// index of the sample where it starts and the matching time from the first
+// sample.
+package decode
+
+import (
+	"fmt"
+	"time"
+
+	"periph.io/x/d2xx/wave"
+)
+
+// Unused marks an optional channel that wasn't captured.
+const Unused = -1
+
+//
+
+// timestamp returns the time of sample i.
+func timestamp(t *wave.Trace, i int) time.Duration {
+	return time.Duration(int64(i) * int64(time.Second) / int64(t.Rate))
+}
+
+func bit(s uint16, b int) bool {
+	return s>>uint(b)&1 != 0
+}
+
+func checkBits(t *wave.Trace, proto string, bits ...int) error {
+	if t.Rate == 0 {
+		return fmt.Errorf("decode: %s: invalid sample rate 0", proto)
+	}
+	for _, b := range bits {
+		if b != Unused && (b < 0 || b > 15) {
+			return fmt.Errorf("decode: %s: invalid channel bit %d", proto, b)
+		}
+	}
+	return nil
+}
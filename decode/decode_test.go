@@ -0,0 +1,303 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package decode_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"periph.io/x/d2xx/decode"
+	"periph.io/x/d2xx/wave"
+)
+
+// uartWave renders frames on bit 3 at 1MHz. Each frame is a list of bit
+// levels, start and stop bits included; the line idles high.
+func uartWave(baud uint32, frames ...[]bool) *wave.Trace {
+	t := &wave.Trace{Rate: 1000000}
+	var levels []bool
+	for i := 0; i < 20; i++ {
+		levels = append(levels, true)
+	}
+	for _, f := range frames {
+		levels = append(levels, f...)
+		levels = append(levels, true)
+	}
+	period := float64(t.Rate) / float64(baud)
+	n := int(float64(len(levels)) * period)
+	for i := 0; i < n; i++ {
+		s := uint16(0xF7)
+		if levels[int(float64(i)/period)] {
+			s |= 8
+		}
+		t.Samples = append(t.Samples, s)
+	}
+	return t
+}
+
+// frame returns the bits of a frame, LSB first.
+func frame(v uint16, data int, parity []bool, stop ...bool) []bool {
+	out := []bool{false}
+	for i := 0; i < data; i++ {
+		out = append(out, v>>uint(i)&1 != 0)
+	}
+	out = append(out, parity...)
+	return append(out, stop...)
+}
+
+func TestUART(t *testing.T) {
+	tr := uartWave(115200,
+		frame('H', 8, nil, true),
+		frame('i', 8, nil, true),
+		frame(0x55, 8, nil, false),
+		frame(0, 8, nil, false),
+	)
+	got, err := decode.UART(tr, &decode.UARTOpts{RX: 3, Baud: 115200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("%v", got)
+	}
+	if got[0].Data != 'H' || got[1].Data != 'i' || got[0].FramingError || got[1].FramingError {
+		t.Fatalf("%v", got)
+	}
+	if got[0].Sample != 174 || got[0].Time != 174*time.Microsecond {
+		t.Fatalf("%v", got[0])
+	}
+	if got[2].Data != 0x55 || !got[2].FramingError || got[2].Break {
+		t.Fatalf("%v", got[2])
+	}
+	if got[3].Data != 0 || !got[3].FramingError || !got[3].Break {
+		t.Fatalf("%v", got[3])
+	}
+	if s := got[3].String(); s != "461µs: 0x00 break" {
+		t.Fatal(s)
+	}
+}
+
+func TestUART_parity(t *testing.T) {
+	// 7E2: 'A' has 2 bits set, so the even parity bit is 0.
+	tr := uartWave(9600,
+		frame('A', 7, []bool{false}, true, true),
+		frame('A', 7, []bool{true}, true, true),
+		frame('C', 7, []bool{true}, true, false),
+	)
+	got, err := decode.UART(tr, &decode.UARTOpts{RX: 3, Baud: 9600, DataBits: 7, Parity: decode.ParityEven, StopBits: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bool{false, true, false}
+	if len(got) != 3 {
+		t.Fatalf("%v", got)
+	}
+	for i, w := range want {
+		if got[i].ParityError != w {
+			t.Fatalf("%d: %v", i, got[i])
+		}
+	}
+	if got[2].Data != 'C' || !got[2].FramingError || got[1].FramingError {
+		t.Fatalf("%v", got)
+	}
+}
+
+func TestUART_errors(t *testing.T) {
+	tr := uartWave(115200)
+	for _, o := range []decode.UARTOpts{
+		{RX: 3, Baud: 500000},
+		{RX: 3},
+		{RX: decode.Unused, Baud: 9600},
+		{RX: 16, Baud: 9600},
+		{RX: 3, Baud: 9600, DataBits: 10},
+		{RX: 3, Baud: 9600, StopBits: 3},
+	} {
+		if _, err := decode.UART(tr, &o); err == nil {
+			t.Fatalf("%+v", o)
+		}
+	}
+}
+
+// spiWave renders words on CLK=0, MOSI=1, MISO=2, CS=3, two samples per half
+// clock period.
+func spiWave(mode int, words ...[2]byte) *wave.Trace {
+	cpol, cpha := mode&2 != 0, mode&1 != 0
+	t := &wave.Trace{Rate: 8000000}
+	add := func(clk, mosi, miso, cs bool, n int) {
+		var s uint16
+		for i, b := range []bool{clk, mosi, miso, cs} {
+			if b {
+				s |= 1 << uint(i)
+			}
+		}
+		for ; n > 0; n-- {
+			t.Samples = append(t.Samples, s)
+		}
+	}
+	add(cpol, false, false, true, 4)
+	add(cpol, false, false, false, 4)
+	for _, w := range words {
+		for i := 7; i >= 0; i-- {
+			mosi, miso := w[0]>>uint(i)&1 != 0, w[1]>>uint(i)&1 != 0
+			if cpha {
+				add(!cpol, mosi, miso, false, 2)
+				add(cpol, mosi, miso, false, 2)
+			} else {
+				add(cpol, mosi, miso, false, 2)
+				add(!cpol, mosi, miso, false, 2)
+			}
+		}
+	}
+	add(cpol, false, false, false, 4)
+	add(cpol, false, false, true, 4)
+	return t
+}
+
+func TestSPI(t *testing.T) {
+	for mode := 0; mode < 4; mode++ {
+		tr := spiWave(mode, [2]byte{0x9F, 0x00}, [2]byte{0x00, 0xEF})
+		// Idle clock edges while deselected must be ignored.
+		tr.Samples[0] ^= 1
+		got, err := decode.SPI(tr, &decode.SPIOpts{CLK: 0, MOSI: 1, MISO: 2, CS: 3, Mode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 4 || got[0].Kind != decode.SPISelect || got[3].Kind != decode.SPIDeselect {
+			t.Fatalf("mode %d: %v", mode, got)
+		}
+		if got[1].MOSI != 0x9F || got[1].MISO != 0 || got[2].MOSI != 0 || got[2].MISO != 0xEF || got[2].Bits != 8 {
+			t.Fatalf("mode %d: %v", mode, got)
+		}
+		if got[0].Sample != 4 || got[0].Time != 500*time.Nanosecond {
+			t.Fatalf("mode %d: %v", mode, got[0])
+		}
+	}
+}
+
+func TestSPI_options(t *testing.T) {
+	tr := spiWave(0, [2]byte{0x80, 0x01}, [2]byte{0xC3, 0x00})
+	got, err := decode.SPI(tr, &decode.SPIOpts{CLK: 0, MOSI: 1, MISO: 2, CS: 3, LSBFirst: true, Bits: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 16 bits: one 12 bits word then 4 bits cut by the chip select.
+	want := []decode.SPIEvent{
+		{Kind: decode.SPIData, MOSI: 0x301, MISO: 0x080, Bits: 12},
+		{Kind: decode.SPIData, MOSI: 0xC, MISO: 0, Bits: 4},
+	}
+	for i := range want {
+		g := got[i+1]
+		g.Sample, g.Time = 0, 0
+		if !reflect.DeepEqual(g, want[i]) {
+			t.Fatalf("%d: %v", i, got)
+		}
+	}
+	// Without chip select, all the edges are decoded.
+	got, err = decode.SPI(tr, &decode.SPIOpts{CLK: 0, MOSI: 1, MISO: decode.Unused, CS: decode.Unused})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].MOSI != 0x80 || got[1].MOSI != 0xC3 || got[0].MISO != 0 {
+		t.Fatalf("%v", got)
+	}
+	if _, err := decode.SPI(tr, &decode.SPIOpts{CLK: 0, Mode: 4}); err == nil {
+		t.Fatal("invalid mode")
+	}
+}
+
+// i2cWave renders bus conditions on SCL=0 and SDA=1.
+type i2cWave struct {
+	wave.Trace
+}
+
+func (w *i2cWave) add(scl, sda bool) {
+	var s uint16
+	if scl {
+		s |= 1
+	}
+	if sda {
+		s |= 2
+	}
+	w.Samples = append(w.Samples, s, s)
+}
+
+func (w *i2cWave) start() {
+	w.add(true, true)
+	w.add(true, false)
+	w.add(false, false)
+}
+
+func (w *i2cWave) restart() {
+	w.add(false, true)
+	w.start()
+}
+
+func (w *i2cWave) stop() {
+	w.add(false, false)
+	w.add(true, false)
+	w.add(true, true)
+}
+
+func (w *i2cWave) byte(v byte, ack bool) {
+	for i := 7; i >= -1; i-- {
+		b := !ack
+		if i >= 0 {
+			b = v>>uint(i)&1 != 0
+		}
+		w.add(false, b)
+		w.add(true, b)
+		w.add(false, b)
+	}
+}
+
+func TestI2C(t *testing.T) {
+	w := &i2cWave{wave.Trace{Rate: 400000 * 6}}
+	w.add(true, true)
+	w.start()
+	w.byte(0x50<<1, true)
+	w.byte(0x12, true)
+	w.restart()
+	w.byte(0x50<<1|1, true)
+	w.byte(0xAB, false)
+	w.stop()
+	got, err := decode.I2C(&w.Trace, &decode.I2COpts{SCL: 0, SDA: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s []string
+	for _, e := range got {
+		s = append(s, e.String())
+	}
+	want := []string{
+		"1.666µs: start",
+		"4.166µs: address 0x50 write ACK",
+		"26.666µs: data 0x12 ACK",
+		"50µs: restart",
+		"52.5µs: address 0x50 read ACK",
+		"75µs: data 0xab NAK",
+		"98.333µs: stop",
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Fatalf("%q", s)
+	}
+	if got[1].Kind != decode.I2CAddress || got[1].Data != 0xA0 || got[4].Read != true {
+		t.Fatalf("%v", got)
+	}
+	if _, err := decode.I2C(&w.Trace, &decode.I2COpts{SCL: 0, SDA: 0}); err == nil {
+		t.Fatal("same bit")
+	}
+}
+
+func TestDecode_nilOpts(t *testing.T) {
+	tr := &wave.Trace{Rate: 1000000, Samples: make([]uint16, 16)}
+	if _, err := decode.UART(tr, nil); err == nil {
+		t.Fatal("uart")
+	}
+	if _, err := decode.SPI(tr, nil); err == nil {
+		t.Fatal("spi")
+	}
+	if _, err := decode.I2C(tr, nil); err == nil {
+		t.Fatal("i2c")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"fmt"
+	"time"
+
+	"periph.io/x/d2xx/wave"
+)
+
+// I2COpts is the configuration of the I2C decoder.
+type I2COpts struct {
+	// SCL and SDA are the bits of the clock and data lines.
+	SCL int
+	SDA int
+}
+
+// I2CEventKind is the kind of I2C event.
+type I2CEventKind int
+
+// I2C event kinds.
+const (
+	// I2CStart is a start condition.
+	I2CStart I2CEventKind = iota
+	// I2CRestart is a repeated start condition.
+	I2CRestart
+	// I2CAddress is the byte following a start condition.
+	I2CAddress
+	// I2CData is a data byte.
+	I2CData
+	// I2CStop is a stop condition.
+	I2CStop
+)
+
+func (k I2CEventKind) String() string {
+	switch k {
+	case I2CStart:
+		return "start"
+	case I2CRestart:
+		return "restart"
+	case I2CAddress:
+		return "address"
+	case I2CData:
+		return "data"
+	case I2CStop:
+		return "stop"
+	default:
+		return fmt.Sprintf("I2CEventKind(%d)", int(k))
+	}
+}
+
+// I2CEvent is a decoded I2C event.
+type I2CEvent struct {
+	Kind I2CEventKind
+	// Sample is the index of the event's first sample; for a byte it is the
+	// rising clock edge of the first bit.
+	Sample int
+	Time   time.Duration
+	// Addr is the 7 bits address and Read the direction bit for I2CAddress.
+	Addr uint8
+	Read bool
+	// Data is the byte for I2CData, and the raw byte for I2CAddress.
+	Data byte
+	// ACK is set when the receiver pulled SDA low on the ninth clock.
+	ACK bool
+}
+
+func (e I2CEvent) String() string {
+	ack := "NAK"
+	if e.ACK {
+		ack = "ACK"
+	}
+	switch e.Kind {
+	case I2CAddress:
+		dir := "write"
+		if e.Read {
+			dir = "read"
+		}
+		return fmt.Sprintf("%s: address 0x%02x %s %s", e.Time, e.Addr, dir, ack)
+	case I2CData:
+		return fmt.Sprintf("%s: data 0x%02x %s", e.Time, e.Data, ack)
+	default:
+		return fmt.Sprintf("%s: %s", e.Time, e.Kind)
+	}
+}
+
+// I2C decodes the bus transactions.
+//
+// SDA is sampled on the rising edges of SCL. SDA changing while SCL is high
+// is a start or a stop condition. Bits clocked outside a transaction and
+// bytes interrupted by a start or a stop condition are ignored.
+func I2C(t *wave.Trace, opts *I2COpts) ([]I2CEvent, error) {
+	if opts == nil {
+		return nil, fmt.Errorf("decode: i2c: opts is required")
+	}
+	o := *opts
+	if err := checkBits(t, "i2c", o.SCL, o.SDA); err != nil {
+		return nil, err
+	}
+	if o.SCL == Unused || o.SDA == Unused || o.SCL == o.SDA {
+		return nil, fmt.Errorf("decode: i2c: SCL and SDA are required")
+	}
+	var out []I2CEvent
+	active := false
+	first := false
+	var b I2CEvent
+	n := 0
+	for i := 1; i < len(t.Samples); i++ {
+		prev, s := t.Samples[i-1], t.Samples[i]
+		scl, sda := bit(s, o.SCL), bit(s, o.SDA)
+		pscl, psda := bit(prev, o.SCL), bit(prev, o.SDA)
+		if scl && pscl && sda != psda {
+			e := I2CEvent{Sample: i, Time: timestamp(t, i)}
+			if sda {
+				e.Kind = I2CStop
+				active = false
+			} else {
+				e.Kind = I2CStart
+				if active {
+					e.Kind = I2CRestart
+				}
+				active = true
+				first = true
+			}
+			out = append(out, e)
+			n = 0
+			continue
+		}
+		if !active || !scl || pscl {
+			continue
+		}
+		// Rising edge of SCL.
+		if n == 0 {
+			b = I2CEvent{Kind: I2CData, Sample: i, Time: timestamp(t, i)}
+		}
+		if n < 8 {
+			b.Data <<= 1
+			if sda {
+				b.Data |= 1
+			}
+			n++
+			continue
+		}
+		b.ACK = !sda
+		if first {
+			b.Kind = I2CAddress
+			b.Addr = b.Data >> 1
+			b.Read = b.Data&1 != 0
+			first = false
+		}
+		out = append(out, b)
+		n = 0
+	}
+	return out, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"fmt"
+	"time"
+
+	"periph.io/x/d2xx/wave"
+)
+
+// SPIOpts is the configuration of the SPI decoder.
+type SPIOpts struct {
+	// CLK is the bit of the clock.
+	CLK int
+	// MOSI and MISO are the bits of the data lines, or Unused.
+	MOSI int
+	MISO int
+	// CS is the bit of the chip select, or Unused to decode all the clock
+	// edges.
+	CS int
+	// CSActiveHigh selects an active high chip select.
+	CSActiveHigh bool
+	// Mode is the SPI mode, 0~3: bit 1 is CPOL, bit 0 is CPHA.
+	Mode int
+	// LSBFirst selects the bit order.
+	LSBFirst bool
+	// Bits is the word size, 1~32. Defaults to 8.
+	Bits int
+}
+
+// SPIEventKind is the kind of SPI event.
+type SPIEventKind int
+
+// SPI event kinds.
+const (
+	// SPISelect is the chip select being asserted.
+	SPISelect SPIEventKind = iota
+	// SPIData is a word.
+	SPIData
+	// SPIDeselect is the chip select being released.
+	SPIDeselect
+)
+
+func (k SPIEventKind) String() string {
+	switch k {
+	case SPISelect:
+		return "select"
+	case SPIData:
+		return "data"
+	case SPIDeselect:
+		return "deselect"
+	default:
+		return fmt.Sprintf("SPIEventKind(%d)", int(k))
+	}
+}
+
+// SPIEvent is a decoded SPI event.
+type SPIEvent struct {
+	Kind SPIEventKind
+	// Sample is the index of the event's first sample; for SPIData it is the
+	// sampling edge of the first bit.
+	Sample int
+	Time   time.Duration
+	// MOSI and MISO are the words transferred for SPIData.
+	MOSI uint32
+	MISO uint32
+	// Bits is the number of bits in the words. It is less than the configured
+	// word size when the chip select was released mid-word.
+	Bits int
+}
+
+func (e SPIEvent) String() string {
+	if e.Kind != SPIData {
+		return fmt.Sprintf("%s: %s", e.Time, e.Kind)
+	}
+	return fmt.Sprintf("%s: MOSI 0x%x MISO 0x%x (%d bits)", e.Time, e.MOSI, e.MISO, e.Bits)
+}
+
+// SPI decodes the words transferred.
+//
+// The data lines are sampled on the leading clock edge in modes 0 and 2 and
+// on the trailing edge in modes 1 and 3. Clock edges are ignored while the
+// chip select is released. A word truncated by the end of the samples is
+// dropped.
+func SPI(t *wave.Trace, opts *SPIOpts) ([]SPIEvent, error) {
+	if opts == nil {
+		return nil, fmt.Errorf("decode: spi: opts is required")
+	}
+	o := *opts
+	if err := checkBits(t, "spi", o.CLK, o.MOSI, o.MISO, o.CS); err != nil {
+		return nil, err
+	}
+	if o.CLK == Unused {
+		return nil, fmt.Errorf("decode: spi: CLK is required")
+	}
+	if o.Bits == 0 {
+		o.Bits = 8
+	}
+	if o.Bits < 1 || o.Bits > 32 || o.Mode < 0 || o.Mode > 3 {
+		return nil, fmt.Errorf("decode: spi: invalid mode or word size")
+	}
+	cpol := o.Mode&2 != 0
+	cpha := o.Mode&1 != 0
+	// Sample on the rising edge in modes 0 and 3.
+	rising := cpol == cpha
+	selected := func(s uint16) bool {
+		return o.CS == Unused || bit(s, o.CS) == o.CSActiveHigh
+	}
+
+	var out []SPIEvent
+	var w SPIEvent
+	flush := func() {
+		if w.Bits != 0 {
+			if o.LSBFirst {
+				w.MOSI >>= uint(32 - w.Bits)
+				w.MISO >>= uint(32 - w.Bits)
+			}
+			out = append(out, w)
+		}
+		w = SPIEvent{Kind: SPIData}
+	}
+	flush()
+	for i, s := range t.Samples {
+		if i == 0 {
+			continue
+		}
+		prev := t.Samples[i-1]
+		was, is := selected(prev), selected(s)
+		if was != is {
+			if is {
+				out = append(out, SPIEvent{Kind: SPISelect, Sample: i, Time: timestamp(t, i)})
+			} else {
+				flush()
+				out = append(out, SPIEvent{Kind: SPIDeselect, Sample: i, Time: timestamp(t, i)})
+			}
+			continue
+		}
+		if !is || bit(prev, o.CLK) == bit(s, o.CLK) || bit(s, o.CLK) != rising {
+			continue
+		}
+		if w.Bits == 0 {
+			w.Sample = i
+			w.Time = timestamp(t, i)
+		}
+		var mosi, miso uint32
+		if o.MOSI != Unused && bit(s, o.MOSI) {
+			mosi = 1
+		}
+		if o.MISO != Unused && bit(s, o.MISO) {
+			miso = 1
+		}
+		if o.LSBFirst {
+			w.MOSI = w.MOSI>>1 | mosi<<31
+			w.MISO = w.MISO>>1 | miso<<31
+		} else {
+			w.MOSI = w.MOSI<<1 | mosi
+			w.MISO = w.MISO<<1 | miso
+		}
+		if w.Bits++; w.Bits == o.Bits {
+			flush()
+		}
+	}
+	return out, nil
+}
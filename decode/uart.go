@@ -0,0 +1,176 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"fmt"
+	"time"
+
+	"periph.io/x/d2xx/wave"
+)
+
+// Parity is the UART parity bit setting.
+type Parity int
+
+// Parity settings.
+const (
+	ParityNone Parity = iota
+	ParityOdd
+	ParityEven
+	ParityMark
+	ParitySpace
+)
+
+func (p Parity) String() string {
+	switch p {
+	case ParityNone:
+		return "none"
+	case ParityOdd:
+		return "odd"
+	case ParityEven:
+		return "even"
+	case ParityMark:
+		return "mark"
+	case ParitySpace:
+		return "space"
+	default:
+		return fmt.Sprintf("Parity(%d)", int(p))
+	}
+}
+
+// UARTOpts is the configuration of the UART decoder.
+type UARTOpts struct {
+	// RX is the bit of the decoded line.
+	RX int
+	// Baud is the baud rate. The sample rate must be at least 3 times the
+	// baud rate.
+	Baud uint32
+	// DataBits is the number of data bits, 5~9. Defaults to 8.
+	DataBits int
+	Parity   Parity
+	// StopBits is 1 or 2. Defaults to 1.
+	StopBits int
+	// Invert decodes an inverted line, idle low.
+	Invert bool
+}
+
+// UARTFrame is a decoded character.
+type UARTFrame struct {
+	// Sample is the index of the start bit's first sample.
+	Sample int
+	Time   time.Duration
+	Data   uint16
+	// ParityError is set when the parity bit doesn't match.
+	ParityError bool
+	// FramingError is set when a stop bit is low.
+	FramingError bool
+	// Break is set when the whole frame, stop bits included, is low.
+	Break bool
+}
+
+func (f UARTFrame) String() string {
+	s := fmt.Sprintf("%s: 0x%02x", f.Time, f.Data)
+	if f.Break {
+		s += " break"
+	} else if f.FramingError {
+		s += " framing error"
+	}
+	if f.ParityError {
+		s += " parity error"
+	}
+	return s
+}
+
+// UART decodes the frames on one line.
+//
+// Each bit is sampled in its middle, timed from the falling edge of the start
+// bit. A start bit that isn't low anymore in its middle is ignored as a
+// glitch. A frame truncated by the end of the samples is dropped.
+func UART(t *wave.Trace, opts *UARTOpts) ([]UARTFrame, error) {
+	if opts == nil {
+		return nil, fmt.Errorf("decode: uart: opts is required")
+	}
+	o := *opts
+	if err := checkBits(t, "uart", o.RX); err != nil {
+		return nil, err
+	}
+	if o.RX == Unused {
+		return nil, fmt.Errorf("decode: uart: RX is required")
+	}
+	if o.DataBits == 0 {
+		o.DataBits = 8
+	}
+	if o.StopBits == 0 {
+		o.StopBits = 1
+	}
+	if o.DataBits < 5 || o.DataBits > 9 || o.StopBits > 2 || o.StopBits < 1 || o.Parity < ParityNone || o.Parity > ParitySpace {
+		return nil, fmt.Errorf("decode: uart: invalid frame format")
+	}
+	if o.Baud == 0 || t.Rate/o.Baud < 3 {
+		return nil, fmt.Errorf("decode: uart: baud rate %d is too high for a sample rate of %dHz", o.Baud, t.Rate)
+	}
+	period := float64(t.Rate) / float64(o.Baud)
+	level := func(i int) bool {
+		return bit(t.Samples[i], o.RX) != o.Invert
+	}
+	parity := 0
+	if o.Parity != ParityNone {
+		parity = 1
+	}
+	nbits := 1 + o.DataBits + parity + o.StopBits
+	var out []UARTFrame
+	for i := 1; i < len(t.Samples); i++ {
+		// Wait for the falling edge of a start bit.
+		if level(i) || !level(i-1) {
+			continue
+		}
+		center := func(k int) int {
+			return i + int(period*(float64(k)+0.5))
+		}
+		if center(nbits-1) >= len(t.Samples) {
+			break
+		}
+		if level(center(0)) {
+			continue
+		}
+		f := UARTFrame{Sample: i, Time: timestamp(t, i)}
+		ones := 0
+		for k := 0; k < o.DataBits; k++ {
+			if level(center(1 + k)) {
+				f.Data |= 1 << uint(k)
+				ones++
+			}
+		}
+		if parity != 0 {
+			p := level(center(1 + o.DataBits))
+			switch o.Parity {
+			case ParityOdd:
+				f.ParityError = (ones&1 == 1) == p
+			case ParityEven:
+				f.ParityError = (ones&1 == 1) != p
+			case ParityMark:
+				f.ParityError = !p
+			case ParitySpace:
+				f.ParityError = p
+			}
+			if p {
+				ones++
+			}
+		}
+		stop := 1 + o.DataBits + parity
+		for k := 0; k < o.StopBits; k++ {
+			if level(center(stop + k)) {
+				ones++
+			} else {
+				f.FramingError = true
+			}
+		}
+		f.Break = ones == 0
+		out = append(out, f)
+		// Resume from the middle of the last stop bit.
+		i = center(nbits - 1)
+	}
+	return out, nil
+}
@@ -0,0 +1,287 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package eeprom decodes the device specific fields of d2xx.EEPROM.Raw.
+//
+// Raw holds the FT_EEPROM_* structure matching the device type, as defined in
+// ftd2xx.h. Only the fields needed by the other packages are decoded.
+package eeprom
+
+import (
+	"fmt"
+
+	"periph.io/x/d2xx"
+)
+
+// CBUS pin functions that turn a CBUS pin into a GPIO usable in CBUS
+// bit-bang mode.
+const (
+	// CBUS232RIOMode is FT_232R_CBUS_IOMODE.
+	CBUS232RIOMode byte = 0x0A
+	// CBUS232HIOMode is FT_232H_CBUS_IOMODE.
+	CBUS232HIOMode byte = 0x08
+	// CBUSXIOMode is FT_X_SERIES_CBUS_IOMODE.
+	CBUSXIOMode byte = 0x08
+)
+
+// Size returns the size of the FT_EEPROM_* structure for a device type, or 0
+// if the device type is unsupported.
+func Size(devType uint32) int {
+	switch devType {
+	case d2xx.DeviceBM, d2xx.DeviceAM:
+		return 16
+	case d2xx.Device2232C:
+		return 28
+	case d2xx.Device232R:
+		return 32
+	case d2xx.Device2232H:
+		return 40
+	case d2xx.Device4232H:
+		return 36
+	case d2xx.Device232H:
+		return 44
+	case d2xx.DeviceXSeries:
+		return 56
+	default:
+		return 0
+	}
+}
+
+// Read reads the EEPROM with a Raw buffer sized for the device type.
+func Read(h d2xx.Handle, devType uint32) (*d2xx.EEPROM, error) {
+	n := Size(devType)
+	if n == 0 {
+		return nil, fmt.Errorf("eeprom: unsupported device type %d", devType)
+	}
+	e := &d2xx.EEPROM{Raw: make([]byte, n)}
+	if err := h.EEPROMRead(devType, e); err != 0 {
+		return nil, fmt.Errorf("eeprom: EEPROMRead: %s", err)
+	}
+	if len(e.Raw) < n {
+		return nil, fmt.Errorf("eeprom: got %d bytes, expected %d", len(e.Raw), n)
+	}
+	return e, nil
+}
+
+// IOMode returns the CBUS function that configures a pin as a GPIO.
+func IOMode(devType uint32) (byte, bool) {
+	switch devType {
+	case d2xx.Device232R:
+		return CBUS232RIOMode, true
+	case d2xx.Device232H:
+		return CBUS232HIOMode, true
+	case d2xx.DeviceXSeries:
+		return CBUSXIOMode, true
+	default:
+		return 0, false
+	}
+}
+
+// CBUS returns the function of each CBUS pin, Cbus0 first.
+func CBUS(devType uint32, raw []byte) ([]byte, error) {
+	off, n := cbusField(devType)
+	if n == 0 {
+		return nil, fmt.Errorf("eeprom: device type %d has no CBUS", devType)
+	}
+	if len(raw) < off+n {
+		return nil, fmt.Errorf("eeprom: %d bytes is too short", len(raw))
+	}
+	out := make([]byte, n)
+	copy(out, raw[off:])
+	return out, nil
+}
+
+// SetCBUS sets the function of a CBUS pin.
+func SetCBUS(devType uint32, raw []byte, pin int, fn byte) error {
+	off, n := cbusField(devType)
+	if n == 0 {
+		return fmt.Errorf("eeprom: device type %d has no CBUS", devType)
+	}
+	if pin < 0 || pin >= n {
+		return fmt.Errorf("eeprom: invalid CBUS pin %d", pin)
+	}
+	if len(raw) < off+n {
+		return fmt.Errorf("eeprom: %d bytes is too short", len(raw))
+	}
+	raw[off+pin] = fn
+	return nil
+}
+
+// FIFO returns true if the EEPROM configures the first channel as a 245 FIFO,
+// which is required by the synchronous FIFO mode.
+//
+// It is IsFifo on the FT232H and AIsFifo on the FT2232H.
+func FIFO(devType uint32, raw []byte) (bool, error) {
+	off, err := fifoField(devType, raw)
+	if err != nil {
+		return false, err
+	}
+	return raw[off] != 0, nil
+}
+
+// SetFIFO enables or disables the 245 FIFO on the first channel.
+func SetFIFO(devType uint32, raw []byte, on bool) error {
+	off, err := fifoField(devType, raw)
+	if err != nil {
+		return err
+	}
+	raw[off] = b2u(on)
+	return nil
+}
+
+// FastSerial returns true if the EEPROM enables the fast opto-isolated serial
+// interface on a channel, 0 for A and 1 for B.
+//
+// It is AIsFastSer and BIsFastSer on the FT2232C/D and FT2232H and IsFastSer
+// on the FT232H.
+func FastSerial(devType uint32, raw []byte, channel int) (bool, error) {
+	off, err := fastSerField(devType, raw, channel)
+	if err != nil {
+		return false, err
+	}
+	return raw[off] != 0, nil
+}
+
+// SetFastSerial enables or disables the fast opto-isolated serial interface
+// on a channel.
+func SetFastSerial(devType uint32, raw []byte, channel int, on bool) error {
+	off, err := fastSerField(devType, raw, channel)
+	if err != nil {
+		return err
+	}
+	raw[off] = b2u(on)
+	return nil
+}
+
+// FT1248 is the FT1248 configuration stored in the EEPROM.
+type FT1248 struct {
+	// Enabled is IsFT1248 on the FT232H. It is always true on the FT-X
+	// series, where the interface is selected by the part number.
+	Enabled bool
+	// CPOL set means SCLK idles high.
+	CPOL bool
+	// LSBFirst selects the bit order on MIOSIO.
+	LSBFirst bool
+	// FlowControl enables the buffer status on MISO while SS_n is inactive.
+	FlowControl bool
+}
+
+// GetFT1248 returns the FT1248 configuration of a FT232H or FT-X.
+func GetFT1248(devType uint32, raw []byte) (FT1248, error) {
+	off, en, err := ft1248Field(devType, raw)
+	if err != nil {
+		return FT1248{}, err
+	}
+	c := FT1248{Enabled: true, CPOL: raw[off] != 0, LSBFirst: raw[off+1] != 0, FlowControl: raw[off+2] != 0}
+	if en != 0 {
+		c.Enabled = raw[en] != 0
+	}
+	return c, nil
+}
+
+// SetFT1248 sets the FT1248 configuration of a FT232H or FT-X.
+//
+// On the FT232H, enabling FT1248 disables the 245 FIFO and the fast serial
+// interface, which share the pins.
+func SetFT1248(devType uint32, raw []byte, c *FT1248) error {
+	off, en, err := ft1248Field(devType, raw)
+	if err != nil {
+		return err
+	}
+	if en == 0 && !c.Enabled {
+		return fmt.Errorf("eeprom: FT1248 can't be disabled on device type %d", devType)
+	}
+	for i, v := range []bool{c.CPOL, c.LSBFirst, c.FlowControl} {
+		raw[off+i] = b2u(v)
+	}
+	if en != 0 {
+		raw[en] = b2u(c.Enabled)
+		if c.Enabled {
+			// IsFifo, IsFifoTar and IsFastSer.
+			raw[35], raw[36], raw[37] = 0, 0, 0
+		}
+	}
+	return nil
+}
+
+//
+
+// cbusField returns the offset of Cbus0 and the number of CBUS pins.
+func cbusField(devType uint32) (int, int) {
+	switch devType {
+	case d2xx.Device232R:
+		// After the header, IsHighCurrent, UseExtOsc and the 8 Invert fields.
+		return 26, 5
+	case d2xx.Device232H:
+		// After the header and the 6 AC/AD pad fields.
+		return 22, 10
+	case d2xx.DeviceXSeries:
+		return 22, 7
+	default:
+		return 0, 0
+	}
+}
+
+// fifoField returns the offset of IsFifo or AIsFifo.
+func fifoField(devType uint32, raw []byte) (int, error) {
+	var off int
+	switch devType {
+	case d2xx.Device232H:
+		off = 35
+	case d2xx.Device2232H:
+		off = 28
+	default:
+		return 0, fmt.Errorf("eeprom: device type %d doesn't support the 245 FIFO", devType)
+	}
+	if len(raw) <= off {
+		return 0, fmt.Errorf("eeprom: %d bytes is too short", len(raw))
+	}
+	return off, nil
+}
+
+// fastSerField returns the offset of the IsFastSer field of a channel.
+func fastSerField(devType uint32, raw []byte, channel int) (int, error) {
+	var offs []int
+	switch devType {
+	case d2xx.Device2232C:
+		offs = []int{20, 23}
+	case d2xx.Device2232H:
+		offs = []int{30, 33}
+	case d2xx.Device232H:
+		offs = []int{37}
+	default:
+		return 0, fmt.Errorf("eeprom: device type %d doesn't support the fast serial interface", devType)
+	}
+	if channel < 0 || channel >= len(offs) {
+		return 0, fmt.Errorf("eeprom: invalid channel %d", channel)
+	}
+	if len(raw) <= offs[channel] {
+		return 0, fmt.Errorf("eeprom: %d bytes is too short", len(raw))
+	}
+	return offs[channel], nil
+}
+
+// ft1248Field returns the offset of FT1248Cpol and of IsFT1248, 0 if absent.
+func ft1248Field(devType uint32, raw []byte) (int, int, error) {
+	var off, en int
+	switch devType {
+	case d2xx.Device232H:
+		off, en = 32, 38
+	case d2xx.DeviceXSeries:
+		off = 49
+	default:
+		return 0, 0, fmt.Errorf("eeprom: device type %d doesn't support FT1248", devType)
+	}
+	if len(raw) <= off+2 || len(raw) <= en {
+		return 0, 0, fmt.Errorf("eeprom: %d bytes is too short", len(raw))
+	}
+	return off, en, nil
+}
+
+func b2u(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package eeprom_test
+
+import (
+	"bytes"
+	"testing"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/eeprom"
+)
+
+func TestSize(t *testing.T) {
+	// sizeof(FT_EEPROM_*) in ftd2xx.h: the 16 bytes FT_EEPROM_HEADER followed
+	// by the device specific UCHARs, padded to a 4 bytes alignment.
+	data := []struct {
+		devType uint32
+		want    int
+	}{
+		{d2xx.DeviceBM, 16},      // FT_EEPROM_232B
+		{d2xx.DeviceAM, 16},      // FT_EEPROM_232B
+		{d2xx.Device2232C, 28},   // FT_EEPROM_2232
+		{d2xx.Device232R, 32},    // FT_EEPROM_232R
+		{d2xx.Device2232H, 40},   // FT_EEPROM_2232H
+		{d2xx.Device4232H, 36},   // FT_EEPROM_4232H
+		{d2xx.Device232H, 44},    // FT_EEPROM_232H
+		{d2xx.DeviceXSeries, 56}, // FT_EEPROM_X_SERIES
+		{d2xx.Device100AX, 0},
+		{d2xx.DeviceUnknown, 0},
+	}
+	for i, line := range data {
+		if got := eeprom.Size(line.devType); got != line.want {
+			t.Errorf("#%d: Size(%d) = %d, want %d", i, line.devType, got, line.want)
+		}
+	}
+}
+
+func TestCBUS(t *testing.T) {
+	raw := make([]byte, eeprom.Size(d2xx.Device232R))
+	if err := eeprom.SetCBUS(d2xx.Device232R, raw, 4, eeprom.CBUS232RIOMode); err != nil {
+		t.Fatal(err)
+	}
+	if raw[30] != 0x0A {
+		t.Fatalf("%v", raw)
+	}
+	got, err := eeprom.CBUS(d2xx.Device232R, raw)
+	if err != nil || !bytes.Equal(got, []byte{0, 0, 0, 0, 0x0A}) {
+		t.Fatalf("%v %v", got, err)
+	}
+	if err := eeprom.SetCBUS(d2xx.Device232R, raw, 5, 0); err == nil {
+		t.Fatal("invalid pin")
+	}
+	if _, err := eeprom.CBUS(d2xx.Device232H, raw[:20]); err == nil {
+		t.Fatal("too short")
+	}
+	if _, err := eeprom.CBUS(d2xx.Device2232H, raw); err == nil {
+		t.Fatal("no CBUS")
+	}
+}
+
+func TestRead(t *testing.T) {
+	f := &d2xxtest.Fake{DevType: d2xx.Device232H}
+	f.E.Raw = make([]byte, 44)
+	f.E.Serial = "FT1234"
+	e, err := eeprom.Read(f, d2xx.Device232H)
+	if err != nil || e.Serial != "FT1234" {
+		t.Fatal(err)
+	}
+	f.E.Raw = f.E.Raw[:16]
+	if _, err := eeprom.Read(f, d2xx.Device232H); err == nil {
+		t.Fatal("short")
+	}
+	if _, err := eeprom.Read(f, d2xx.Device900); err == nil {
+		t.Fatal("unsupported")
+	}
+}
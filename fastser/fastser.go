@@ -0,0 +1,211 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package fastser drives the fast opto-isolated serial interface of the
+// FT2232C/D, FT2232H and FT232H, enabled with d2xx.BitModeFastSerial.
+//
+// The interface uses 4 pins: FSDI (data to the device), FSCLK (clock, driven
+// by the remote end), FSDO (data from the device) and FSCTS (ready to
+// receive). Each byte is sent in a 10 bits frame: a 0 start bit, 8 data bits
+// LSB first and a port bit. When the device sends, the port bit is the source
+// channel; when the remote end sends, it is the destination channel. Both
+// channels of a dual channel device share the pins.
+//
+// The framing is done by the device. Frame is provided to implement or check
+// the remote end, like an FPGA test bench.
+package fastser
+
+import (
+	"errors"
+	"fmt"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/eeprom"
+)
+
+// Channel is a device channel, selected by the port bit.
+type Channel uint8
+
+// Channels.
+const (
+	ChannelA Channel = 0
+	ChannelB Channel = 1
+)
+
+func (c Channel) String() string {
+	switch c {
+	case ChannelA:
+		return "A"
+	case ChannelB:
+		return "B"
+	default:
+		return fmt.Sprintf("Channel(%d)", uint8(c))
+	}
+}
+
+// Frame is a 10 bits frame on the wire, bit 0 first: the start bit, D0~D7
+// and the port bit.
+type Frame uint16
+
+// NewFrame returns the frame carrying a byte to or from a channel.
+func NewFrame(data byte, ch Channel) Frame {
+	return Frame(data)<<1 | Frame(ch&1)<<9
+}
+
+// Data returns the data byte.
+func (f Frame) Data() byte {
+	return byte(f >> 1)
+}
+
+// Channel returns the channel in the port bit.
+func (f Frame) Channel() Channel {
+	return Channel(f >> 9 & 1)
+}
+
+// Valid returns false on a framing error: the start bit is not 0 or the frame
+// is longer than 10 bits.
+func (f Frame) Valid() bool {
+	return f&1 == 0 && f < 1<<10
+}
+
+func (f Frame) String() string {
+	if !f.Valid() {
+		return fmt.Sprintf("invalid frame %#03x", uint16(f))
+	}
+	return fmt.Sprintf("0x%02x port %s", f.Data(), f.Channel())
+}
+
+// ErrTimeout is returned by Read when no data arrived before the read
+// timeout, and by Write when the remote end held FSCTS.
+var ErrTimeout = errors.New("fastser: timed out")
+
+// Opts is the configuration of a Port.
+type Opts struct {
+	// Channel is the channel of the handle. It is checked against the EEPROM
+	// and selects the port bit of the frames.
+	Channel Channel
+	// ReadTimeout and WriteTimeout are in ms. They default to 1000.
+	ReadTimeout  int
+	WriteTimeout int
+}
+
+// Port is one channel of the fast serial interface. It implements
+// io.ReadWriter.
+//
+// Bytes written are sent with the port bit set to the channel; bytes read
+// are the ones the remote end sent to this channel.
+type Port struct {
+	h  d2xx.Handle
+	ch Channel
+}
+
+// New checks that the EEPROM enables the fast serial interface on the channel
+// and switches it to fast serial mode.
+func New(h d2xx.Handle, opts *Opts) (*Port, error) {
+	o := Opts{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.ReadTimeout == 0 {
+		o.ReadTimeout = 1000
+	}
+	if o.WriteTimeout == 0 {
+		o.WriteTimeout = 1000
+	}
+	if o.Channel > ChannelB {
+		return nil, fmt.Errorf("fastser: invalid channel %s", o.Channel)
+	}
+	d, _, _, e := h.GetDeviceInfo()
+	if e != 0 {
+		return nil, toErr("GetDeviceInfo", e)
+	}
+	ee, err := eeprom.Read(h, d)
+	if err != nil {
+		return nil, fmt.Errorf("fastser: %w", err)
+	}
+	ok, err := eeprom.FastSerial(d, ee.Raw, int(o.Channel))
+	if err != nil {
+		return nil, fmt.Errorf("fastser: %w", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("fastser: the EEPROM doesn't enable the fast serial interface on channel %s", o.Channel)
+	}
+	if e := h.ResetDevice(); e != 0 {
+		return nil, toErr("ResetDevice", e)
+	}
+	if e := h.SetTimeouts(o.ReadTimeout, o.WriteTimeout); e != 0 {
+		return nil, toErr("SetTimeouts", e)
+	}
+	if e := h.SetLatencyTimer(1); e != 0 {
+		return nil, toErr("SetLatencyTimer", e)
+	}
+	if e := h.SetBitMode(0, d2xx.BitModeFastSerial); e != 0 {
+		return nil, toErr("SetBitMode", e)
+	}
+	return &Port{h: h, ch: o.Channel}, nil
+}
+
+// Channel returns the channel of the port.
+func (p *Port) Channel() Channel {
+	return p.ch
+}
+
+// Read implements io.Reader.
+//
+// It returns the bytes already received, or waits up to the read timeout for
+// the first one.
+func (p *Port) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	q, e := p.h.GetQueueStatus()
+	if e != 0 {
+		return 0, toErr("GetQueueStatus", e)
+	}
+	n := 1
+	if q > 1 {
+		n = int(q)
+	}
+	if n > len(b) {
+		n = len(b)
+	}
+	got, e := p.h.Read(b[:n])
+	if e != 0 {
+		return got, toErr("Read", e)
+	}
+	if got == 0 {
+		return 0, ErrTimeout
+	}
+	return got, nil
+}
+
+// Write implements io.Writer.
+func (p *Port) Write(b []byte) (int, error) {
+	w := 0
+	for w < len(b) {
+		n, e := p.h.Write(b[w:])
+		w += n
+		if e != 0 {
+			return w, toErr("Write", e)
+		}
+		if n == 0 {
+			return w, ErrTimeout
+		}
+	}
+	return w, nil
+}
+
+// Close resets the bit mode. The handle is not closed.
+func (p *Port) Close() error {
+	if e := p.h.SetBitMode(0, d2xx.BitModeReset); e != 0 {
+		return toErr("SetBitMode", e)
+	}
+	return nil
+}
+
+//
+
+func toErr(op string, e d2xx.Err) error {
+	return fmt.Errorf("fastser: %s: %s", op, e)
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package fastser_test
+
+import (
+	"io"
+	"testing"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/eeprom"
+	"periph.io/x/d2xx/fastser"
+)
+
+func TestFrame(t *testing.T) {
+	f := fastser.NewFrame(0xA5, fastser.ChannelB)
+	if f != 0x34A || !f.Valid() || f.Data() != 0xA5 || f.Channel() != fastser.ChannelB {
+		t.Fatalf("%#x", uint16(f))
+	}
+	if s := f.String(); s != "0xa5 port B" {
+		t.Fatal(s)
+	}
+	if fastser.Frame(0x34B).Valid() || fastser.Frame(0x400).Valid() {
+		t.Fatal("framing error")
+	}
+}
+
+func TestPort(t *testing.T) {
+	f := d2xxtest.NewFastSerial(fastser.ChannelB)
+	p, err := fastser.New(f, &fastser.Opts{Channel: fastser.ChannelB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.BitMode != d2xx.BitModeFastSerial || p.Channel() != fastser.ChannelB {
+		t.Fatalf("%#x", f.BitMode)
+	}
+	if _, err := io.WriteString(p, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Sent) != 2 || f.Sent[0] != fastser.NewFrame('h', fastser.ChannelB) {
+		t.Fatalf("%v", f.Sent)
+	}
+	f.Receive(
+		fastser.NewFrame('o', fastser.ChannelB),
+		fastser.NewFrame('x', fastser.ChannelA),
+		fastser.NewFrame('k', fastser.ChannelB)|1,
+		fastser.NewFrame('k', fastser.ChannelB),
+	)
+	b := make([]byte, 10)
+	n, err := p.Read(b)
+	if err != nil || string(b[:n]) != "ok" || f.Dropped != 2 {
+		t.Fatalf("%q %v %d", b[:n], err, f.Dropped)
+	}
+	if _, err := p.Read(b); err != fastser.ErrTimeout {
+		t.Fatal(err)
+	}
+	f.CTS = false
+	if _, err := p.Write(b); err != fastser.ErrTimeout {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil || f.BitMode != d2xx.BitModeReset {
+		t.Fatal(err)
+	}
+}
+
+func TestNew_eeprom(t *testing.T) {
+	f := d2xxtest.NewFastSerial(fastser.ChannelA)
+	if err := eeprom.SetFastSerial(d2xx.Device2232H, f.E.Raw, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fastser.New(f, nil); err == nil {
+		t.Fatal("AIsFastSer is not set")
+	}
+	if _, err := fastser.New(f, &fastser.Opts{Channel: fastser.ChannelB}); err != nil {
+		t.Fatal(err)
+	}
+	f.DevType = d2xx.Device232R
+	if _, err := fastser.New(f, nil); err == nil {
+		t.Fatal("unsupported device")
+	}
+}
@@ -0,0 +1,374 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package fifo streams data over the synchronous 245 FIFO mode of the FT232H
+// and FT2232H, as described in AN_130.
+//
+// The device FIFO is small, so a dedicated goroutine drains the driver into a
+// queue of large buffers while the caller processes the previous ones. If the
+// caller falls behind, the goroutine has no buffer to fill, the device FIFO
+// fills up and the data source has to stall; this is reported as an overflow.
+package fifo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/eeprom"
+)
+
+// DefaultTransferSize is the default USB transfer size, the largest the
+// driver supports.
+const DefaultTransferSize = 65536
+
+// Errors returned by Stream.
+var (
+	// ErrOverflow is returned by Read in strict mode when the reader fell
+	// behind.
+	ErrOverflow = errors.New("fifo: overflow; the host didn't keep up with the data source")
+	// ErrClosed is returned after Close.
+	ErrClosed = errors.New("fifo: stream closed")
+)
+
+// Opts is the configuration of a Stream.
+type Opts struct {
+	// TransferSize is the USB transfer size and the size of each buffer,
+	// 64~65536 and a multiple of 64. Defaults to DefaultTransferSize.
+	TransferSize int
+	// Buffers is the number of buffers in the read queue. Defaults to 2, for
+	// double buffering.
+	Buffers int
+	// Latency is the latency timer in ms. Defaults to 2.
+	Latency uint8
+	// Poll is the wait between two queue checks when the device has no data.
+	// Defaults to 100µs.
+	Poll time.Duration
+	// Strict makes Read return ErrOverflow once after an overflow, instead of
+	// only counting it. The data before and after the gap can still be read.
+	Strict bool
+}
+
+// Stats are the throughput statistics of a Stream.
+type Stats struct {
+	// Read and Written are the bytes transferred.
+	Read    uint64
+	Written uint64
+	// Elapsed is the time since the stream was started.
+	Elapsed time.Duration
+	// Overflows is the number of times the read goroutine had to wait for a
+	// free buffer while the device had data pending.
+	Overflows int
+	// MaxQueue is the highest number of bytes seen pending in the driver.
+	MaxQueue uint32
+}
+
+// ReadRate returns the average read throughput in bytes per second.
+func (s *Stats) ReadRate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Read) / s.Elapsed.Seconds()
+}
+
+// WriteRate returns the average write throughput in bytes per second.
+func (s *Stats) WriteRate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Written) / s.Elapsed.Seconds()
+}
+
+// Stream is a synchronous FIFO stream. It implements io.ReadWriteCloser.
+//
+// Read and Write can be called concurrently with each other but each of them
+// must not be called concurrently with itself.
+type Stream struct {
+	// mu serializes the handle accesses and protects the fields below.
+	mu       sync.Mutex
+	h        d2xx.Handle
+	stats    Stats
+	start    time.Time
+	err      error
+	overflow bool
+
+	opts Opts
+	full chan []byte
+	free chan []byte
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	// Owned by Read.
+	cur  []byte
+	held []byte
+}
+
+// New switches the device to synchronous FIFO mode and starts reading.
+//
+// The EEPROM must configure the first channel as a 245 FIFO.
+func New(h d2xx.Handle, opts *Opts) (*Stream, error) {
+	o := Opts{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.TransferSize == 0 {
+		o.TransferSize = DefaultTransferSize
+	}
+	if o.Buffers == 0 {
+		o.Buffers = 2
+	}
+	if o.Latency == 0 {
+		o.Latency = 2
+	}
+	if o.Poll == 0 {
+		o.Poll = 100 * time.Microsecond
+	}
+	if o.TransferSize < 64 || o.TransferSize > 65536 || o.TransferSize%64 != 0 || o.Buffers < 2 {
+		return nil, errors.New("fifo: invalid options")
+	}
+	d, _, _, e := h.GetDeviceInfo()
+	if e != 0 {
+		return nil, toErr("GetDeviceInfo", e)
+	}
+	ee, err := eeprom.Read(h, d)
+	if err != nil {
+		return nil, fmt.Errorf("fifo: %w", err)
+	}
+	ok, err := eeprom.FIFO(d, ee.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("fifo: %w", err)
+	}
+	if !ok {
+		return nil, errors.New("fifo: the EEPROM doesn't configure the channel as a 245 FIFO")
+	}
+	if e := h.ResetDevice(); e != 0 {
+		return nil, toErr("ResetDevice", e)
+	}
+	if e := h.SetBitMode(0xFF, d2xx.BitModeReset); e != 0 {
+		return nil, toErr("SetBitMode", e)
+	}
+	// AN_130 waits for the reset to complete.
+	time.Sleep(10 * time.Millisecond)
+	if e := h.SetBitMode(0xFF, d2xx.BitModeSyncFIFO); e != 0 {
+		return nil, toErr("SetBitMode", e)
+	}
+	if e := h.SetLatencyTimer(o.Latency); e != 0 {
+		return nil, toErr("SetLatencyTimer", e)
+	}
+	if e := h.SetUSBParameters(o.TransferSize, o.TransferSize); e != 0 {
+		return nil, toErr("SetUSBParameters", e)
+	}
+	if e := h.SetFlowControl(); e != 0 {
+		return nil, toErr("SetFlowControl", e)
+	}
+	if e := h.SetTimeouts(1000, 1000); e != 0 {
+		return nil, toErr("SetTimeouts", e)
+	}
+	s := &Stream{
+		h:     h,
+		start: time.Now(),
+		opts:  o,
+		full:  make(chan []byte, o.Buffers),
+		free:  make(chan []byte, o.Buffers),
+		done:  make(chan struct{}),
+	}
+	for i := 0; i < o.Buffers; i++ {
+		s.free <- make([]byte, 0, o.TransferSize)
+	}
+	s.wg.Add(1)
+	go s.loop()
+	return s, nil
+}
+
+// Read implements io.Reader.
+//
+// It blocks until data is available.
+func (s *Stream) Read(p []byte) (int, error) {
+	if len(s.cur) == 0 {
+		if s.held != nil {
+			s.free <- s.held
+			s.held = nil
+		}
+		if err := s.checkOverflow(); err != nil {
+			return 0, err
+		}
+		b, ok := <-s.full
+		if !ok {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return 0, s.err
+		}
+		s.held, s.cur = b, b
+	}
+	n := copy(p, s.cur)
+	s.cur = s.cur[n:]
+	return n, nil
+}
+
+// Write implements io.Writer.
+func (s *Stream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	w := 0
+	for w < len(p) {
+		n, e := s.h.Write(p[w:])
+		w += n
+		s.stats.Written += uint64(n)
+		if e != 0 {
+			return w, toErr("Write", e)
+		}
+		if n == 0 {
+			return w, errors.New("fifo: write timed out")
+		}
+	}
+	return w, nil
+}
+
+// Stats returns the throughput statistics.
+func (s *Stream) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.Elapsed = time.Since(s.start)
+	return st
+}
+
+// Close stops reading and resets the bit mode. The handle is not closed.
+func (s *Stream) Close() error {
+	select {
+	case <-s.done:
+		return ErrClosed
+	default:
+	}
+	close(s.done)
+	s.wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.h.SetBitMode(0, d2xx.BitModeReset); e != 0 {
+		return toErr("SetBitMode", e)
+	}
+	return nil
+}
+
+var _ io.ReadWriteCloser = &Stream{}
+
+//
+
+// loop drains the driver into the free buffers.
+func (s *Stream) loop() {
+	defer s.wg.Done()
+	defer close(s.full)
+	for {
+		var buf []byte
+		select {
+		case buf = <-s.free:
+		default:
+			// The reader is behind. It is an overflow if the device has data
+			// waiting, since the source is now stalled.
+			if q, err := s.queue(); err != nil {
+				s.fail(err)
+				return
+			} else if q != 0 {
+				s.mu.Lock()
+				s.stats.Overflows++
+				s.overflow = true
+				s.mu.Unlock()
+			}
+			select {
+			case buf = <-s.free:
+			case <-s.done:
+				s.fail(ErrClosed)
+				return
+			}
+		}
+		buf, err := s.fill(buf[:0])
+		if len(buf) != 0 {
+			s.full <- buf
+		}
+		if err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+// fill reads until the buffer is full or the device has no more data.
+func (s *Stream) fill(buf []byte) ([]byte, error) {
+	for len(buf) < cap(buf) {
+		select {
+		case <-s.done:
+			return buf, ErrClosed
+		default:
+		}
+		q, err := s.queue()
+		if err != nil {
+			return buf, err
+		}
+		if q == 0 {
+			if len(buf) != 0 {
+				return buf, nil
+			}
+			time.Sleep(s.opts.Poll)
+			continue
+		}
+		n := int(q)
+		if r := cap(buf) - len(buf); n > r {
+			n = r
+		}
+		s.mu.Lock()
+		got, e := s.h.Read(buf[len(buf) : len(buf)+n])
+		s.stats.Read += uint64(got)
+		s.mu.Unlock()
+		buf = buf[:len(buf)+got]
+		if e != 0 {
+			return buf, toErr("Read", e)
+		}
+	}
+	return buf, nil
+}
+
+// queue returns the number of bytes pending in the driver.
+func (s *Stream) queue() (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, e := s.h.GetQueueStatus()
+	if e != 0 {
+		return 0, toErr("GetQueueStatus", e)
+	}
+	if q > s.stats.MaxQueue {
+		s.stats.MaxQueue = q
+	}
+	return q, nil
+}
+
+func (s *Stream) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+}
+
+func (s *Stream) checkOverflow() error {
+	if !s.opts.Strict {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.overflow {
+		s.overflow = false
+		return ErrOverflow
+	}
+	return nil
+}
+
+func toErr(op string, e d2xx.Err) error {
+	return fmt.Errorf("fifo: %s: %s", op, e)
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package fifo_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/eeprom"
+	"periph.io/x/d2xx/fifo"
+)
+
+func TestStream(t *testing.T) {
+	f := d2xxtest.NewFIFO()
+	s, err := fifo.New(f, &fifo.Opts{TransferSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.BitMode != d2xx.BitModeSyncFIFO || f.BitMask != 0xFF || f.InSize != 4096 || f.Latency != 2 || !f.FlowControl {
+		t.Fatalf("%#x %#x %d %d %t", f.BitMode, f.BitMask, f.InSize, f.Latency, f.FlowControl)
+	}
+	want := make([]byte, 100000)
+	for i := range want {
+		want[i] = byte(i * 7)
+	}
+	go func() {
+		for i := 0; i < len(want); i += 1000 {
+			f.Feed(want[i : i+1000])
+			time.Sleep(10 * time.Microsecond)
+		}
+	}()
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(s, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("data mismatch")
+	}
+	if _, err := io.WriteString(s, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if w := f.Written(); string(w) != "hello" {
+		t.Fatalf("%q", w)
+	}
+	st := s.Stats()
+	if st.Read != uint64(len(want)) || st.Written != 5 || st.Overflows != 0 || st.MaxQueue == 0 || st.ReadRate() <= 0 {
+		t.Fatalf("%+v", st)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if f.BitMode != d2xx.BitModeReset {
+		t.Fatalf("%#x", f.BitMode)
+	}
+	if _, err := s.Read(got); err != fifo.ErrClosed {
+		t.Fatal(err)
+	}
+	if _, err := s.Write(got); err != fifo.ErrClosed {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != fifo.ErrClosed {
+		t.Fatal(err)
+	}
+}
+
+func TestStream_overflow(t *testing.T) {
+	f := d2xxtest.NewFIFO()
+	s, err := fifo.New(f, &fifo.Opts{TransferSize: 64, Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	// Nobody reads; both buffers get filled while the device has more data.
+	f.Feed(data)
+	for s.Stats().Overflows == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	got := make([]byte, 0, len(data))
+	buf := make([]byte, 32)
+	overflows := 0
+	for len(got) < len(data) {
+		n, err := s.Read(buf)
+		if errors.Is(err, fifo.ErrOverflow) {
+			overflows++
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	// The data is intact; only the source was stalled.
+	if !bytes.Equal(got, data) || overflows == 0 {
+		t.Fatalf("%d overflows", overflows)
+	}
+}
+
+func TestNew_eeprom(t *testing.T) {
+	f := d2xxtest.NewFIFO()
+	if err := eeprom.SetFIFO(d2xx.Device232H, f.E.Raw, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fifo.New(f, nil); err == nil {
+		t.Fatal("not configured as FIFO")
+	}
+	f = d2xxtest.NewFIFO()
+	f.DevType = d2xx.Device232R
+	if _, err := fifo.New(f, nil); err == nil {
+		t.Fatal("unsupported device")
+	}
+	if _, err := fifo.New(d2xxtest.NewFIFO(), &fifo.Opts{TransferSize: 100}); err == nil {
+		t.Fatal("invalid transfer size")
+	}
+}
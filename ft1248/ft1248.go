@@ -0,0 +1,268 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package ft1248 configures the FT1248 interface of the FT232H and FT-X
+// series and transfers data with the MCU attached to it.
+//
+// FT1248 is a half duplex bus where the MCU is the master: it drives SCLK and
+// SS_n and selects the bus width, 1, 2, 4 or 8 bits of MIOSIO, in the command
+// of each transaction. The device buffers the data in both directions, so the
+// USB host side is a plain byte stream; the bus width and the clock only
+// bound the throughput, which is used to size the timeouts.
+//
+// With flow control, the device reports the state of its buffers to the MCU,
+// so the host can queue any amount of data. Without it, the MCU can't tell
+// whether data is pending, so the host sends one device buffer at a time.
+//
+// The clock polarity, bit order and flow control are stored in the EEPROM
+// and take effect after the device is power cycled.
+package ft1248
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/eeprom"
+)
+
+// MaxClock is the highest SCLK frequency supported by the devices.
+const MaxClock = 50000000
+
+// ReadConfig returns the FT1248 configuration in the EEPROM.
+func ReadConfig(h d2xx.Handle) (eeprom.FT1248, error) {
+	d, ee, err := readEEPROM(h)
+	if err != nil {
+		return eeprom.FT1248{}, err
+	}
+	c, err := eeprom.GetFT1248(d, ee.Raw)
+	if err != nil {
+		return c, fmt.Errorf("ft1248: %w", err)
+	}
+	return c, nil
+}
+
+// Configure writes the FT1248 configuration to the EEPROM.
+//
+// On the FT232H, enabling FT1248 disables the 245 FIFO and fast serial
+// modes. The EEPROM is only programmed if the configuration changed.
+func Configure(h d2xx.Handle, c *eeprom.FT1248) error {
+	d, ee, err := readEEPROM(h)
+	if err != nil {
+		return err
+	}
+	old := append([]byte(nil), ee.Raw...)
+	if err := eeprom.SetFT1248(d, ee.Raw, c); err != nil {
+		return fmt.Errorf("ft1248: %w", err)
+	}
+	if bytes.Equal(old, ee.Raw) {
+		return nil
+	}
+	if e := h.EEPROMProgram(ee); e != 0 {
+		return toErr("EEPROMProgram", e)
+	}
+	return nil
+}
+
+// Opts is the configuration of a Port.
+type Opts struct {
+	// Width is the bus width used by the MCU: 1, 2, 4 or 8. Defaults to 8.
+	Width int
+	// Clock is the SCLK frequency driven by the MCU in Hz. Defaults to
+	// 10MHz.
+	Clock uint32
+}
+
+// Port is the USB side of the FT1248 interface. It implements io.ReadWriter.
+//
+// It is not safe for concurrent use.
+type Port struct {
+	h      d2xx.Handle
+	cfg    eeprom.FT1248
+	width  int
+	clock  uint32
+	buffer int
+	// readMS and writeMS are the current timeouts.
+	readMS  int
+	writeMS int
+}
+
+var (
+	// ErrTimeout is returned when the MCU didn't transfer data in time.
+	ErrTimeout = errors.New("ft1248: timed out")
+	// ErrStalled is returned by Write when flow control is enabled and the
+	// MCU didn't read the data in time.
+	ErrStalled = errors.New("ft1248: stalled by flow control")
+)
+
+// New checks that FT1248 is enabled in the EEPROM and prepares the handle.
+func New(h d2xx.Handle, opts *Opts) (*Port, error) {
+	o := Opts{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Width == 0 {
+		o.Width = 8
+	}
+	if o.Clock == 0 {
+		o.Clock = 10000000
+	}
+	if o.Width != 1 && o.Width != 2 && o.Width != 4 && o.Width != 8 {
+		return nil, fmt.Errorf("ft1248: invalid bus width %d", o.Width)
+	}
+	if o.Clock > MaxClock {
+		return nil, fmt.Errorf("ft1248: clock %dHz is too high; max is %dHz", o.Clock, MaxClock)
+	}
+	d, ee, err := readEEPROM(h)
+	if err != nil {
+		return nil, err
+	}
+	c, err := eeprom.GetFT1248(d, ee.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("ft1248: %w", err)
+	}
+	if !c.Enabled {
+		return nil, errors.New("ft1248: the EEPROM doesn't enable FT1248")
+	}
+	p := &Port{h: h, cfg: c, width: o.Width, clock: o.Clock, buffer: 512}
+	if d == d2xx.Device232H {
+		p.buffer = 1024
+	}
+	p.readMS = p.timeout(p.buffer)
+	p.writeMS = p.readMS
+	if e := h.ResetDevice(); e != 0 {
+		return nil, toErr("ResetDevice", e)
+	}
+	if e := h.SetBitMode(0, d2xx.BitModeReset); e != 0 {
+		return nil, toErr("SetBitMode", e)
+	}
+	if e := h.SetUSBParameters(p.buffer, p.buffer); e != 0 {
+		return nil, toErr("SetUSBParameters", e)
+	}
+	if e := h.SetTimeouts(p.readMS, p.writeMS); e != 0 {
+		return nil, toErr("SetTimeouts", e)
+	}
+	return p, nil
+}
+
+// Config returns the FT1248 configuration read from the EEPROM.
+func (p *Port) Config() eeprom.FT1248 {
+	return p.cfg
+}
+
+// Width returns the bus width.
+func (p *Port) Width() int {
+	return p.width
+}
+
+// Throughput returns the highest data rate of the bus in bytes per second,
+// ignoring the command and turnaround cycles.
+func (p *Port) Throughput() float64 {
+	return float64(p.clock) * float64(p.width) / 8
+}
+
+// Read implements io.Reader.
+//
+// It returns the bytes already sent by the MCU, or waits up to the timeout
+// for the first one.
+func (p *Port) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	q, e := p.h.GetQueueStatus()
+	if e != 0 {
+		return 0, toErr("GetQueueStatus", e)
+	}
+	n := int(q)
+	if n == 0 {
+		n = 1
+	}
+	if n > len(b) {
+		n = len(b)
+	}
+	got, e := p.h.Read(b[:n])
+	if e != 0 {
+		return got, toErr("Read", e)
+	}
+	if got == 0 {
+		return 0, ErrTimeout
+	}
+	return got, nil
+}
+
+// Write implements io.Writer.
+//
+// Without flow control, the data is sent one device buffer at a time and
+// ErrTimeout means the MCU stopped reading. With flow control, the data is
+// sent in a single transfer with a timeout sized for its length, and
+// ErrStalled means the MCU didn't read it in time.
+func (p *Port) Write(b []byte) (int, error) {
+	if p.cfg.FlowControl {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		if ms := p.timeout(len(b)); ms > p.writeMS {
+			if e := p.h.SetTimeouts(p.readMS, ms); e != 0 {
+				return 0, toErr("SetTimeouts", e)
+			}
+			p.writeMS = ms
+		}
+		n, e := p.h.Write(b)
+		if e != 0 {
+			return n, toErr("Write", e)
+		}
+		if n != len(b) {
+			return n, ErrStalled
+		}
+		return n, nil
+	}
+	w := 0
+	for w < len(b) {
+		c := b[w:]
+		if len(c) > p.buffer {
+			c = c[:p.buffer]
+		}
+		n, e := p.h.Write(c)
+		w += n
+		if e != 0 {
+			return w, toErr("Write", e)
+		}
+		if n == 0 {
+			return w, ErrTimeout
+		}
+	}
+	return w, nil
+}
+
+//
+
+// timeout returns the timeout in ms to transfer n bytes, giving the MCU 4
+// times the time needed plus scheduling slack.
+func (p *Port) timeout(n int) int {
+	return int((4*p.transferTime(n) + 50*time.Millisecond) / time.Millisecond)
+}
+
+// transferTime returns the time to transfer n bytes on the bus.
+func (p *Port) transferTime(n int) time.Duration {
+	clocks := int64(n) * 8 / int64(p.width)
+	return time.Duration(clocks * int64(time.Second) / int64(p.clock))
+}
+
+func readEEPROM(h d2xx.Handle) (uint32, *d2xx.EEPROM, error) {
+	d, _, _, e := h.GetDeviceInfo()
+	if e != 0 {
+		return 0, nil, toErr("GetDeviceInfo", e)
+	}
+	ee, err := eeprom.Read(h, d)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ft1248: %w", err)
+	}
+	return d, ee, nil
+}
+
+func toErr(op string, e d2xx.Err) error {
+	return fmt.Errorf("ft1248: %s: %s", op, e)
+}
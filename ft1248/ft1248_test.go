@@ -0,0 +1,143 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package ft1248_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/eeprom"
+	"periph.io/x/d2xx/ft1248"
+)
+
+func TestConfigure(t *testing.T) {
+	f := d2xxtest.NewFT1248(d2xx.Device232H)
+	if err := eeprom.SetFIFO(d2xx.Device232H, f.E.Raw, true); err != nil {
+		t.Fatal(err)
+	}
+	want := eeprom.FT1248{Enabled: true, CPOL: true, FlowControl: true}
+	if err := ft1248.Configure(f, &want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ft1248.ReadConfig(f)
+	if err != nil || got != want || f.Programs != 1 {
+		t.Fatalf("%+v %v %d", got, err, f.Programs)
+	}
+	if ok, _ := eeprom.FIFO(d2xx.Device232H, f.E.Raw); ok {
+		t.Fatal("FT1248 and 245 FIFO are exclusive")
+	}
+	// Unchanged.
+	if err := ft1248.Configure(f, &want); err != nil || f.Programs != 1 {
+		t.Fatal(err)
+	}
+
+	x := d2xxtest.NewFT1248(d2xx.DeviceXSeries)
+	if err := ft1248.Configure(x, &eeprom.FT1248{LSBFirst: true}); err == nil {
+		t.Fatal("FT1248 can't be disabled on FT-X")
+	}
+	if err := ft1248.Configure(x, &eeprom.FT1248{Enabled: true, LSBFirst: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ft1248.ReadConfig(x); err != nil || !got.LSBFirst || !got.Enabled {
+		t.Fatalf("%+v %v", got, err)
+	}
+	r := d2xxtest.NewFT1248(d2xx.DeviceXSeries)
+	r.DevType = d2xx.Device232R
+	if err := ft1248.Configure(r, &want); err == nil {
+		t.Fatal("unsupported device")
+	}
+}
+
+func TestPort(t *testing.T) {
+	f := d2xxtest.NewFT1248(d2xx.DeviceXSeries)
+	// The MCU echoes the data inverted.
+	f.MCU = func(b []byte) []byte {
+		out := make([]byte, len(b))
+		for i, c := range b {
+			out[i] = ^c
+		}
+		return out
+	}
+	p, err := ft1248.New(f, &ft1248.Opts{Width: 4, Clock: 20000000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Width() != 4 || p.Throughput() != 10e6 || !p.Config().Enabled {
+		t.Fatalf("%d %g", p.Width(), p.Throughput())
+	}
+	data := bytes.Repeat([]byte{0x0F, 0xF0}, 1000)
+	if _, err := p.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(p, got); err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != 0xF0 || got[1999] != 0x0F {
+		t.Fatalf("%#x", got[:2])
+	}
+	if _, err := p.Read(got); err != ft1248.ErrTimeout {
+		t.Fatal(err)
+	}
+	f.MCU = nil
+	if _, err := p.Write(data); err != ft1248.ErrTimeout {
+		t.Fatal(err)
+	}
+
+	if _, err := ft1248.New(f, &ft1248.Opts{Width: 3}); err == nil {
+		t.Fatal("invalid width")
+	}
+	if _, err := ft1248.New(f, &ft1248.Opts{Clock: 60000000}); err == nil {
+		t.Fatal("clock too high")
+	}
+	h := d2xxtest.NewFT1248(d2xx.Device232H)
+	if err := eeprom.SetFT1248(d2xx.Device232H, h.E.Raw, &eeprom.FT1248{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ft1248.New(h, nil); err == nil {
+		t.Fatal("FT1248 disabled")
+	}
+}
+
+func TestPort_flowControl(t *testing.T) {
+	data := make([]byte, 8192)
+	for _, fc := range []bool{false, true} {
+		f := d2xxtest.NewFT1248(d2xx.DeviceXSeries)
+		if err := eeprom.SetFT1248(d2xx.DeviceXSeries, f.E.Raw, &eeprom.FT1248{Enabled: true, FlowControl: fc}); err != nil {
+			t.Fatal(err)
+		}
+		f.MCU = func(b []byte) []byte { return nil }
+		p, err := ft1248.New(f, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		timeout := f.WriteTimeout
+		if n, err := p.Write(data); n != len(data) || err != nil {
+			t.Fatal(n, err)
+		}
+		// Without flow control, one device buffer per transfer.
+		want := 16
+		if fc {
+			want = 1
+		}
+		if len(f.Writes) != want {
+			t.Fatalf("%t: %d transfers", fc, len(f.Writes))
+		}
+		if fc != (f.WriteTimeout > timeout) {
+			t.Fatalf("%t: timeout %d -> %d", fc, timeout, f.WriteTimeout)
+		}
+		f.MCU = nil
+		wantErr := ft1248.ErrTimeout
+		if fc {
+			wantErr = ft1248.ErrStalled
+		}
+		if _, err := p.Write(data); err != wantErr {
+			t.Fatalf("%t: %v", fc, err)
+		}
+	}
+}
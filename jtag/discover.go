@@ -0,0 +1,174 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package jtag
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Limits used by Discover.
+const (
+	maxDevices = 64
+	maxIRBits  = 2048
+)
+
+// Discover scans the chain, then sets and returns Devices.
+//
+// It resets the TAPs, measures the total instruction register length by
+// flushing it, counts the devices in BYPASS, then reads the IDCODE of the
+// devices that have one. The TAPs are left in BYPASS in RunTestIdle.
+//
+// The individual instruction register lengths are inferred from the values
+// captured in CaptureIR, which must start with 01 per IEEE 1149.1. When this
+// is ambiguous, IRLen is left to 0 and must be set by the caller before using
+// DeviceIR.
+func (t *Controller) Discover() ([]Device, error) {
+	if err := t.Reset(); err != nil {
+		return nil, err
+	}
+	captured, irLen, err := t.scanIR()
+	if err != nil {
+		return nil, err
+	}
+	n, err := t.countDevices()
+	if err != nil {
+		return nil, err
+	}
+	if (n == 0) != (irLen == 0) {
+		return nil, fmt.Errorf("jtag: inconsistent chain: %d devices, %d IR bits", n, irLen)
+	}
+	if err := t.Reset(); err != nil {
+		return nil, err
+	}
+	ids, err := t.scanIDCodes(n)
+	if err != nil {
+		return nil, err
+	}
+	lens := splitIR(captured, irLen, n)
+	devs := make([]Device, n)
+	for i := range devs {
+		devs[i].IDCode = ids[i]
+		devs[i].IRLen = lens[i]
+		devs[i].Name = ids[i].ManufacturerName()
+	}
+	// Leave all the devices in BYPASS.
+	if irLen != 0 {
+		if err := t.ShiftIR(nil, nil, irLen, RunTestIdle); err != nil {
+			return nil, err
+		}
+	}
+	t.Devices = devs
+	return devs, nil
+}
+
+//
+
+// scanIR flushes the instruction registers with zeros then ones and returns
+// the captured values and the total length.
+func (t *Controller) scanIR() ([]byte, int, error) {
+	out := make([]byte, 2*maxIRBits/8)
+	for i := maxIRBits / 8; i < len(out); i++ {
+		out[i] = 0xFF
+	}
+	in := make([]byte, len(out))
+	if err := t.ShiftIR(out, in, 2*maxIRBits, RunTestIdle); err != nil {
+		return nil, 0, err
+	}
+	i := firstOne(in, maxIRBits, 2*maxIRBits)
+	if i < 0 {
+		return nil, 0, errors.New("jtag: TDO seems stuck low or the chain is too long")
+	}
+	l := i - maxIRBits
+	captured := make([]byte, (l+7)/8)
+	copyBits(captured, 0, in, 0, l)
+	return captured, l, nil
+}
+
+// countDevices counts the number of devices in BYPASS.
+func (t *Controller) countDevices() (int, error) {
+	out := make([]byte, 2*maxDevices/8)
+	for i := maxDevices / 8; i < len(out); i++ {
+		out[i] = 0xFF
+	}
+	in := make([]byte, len(out))
+	if err := t.ShiftDR(out, in, 2*maxDevices, RunTestIdle); err != nil {
+		return 0, err
+	}
+	i := firstOne(in, maxDevices, 2*maxDevices)
+	if i < 0 {
+		return 0, errors.New("jtag: TDO seems stuck low or the chain is too long")
+	}
+	return i - maxDevices, nil
+}
+
+// scanIDCodes reads the data registers selected after a reset, which is
+// either IDCODE or BYPASS.
+func (t *Controller) scanIDCodes(n int) ([]IDCode, error) {
+	bits := 32*n + 32
+	out := ones(bits)
+	in := make([]byte, len(out))
+	if err := t.ShiftDR(out, in, bits, RunTestIdle); err != nil {
+		return nil, err
+	}
+	ids := make([]IDCode, n)
+	for i, off := 0, 0; i < n; i++ {
+		if in[off/8]>>(off%8)&1 == 0 {
+			// BYPASS.
+			off++
+			continue
+		}
+		var v [4]byte
+		copyBits(v[:], 0, in, off, 32)
+		id := IDCode(uint32(v[0]) | uint32(v[1])<<8 | uint32(v[2])<<16 | uint32(v[3])<<24)
+		if !id.Valid() {
+			return nil, fmt.Errorf("jtag: invalid IDCODE 0x%08X for device %d", uint32(id), i)
+		}
+		ids[i] = id
+		off += 32
+	}
+	return ids, nil
+}
+
+// splitIR infers the instruction register length of n devices from the
+// concatenated values captured in CaptureIR.
+//
+// Each device must capture 01 in its two least significant bits. It returns
+// zeros if the split is ambiguous.
+func splitIR(captured []byte, total, n int) []int {
+	lens := make([]int, n)
+	if n == 1 {
+		lens[0] = total
+		return lens
+	}
+	bit := func(i int) byte { return captured[i/8] >> (i % 8) & 1 }
+	var starts []int
+	for i := 0; i+1 < total; i++ {
+		if bit(i) == 1 && bit(i+1) == 0 {
+			starts = append(starts, i)
+		}
+	}
+	if n == 0 || len(starts) != n || starts[0] != 0 {
+		return lens
+	}
+	for i := range starts {
+		end := total
+		if i+1 < n {
+			end = starts[i+1]
+		}
+		lens[i] = end - starts[i]
+	}
+	return lens
+}
+
+// firstOne returns the index of the first bit set in [from, to) or -1.
+func firstOne(b []byte, from, to int) int {
+	for i := from; i < to; i++ {
+		if b[i/8]>>(i%8)&1 != 0 {
+			return i
+		}
+	}
+	return -1
+}
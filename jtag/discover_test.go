@@ -0,0 +1,148 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package jtag_test
+
+import (
+	"bytes"
+	"testing"
+
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/jtag"
+)
+
+func TestDiscover(t *testing.T) {
+	chain := d2xxtest.NewJTAGChain(
+		&d2xxtest.TAP{IRLen: 6, IDCode: 0x13631093, IDCodeIR: 0x09},
+		&d2xxtest.TAP{IRLen: 3},
+		&d2xxtest.TAP{IRLen: 4, IDCode: 0x4BA00477, IDCodeIR: 0x0E},
+	)
+	c, err := jtag.New(chain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devs, err := c.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []jtag.Device{
+		{Name: "Xilinx", IRLen: 6, IDCode: 0x13631093},
+		{IRLen: 3},
+		{Name: "ARM", IRLen: 4, IDCode: 0x4BA00477},
+	}
+	if len(devs) != len(want) {
+		t.Fatalf("got %d devices, want %d: %+v", len(devs), len(want), devs)
+	}
+	for i := range want {
+		if devs[i] != want[i] {
+			t.Errorf("#%d: got %+v, want %+v", i, devs[i], want[i])
+		}
+	}
+	for i, tap := range chain.TAPs {
+		if tap.IR != 1<<uint(tap.IRLen)-1 {
+			t.Errorf("#%d: expected BYPASS, got %#x", i, tap.IR)
+		}
+	}
+	if s := c.State(); s != jtag.RunTestIdle {
+		t.Fatalf("unexpected state %s", s)
+	}
+}
+
+func TestDiscover_empty(t *testing.T) {
+	c, err := jtag.New(d2xxtest.NewJTAGChain(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devs, err := c.Discover()
+	if err != nil || len(devs) != 0 {
+		t.Fatal(devs, err)
+	}
+}
+
+func TestDiscover_ambiguousIR(t *testing.T) {
+	chain := d2xxtest.NewJTAGChain(
+		&d2xxtest.TAP{IRLen: 4, IRCapture: 0x5},
+		&d2xxtest.TAP{IRLen: 4, IDCode: 0x4BA00477, IDCodeIR: 0x0E},
+	)
+	c, err := jtag.New(chain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devs, err := c.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 2 || devs[0].IRLen != 0 || devs[1].IRLen != 0 {
+		t.Fatalf("%+v", devs)
+	}
+}
+
+func TestController_DeviceDR(t *testing.T) {
+	reg := &d2xxtest.DR{Len: 12, Value: []byte{0x34, 0x02}}
+	chain := d2xxtest.NewJTAGChain(
+		&d2xxtest.TAP{IRLen: 5},
+		&d2xxtest.TAP{IRLen: 8, IDCode: 0x020F10DD, IDCodeIR: 0x06, Regs: map[uint64]*d2xxtest.DR{0x42: reg}},
+		&d2xxtest.TAP{IRLen: 2},
+	)
+	c, err := jtag.New(chain, &jtag.Opts{Hz: 10000000, TRST: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Discover(); err != nil {
+		t.Fatal(err)
+	}
+	ir := make([]byte, 1)
+	if err := c.DeviceIR(1, []byte{0x42}, ir); err != nil {
+		t.Fatal(err)
+	}
+	if ir[0] != 0x01 {
+		t.Fatalf("unexpected IR capture %#x", ir)
+	}
+	if chain.TAPs[1].IR != 0x42 || chain.TAPs[0].IR != 0x1F || chain.TAPs[2].IR != 0x3 {
+		t.Fatalf("unexpected IR %#x %#x %#x", chain.TAPs[0].IR, chain.TAPs[1].IR, chain.TAPs[2].IR)
+	}
+	in := make([]byte, 2)
+	if err := c.DeviceDR(1, []byte{0xCD, 0x0A}, in, 12); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(in, []byte{0x34, 0x02}) {
+		t.Fatalf("unexpected capture %#x", in)
+	}
+	if !bytes.Equal(reg.Value, []byte{0xCD, 0x0A}) {
+		t.Fatalf("unexpected update %#x", reg.Value)
+	}
+	if err := c.RunTestIdle(100); err != nil {
+		t.Fatal(err)
+	}
+	if chain.TAPs[1].Idle < 100 {
+		t.Fatalf("expected at least 100 idle clocks, got %d", chain.TAPs[1].Idle)
+	}
+
+	chain.TRST = 4
+	if err := c.TRST(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.TRST(false); err != nil {
+		t.Fatal(err)
+	}
+	if chain.TAPs[1].IR != 0x06 {
+		t.Fatalf("expected IDCODE after TRST, got %#x", chain.TAPs[1].IR)
+	}
+	if err := c.SRST(true); err == nil {
+		t.Fatal("SRST is not connected")
+	}
+}
+
+func TestIDCode(t *testing.T) {
+	id := jtag.IDCode(0x4BA00477)
+	if !id.Valid() || id.ManufacturerName() != "ARM" || id.Part() != 0xBA00 || id.Version() != 4 {
+		t.Fatal(id)
+	}
+	if s := id.String(); s != "0x4BA00477 (ARM, part 0xba00, ver 4)" {
+		t.Fatal(s)
+	}
+	if s := jtag.IDCode(0x00000FFF).String(); s != "0x00000FFF (mfr 16:0x7f, part 0x0000, ver 0)" {
+		t.Fatal(s)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package jtag
+
+import (
+	_ "embed"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IDCode is a 32 bits IEEE 1149.1 device identification.
+type IDCode uint32
+
+// Valid returns true if the IDCODE is well formed: the LSB is 1 and the
+// manufacturer is not the reserved value.
+func (i IDCode) Valid() bool {
+	return i&1 == 1 && i.Manufacturer()&0x7F != 0x7F && i != 0xFFFFFFFF
+}
+
+// Manufacturer returns the 11 bits JEP106 manufacturer identity: the number
+// of continuation codes in the upper 4 bits and the code in the lower 7 bits.
+func (i IDCode) Manufacturer() uint16 {
+	return uint16(i>>1) & 0x7FF
+}
+
+// Part returns the 16 bits part number.
+func (i IDCode) Part() uint16 {
+	return uint16(i >> 12)
+}
+
+// Version returns the 4 bits version.
+func (i IDCode) Version() uint8 {
+	return uint8(i >> 28)
+}
+
+// ManufacturerName returns the manufacturer name or an empty string if
+// unknown.
+func (i IDCode) ManufacturerName() string {
+	return jep106[i.Manufacturer()]
+}
+
+// String returns a human readable description.
+func (i IDCode) String() string {
+	m := i.ManufacturerName()
+	if m == "" {
+		m = fmt.Sprintf("mfr %d:%#02x", i.Manufacturer()>>7+1, i.Manufacturer()&0x7F)
+	}
+	return fmt.Sprintf("0x%08X (%s, part %#04x, ver %d)", uint32(i), m, i.Part(), i.Version())
+}
+
+//
+
+//go:embed jep106.txt
+var jep106Raw string
+
+// jep106 maps the 11 bits manufacturer identity to its name.
+var jep106 = func() map[uint16]string {
+	m := map[uint16]string{}
+	for _, l := range strings.Split(jep106Raw, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || l[0] == '#' {
+			continue
+		}
+		f := strings.SplitN(l, " ", 3)
+		if len(f) != 3 {
+			panic("jtag: invalid jep106 line: " + l)
+		}
+		bank, err1 := strconv.ParseUint(f[0], 10, 8)
+		code, err2 := strconv.ParseUint(f[1], 0, 8)
+		if err1 != nil || err2 != nil || bank == 0 || bank > 16 || code > 0x7F {
+			panic("jtag: invalid jep106 line: " + l)
+		}
+		m[uint16(bank-1)<<7|uint16(code)] = f[2]
+	}
+	return m
+}()
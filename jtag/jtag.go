@@ -0,0 +1,440 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package jtag implements an IEEE 1149.1 JTAG controller on top of a FTDI
+// MPSSE port.
+//
+// The standard MPSSE JTAG wiring is used:
+//
+//   - ADBUS0: TCK
+//   - ADBUS1: TDI
+//   - ADBUS2: TDO
+//   - ADBUS3: TMS
+//
+// The optional TRST and SRST signals are active low and can be assigned to
+// any of the remaining ADBUS4~7 or ACBUS0~7 pins.
+//
+// Bit streams are passed LSB first: bit i is (b[i/8] >> (i%8)) & 1 and bit 0
+// is the first one shifted in on TDI.
+package jtag
+
+import (
+	"errors"
+	"fmt"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/mpsse"
+)
+
+// ErrNoPin is returned when using TRST or SRST while the pin is not
+// connected.
+var ErrNoPin = errors.New("jtag: pin is not connected")
+
+// Pin is a MPSSE GPIO pin.
+//
+// Since ADBUS0~3 are used by JTAG, the zero value means not connected.
+type Pin = mpsse.Pin
+
+// Opts is the configuration of a Controller.
+type Opts struct {
+	// Hz is the TCK frequency. Defaults to 1MHz.
+	Hz uint32
+	// TRST is the active low TAP reset pin.
+	TRST Pin
+	// SRST is the active low system reset pin.
+	SRST Pin
+	// LowValue, LowDir, HighValue and HighDir is the initial state of the pins
+	// not used for JTAG, e.g. to enable the output buffers of some cables. A bit
+	// set in the direction means output.
+	LowValue, LowDir, HighValue, HighDir byte
+}
+
+// Device is a TAP in the chain.
+type Device struct {
+	// Name is an optional user friendly name.
+	Name string
+	// IRLen is the length of the instruction register.
+	IRLen int
+	// IDCode is the expected IDCODE, if known.
+	IDCode IDCode
+}
+
+// Controller drives a JTAG chain through a MPSSE port.
+//
+// It is not safe for concurrent use.
+type Controller struct {
+	c     *mpsse.Conn
+	state State
+	hz    uint32
+	// Devices is the chain configuration, listed from the one closest to TDO
+	// to the one closest to TDI. This is the order in which the IDCODEs are
+	// read after a reset.
+	Devices []Device
+
+	trst Pin
+	srst Pin
+}
+
+// New initializes the handle in MPSSE mode and returns a Controller with the
+// TAP in TestLogicReset.
+func New(h d2xx.Handle, opts *Opts) (*Controller, error) {
+	c := mpsse.New(h)
+	if err := c.Init(); err != nil {
+		return nil, err
+	}
+	return NewFromConn(c, opts)
+}
+
+// NewFromConn returns a Controller on an already initialized MPSSE
+// connection.
+func NewFromConn(c *mpsse.Conn, opts *Opts) (*Controller, error) {
+	o := Opts{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Hz == 0 {
+		o.Hz = 1000000
+	}
+	for _, p := range []Pin{o.TRST, o.SRST} {
+		if p != 0 && (p < 4 || p > 15) {
+			return nil, fmt.Errorf("jtag: invalid pin %d", p)
+		}
+	}
+	t := &Controller{c: c, state: TestLogicReset}
+	g := c.GPIO()
+	g.SetBank(0, o.LowValue&^0x0F, o.LowDir&^0x0F|0x0B)
+	g.SetBank(1, o.HighValue, o.HighDir)
+	for _, p := range []Pin{o.TRST, o.SRST} {
+		if p != 0 {
+			g.Out(p, true)
+		}
+	}
+	t.trst, t.srst = o.TRST, o.SRST
+	c.Queue(mpsse.LoopbackOff, mpsse.AdaptiveOff)
+	if c.HighSpeed() {
+		c.Queue(mpsse.ThreePhaseOff)
+	}
+	hz, err := c.SetClock(o.Hz)
+	if err != nil {
+		return nil, err
+	}
+	t.hz = hz
+	t.setGPIO(0)
+	t.setGPIO(1)
+	if err := t.Reset(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Conn returns the underlying MPSSE connection.
+func (t *Controller) Conn() *mpsse.Conn {
+	return t.c
+}
+
+// Hz returns the effective TCK frequency.
+func (t *Controller) Hz() uint32 {
+	return t.hz
+}
+
+// SetHz changes the TCK frequency and returns the effective frequency.
+func (t *Controller) SetHz(hz uint32) (uint32, error) {
+	f, err := t.c.SetClock(hz)
+	if err != nil {
+		return 0, err
+	}
+	if err := t.c.Flush(); err != nil {
+		return 0, err
+	}
+	t.hz = f
+	return f, nil
+}
+
+// State returns the current TAP state.
+func (t *Controller) State() State {
+	return t.state
+}
+
+// Reset moves the TAP to TestLogicReset by clocking TMS high 5 times.
+//
+// It works from any state.
+func (t *Controller) Reset() error {
+	t.tms(0x1F, 5)
+	t.state = TestLogicReset
+	return t.c.Flush()
+}
+
+// GoTo moves the TAP to the specified state.
+func (t *Controller) GoTo(s State) error {
+	t.goTo(s)
+	return t.c.Flush()
+}
+
+// Clock clocks TCK in the current state.
+//
+// The current state must be stable.
+func (t *Controller) Clock(cycles int) error {
+	if !t.state.Stable() || t.state == ShiftDR || t.state == ShiftIR {
+		return fmt.Errorf("jtag: can't clock in state %s", t.state)
+	}
+	t.clock(cycles)
+	return t.c.Flush()
+}
+
+// RunTestIdle moves to RunTestIdle and clocks TCK for the specified number of
+// cycles.
+func (t *Controller) RunTestIdle(cycles int) error {
+	t.goTo(RunTestIdle)
+	t.clock(cycles)
+	return t.c.Flush()
+}
+
+// ShiftIR shifts bits in the instruction registers of the whole chain, then
+// moves to end.
+//
+// in may be nil if TDO is not needed. If out is nil, ones are shifted in,
+// which selects BYPASS.
+func (t *Controller) ShiftIR(out, in []byte, bits int, end State) error {
+	if out == nil {
+		out = ones(bits)
+	}
+	return t.shift(ShiftIR, out, in, bits, end)
+}
+
+// ShiftDR shifts bits in the data registers of the whole chain, then moves to
+// end.
+//
+// in may be nil if TDO is not needed. If out is nil, zeros are shifted in.
+func (t *Controller) ShiftDR(out, in []byte, bits int, end State) error {
+	if out == nil {
+		out = make([]byte, (bits+7)/8)
+	}
+	return t.shift(ShiftDR, out, in, bits, end)
+}
+
+// DeviceIR loads instruction ir into the device at index dev of Devices and
+// BYPASS in all the others, then moves to RunTestIdle.
+//
+// If in is not nil, the value captured in the device instruction register is
+// returned.
+func (t *Controller) DeviceIR(dev int, ir, in []byte) error {
+	if dev < 0 || dev >= len(t.Devices) {
+		return fmt.Errorf("jtag: invalid device %d", dev)
+	}
+	total, off := 0, 0
+	for i, d := range t.Devices {
+		if d.IRLen <= 0 {
+			return fmt.Errorf("jtag: device %d has unknown IR length", i)
+		}
+		if i == dev {
+			off = total
+		}
+		total += d.IRLen
+	}
+	l := t.Devices[dev].IRLen
+	out := ones(total)
+	copyBits(out, off, ir, 0, l)
+	var all []byte
+	if in != nil {
+		all = make([]byte, len(out))
+	}
+	if err := t.ShiftIR(out, all, total, RunTestIdle); err != nil {
+		return err
+	}
+	if in != nil {
+		copyBits(in, 0, all, off, l)
+	}
+	return nil
+}
+
+// DeviceDR shifts bits in the data register of the device at index dev of
+// Devices, then moves to RunTestIdle.
+//
+// All the other devices must be in BYPASS, e.g. after a call to DeviceIR.
+func (t *Controller) DeviceDR(dev int, out, in []byte, bits int) error {
+	if dev < 0 || dev >= len(t.Devices) {
+		return fmt.Errorf("jtag: invalid device %d", dev)
+	}
+	total := bits + len(t.Devices) - 1
+	o := make([]byte, (total+7)/8)
+	if out != nil {
+		copyBits(o, dev, out, 0, bits)
+	}
+	var all []byte
+	if in != nil {
+		all = make([]byte, len(o))
+	}
+	if err := t.ShiftDR(o, all, total, RunTestIdle); err != nil {
+		return err
+	}
+	if in != nil {
+		copyBits(in, 0, all, dev, bits)
+	}
+	return nil
+}
+
+// TRST asserts or deasserts the TAP reset signal.
+//
+// Asserting TRST moves the TAP to TestLogicReset.
+func (t *Controller) TRST(assert bool) error {
+	if t.trst == 0 {
+		return ErrNoPin
+	}
+	t.setPin(t.trst, !assert)
+	if assert {
+		t.state = TestLogicReset
+	}
+	return t.c.Flush()
+}
+
+// SRST asserts or deasserts the system reset signal.
+func (t *Controller) SRST(assert bool) error {
+	if t.srst == 0 {
+		return ErrNoPin
+	}
+	t.setPin(t.srst, !assert)
+	return t.c.Flush()
+}
+
+//
+
+func (t *Controller) shift(s State, out, in []byte, bits int, end State) error {
+	if bits <= 0 {
+		return errors.New("jtag: invalid bit length")
+	}
+	if len(out)*8 < bits || (in != nil && len(in)*8 < bits) {
+		return errors.New("jtag: buffer too short")
+	}
+	if end == ShiftDR || end == ShiftIR || !end.Stable() && end != UpdateDR && end != UpdateIR {
+		return fmt.Errorf("jtag: invalid end state %s", end)
+	}
+	t.goTo(s)
+	op := mpsse.DataOut | mpsse.LSBFirst | mpsse.WriteFalling
+	if in != nil {
+		op |= mpsse.DataIn
+	}
+	n := bits - 1
+	nb, rem := n/8, n%8
+	rb := t.c.ShiftBytes(op, out, nb)
+	var rr []byte
+	if rem != 0 {
+		rr = t.c.ShiftBits(op, out[nb], rem)
+	}
+	// The last bit is shifted while leaving the Shift state.
+	exit := s + 1
+	tms, l := Path(exit, end)
+	tms = tms<<1 | 1
+	l++
+	last := out[n/8]>>(n%8)&1 != 0
+	first := l
+	if first > 7 {
+		first = 7
+	}
+	rl := t.c.TMS(byte(tms), first, last, in != nil)
+	t.tms(tms>>uint(first), l-first)
+	t.state = end
+	if err := t.c.Flush(); err != nil {
+		return err
+	}
+	if in != nil {
+		copy(in, rb)
+		if rem != 0 {
+			in[nb] = mpsse.BitsIn(rr[0], rem)
+		}
+		v := mpsse.BitsIn(rl[0], first) & 1
+		in[n/8] = in[n/8]&^(1<<(n%8)) | v<<(n%8)
+	}
+	return nil
+}
+
+func (t *Controller) goTo(s State) {
+	if t.state == s && s != TestLogicReset {
+		return
+	}
+	tms, n := Path(t.state, s)
+	t.tms(tms, n)
+	t.state = s
+}
+
+// tms queues TMS transitions, 7 bits at a time.
+func (t *Controller) tms(v uint32, n int) {
+	for n > 0 {
+		l := n
+		if l > 7 {
+			l = 7
+		}
+		t.c.TMS(byte(v), l, false, false)
+		v >>= uint(l)
+		n -= l
+	}
+}
+
+// clock queues cycles TCK clocks while keeping TMS at its current value.
+func (t *Controller) clock(cycles int) {
+	if cycles <= 0 {
+		return
+	}
+	if t.c.HighSpeed() {
+		// TMS keeps its last value, which is the one that led to the current
+		// stable state.
+		for cycles >= 8 {
+			l := cycles / 8
+			if l > 65536 {
+				l = 65536
+			}
+			t.c.Queue(mpsse.ClockBytes, byte(l-1), byte((l-1)>>8))
+			cycles -= l * 8
+		}
+		if cycles != 0 {
+			t.c.Queue(mpsse.ClockBits, byte(cycles-1))
+		}
+		return
+	}
+	v := uint32(0)
+	if t.state == TestLogicReset {
+		v = 0xFFFFFFFF
+	}
+	for cycles > 0 {
+		l := cycles
+		if l > 28 {
+			l = 28
+		}
+		t.tms(v, l)
+		cycles -= l
+	}
+}
+
+func (t *Controller) setPin(p Pin, level bool) {
+	t.c.GPIO().Set(p, level)
+	t.setGPIO(p.Bank())
+}
+
+func (t *Controller) setGPIO(bank int) {
+	v, dir := t.c.GPIO().Bank(bank)
+	if bank == 0 {
+		// Keep TMS at the level that keeps the TAP in its current state.
+		v &^= 0x0F
+		if t.state == TestLogicReset {
+			v |= 0x08
+		}
+	}
+	t.c.SetGPIO(bank, v, dir)
+}
+
+func ones(bits int) []byte {
+	b := make([]byte, (bits+7)/8)
+	for i := range b {
+		b[i] = 0xFF
+	}
+	return b
+}
+
+// copyBits copies n bits from src at bit offset so to dst at bit offset do.
+func copyBits(dst []byte, do int, src []byte, so, n int) {
+	for i := 0; i < n; i++ {
+		v := src[(so+i)/8] >> ((so + i) % 8) & 1
+		j := do + i
+		dst[j/8] = dst[j/8]&^(1<<(j%8)) | v<<(j%8)
+	}
+}
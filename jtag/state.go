@@ -0,0 +1,154 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package jtag
+
+import "strconv"
+
+// State is a state of the IEEE 1149.1 TAP controller state machine.
+type State uint8
+
+// TAP controller states.
+const (
+	TestLogicReset State = iota
+	RunTestIdle
+	SelectDRScan
+	CaptureDR
+	ShiftDR
+	Exit1DR
+	PauseDR
+	Exit2DR
+	UpdateDR
+	SelectIRScan
+	CaptureIR
+	ShiftIR
+	Exit1IR
+	PauseIR
+	Exit2IR
+	UpdateIR
+	numStates
+)
+
+var stateNames = [numStates]string{
+	"RESET", "IDLE", "DRSELECT", "DRCAPTURE", "DRSHIFT", "DREXIT1", "DRPAUSE",
+	"DREXIT2", "DRUPDATE", "IRSELECT", "IRCAPTURE", "IRSHIFT", "IREXIT1",
+	"IRPAUSE", "IREXIT2", "IRUPDATE",
+}
+
+// String returns the SVF name of the state.
+func (s State) String() string {
+	if s < numStates {
+		return stateNames[s]
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+// ParseState parses the SVF name of a state. It also accepts a few common
+// aliases like TLR and RTI.
+func ParseState(s string) (State, bool) {
+	for i, n := range stateNames {
+		if n == s {
+			return State(i), true
+		}
+	}
+	switch s {
+	case "TLR", "TEST-LOGIC-RESET":
+		return TestLogicReset, true
+	case "RTI", "RUN-TEST/IDLE", "RUN-TEST-IDLE":
+		return RunTestIdle, true
+	}
+	return 0, false
+}
+
+// Stable returns true if the TAP controller can stay in this state while TCK
+// is clocked.
+func (s State) Stable() bool {
+	switch s {
+	case TestLogicReset, RunTestIdle, ShiftDR, PauseDR, ShiftIR, PauseIR:
+		return true
+	default:
+		return false
+	}
+}
+
+// Next returns the state reached after one TCK rising edge with the specified
+// TMS value.
+func (s State) Next(tms bool) State {
+	if s >= numStates {
+		return TestLogicReset
+	}
+	t := transitions[s]
+	if tms {
+		return t[1]
+	}
+	return t[0]
+}
+
+// Path returns the shortest TMS sequence to go from one state to another.
+//
+// The sequence is returned LSB first in tms and n is the number of clocks. A
+// path to TestLogicReset is always 5 TMS high clocks, so it works from an
+// unknown state.
+func Path(from, to State) (tms uint32, n int) {
+	if to == TestLogicReset {
+		return 0x1F, 5
+	}
+	if from >= numStates || to >= numStates {
+		return 0, 0
+	}
+	p := paths[from][to]
+	return p.tms, int(p.n)
+}
+
+//
+
+// transitions is indexed by the state then by TMS.
+var transitions = [numStates][2]State{
+	TestLogicReset: {RunTestIdle, TestLogicReset},
+	RunTestIdle:    {RunTestIdle, SelectDRScan},
+	SelectDRScan:   {CaptureDR, SelectIRScan},
+	CaptureDR:      {ShiftDR, Exit1DR},
+	ShiftDR:        {ShiftDR, Exit1DR},
+	Exit1DR:        {PauseDR, UpdateDR},
+	PauseDR:        {PauseDR, Exit2DR},
+	Exit2DR:        {ShiftDR, UpdateDR},
+	UpdateDR:       {RunTestIdle, SelectDRScan},
+	SelectIRScan:   {CaptureIR, TestLogicReset},
+	CaptureIR:      {ShiftIR, Exit1IR},
+	ShiftIR:        {ShiftIR, Exit1IR},
+	Exit1IR:        {PauseIR, UpdateIR},
+	PauseIR:        {PauseIR, Exit2IR},
+	Exit2IR:        {ShiftIR, UpdateIR},
+	UpdateIR:       {RunTestIdle, SelectDRScan},
+}
+
+type path struct {
+	tms uint32
+	n   uint8
+}
+
+// paths is the precomputed shortest path between each pair of states.
+var paths = func() [numStates][numStates]path {
+	var out [numStates][numStates]path
+	for from := State(0); from < numStates; from++ {
+		var seen [numStates]bool
+		seen[from] = true
+		queue := []State{from}
+		for len(queue) != 0 {
+			s := queue[0]
+			queue = queue[1:]
+			p := out[from][s]
+			for tms := 0; tms < 2; tms++ {
+				d := transitions[s][tms]
+				if seen[d] {
+					continue
+				}
+				seen[d] = true
+				out[from][d] = path{tms: p.tms | uint32(tms)<<p.n, n: p.n + 1}
+				queue = append(queue, d)
+			}
+		}
+	}
+	return out
+}()
@@ -0,0 +1,60 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package jtag
+
+import "testing"
+
+func TestPath(t *testing.T) {
+	for from := State(0); from < numStates; from++ {
+		for to := State(0); to < numStates; to++ {
+			tms, n := Path(from, to)
+			s := from
+			for i := 0; i < n; i++ {
+				s = s.Next(tms>>uint(i)&1 != 0)
+			}
+			if s != to {
+				t.Fatalf("Path(%s, %s) = %#x, %d; reached %s", from, to, tms, n, s)
+			}
+		}
+	}
+}
+
+func TestPath_known(t *testing.T) {
+	data := []struct {
+		from, to State
+		tms      uint32
+		n        int
+	}{
+		{RunTestIdle, ShiftDR, 0x1, 3},
+		{RunTestIdle, ShiftIR, 0x3, 4},
+		{Exit1DR, RunTestIdle, 0x1, 2},
+		{Exit1IR, PauseIR, 0x0, 1},
+		{ShiftDR, TestLogicReset, 0x1F, 5},
+	}
+	for _, l := range data {
+		if tms, n := Path(l.from, l.to); tms != l.tms || n != l.n {
+			t.Errorf("Path(%s, %s) = %#x, %d; want %#x, %d", l.from, l.to, tms, n, l.tms, l.n)
+		}
+	}
+}
+
+func TestParseState(t *testing.T) {
+	for s := State(0); s < numStates; s++ {
+		if p, ok := ParseState(s.String()); !ok || p != s {
+			t.Fatalf("ParseState(%q) = %s, %t", s, p, ok)
+		}
+	}
+	if _, ok := ParseState("FOO"); ok {
+		t.Fatal("expected failure")
+	}
+}
+
+func TestCopyBits(t *testing.T) {
+	dst := []byte{0xFF, 0xFF}
+	copyBits(dst, 3, []byte{0x05}, 0, 4)
+	if dst[0] != 0xAF || dst[1] != 0xFF {
+		t.Fatalf("%#x", dst)
+	}
+}
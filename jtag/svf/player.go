@@ -0,0 +1,317 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package svf
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"periph.io/x/d2xx/jtag"
+)
+
+// MismatchError is returned when the captured TDO doesn't match the expected
+// value.
+type MismatchError struct {
+	// Line is the line number in a SVF file or the offset in a XSVF file.
+	Line int
+	Op   Op
+	// Len is the number of bits shifted, including the header and trailer.
+	Len int
+	// Got, Want and Mask are LSB first.
+	Got, Want, Mask []byte
+}
+
+func (m *MismatchError) Error() string {
+	return fmt.Sprintf("svf: line %d: %s TDO mismatch: got (%s) want (%s) mask (%s)", m.Line, m.Op, toHex(m.Got, m.Len), toHex(m.Want, m.Len), toHex(m.Mask, m.Len))
+}
+
+// Player plays statements on a JTAG controller.
+type Player struct {
+	// Sleep is used to wait for RUNTEST minimum times. It defaults to
+	// time.Sleep.
+	Sleep func(time.Duration)
+
+	c        *jtag.Controller
+	endIR    jtag.State
+	endDR    jtag.State
+	runState jtag.State
+	runEnd   jtag.State
+	// scans are the last values of SIR, SDR, HIR, HDR, TIR and TDR.
+	scans [6]Scan
+}
+
+// NewPlayer returns a Player on c with the default SVF state: ENDIR and ENDDR
+// are IDLE and there is no header nor trailer.
+func NewPlayer(c *jtag.Controller) *Player {
+	return &Player{
+		Sleep:    time.Sleep,
+		c:        c,
+		endIR:    jtag.RunTestIdle,
+		endDR:    jtag.RunTestIdle,
+		runState: jtag.RunTestIdle,
+		runEnd:   jtag.RunTestIdle,
+	}
+}
+
+// Play runs all the statements and stops at the first error.
+func (p *Player) Play(stmts []Statement) error {
+	for i := range stmts {
+		if err := p.Step(&stmts[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step runs a single statement.
+func (p *Player) Step(s *Statement) error {
+	if err := p.step(s); err != nil {
+		if _, ok := err.(*MismatchError); ok {
+			return err
+		}
+		return fmt.Errorf("svf: line %d: %s: %v", s.Line, s.Op, err)
+	}
+	return nil
+}
+
+//
+
+func (p *Player) step(s *Statement) error {
+	switch s.Op {
+	case SIR, SDR:
+		return p.scan(s)
+	case HIR, HDR, TIR, TDR:
+		return p.resolve(s.Op, &s.Scan)
+	case ENDIR:
+		p.endIR = s.State
+	case ENDDR:
+		p.endDR = s.State
+	case STATE:
+		for _, st := range s.Path {
+			if err := p.c.GoTo(st); err != nil {
+				return err
+			}
+		}
+		return p.c.GoTo(s.State)
+	case RUNTEST:
+		if s.HasState {
+			p.runState = s.State
+			p.runEnd = s.State
+		}
+		if s.HasEnd {
+			p.runEnd = s.End
+		}
+		if err := p.c.GoTo(p.runState); err != nil {
+			return err
+		}
+		if err := p.wait(s.Count, s.MinTime); err != nil {
+			return err
+		}
+		return p.c.GoTo(p.runEnd)
+	case FREQUENCY:
+		hz := uint32(30000000)
+		if s.Hz != 0 && s.Hz < float64(hz) {
+			hz = uint32(s.Hz)
+		}
+		_, err := p.c.SetHz(hz)
+		return err
+	case TRST:
+		switch s.TRST {
+		case TRSTOn:
+			if err := p.c.TRST(true); err == jtag.ErrNoPin {
+				return p.c.Reset()
+			} else if err != nil {
+				return err
+			}
+		case TRSTOff, TRSTZ:
+			if err := p.c.TRST(false); err != nil && err != jtag.ErrNoPin {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported operation")
+	}
+	return nil
+}
+
+// resolve updates the remembered scan values for op with s, applying the
+// SVF rules: TDI, MASK and SMASK are kept when the length doesn't change,
+// TDO is never kept.
+func (p *Player) resolve(op Op, s *Scan) error {
+	prev := &p.scans[op]
+	n := Scan{Len: s.Len, TDI: s.TDI, TDO: s.TDO, Mask: s.Mask, SMask: s.SMask}
+	if s.Len == prev.Len {
+		if n.TDI == nil {
+			n.TDI = prev.TDI
+		}
+		if n.Mask == nil {
+			n.Mask = prev.Mask
+		}
+		if n.SMask == nil {
+			n.SMask = prev.SMask
+		}
+	}
+	if n.TDI == nil {
+		if s.Len != 0 {
+			return fmt.Errorf("TDI must be specified when the length changes")
+		}
+		n.TDI = []byte{}
+	}
+	if n.Mask == nil {
+		n.Mask = ones(s.Len)
+	}
+	if n.SMask == nil {
+		n.SMask = ones(s.Len)
+	}
+	*prev = n
+	return nil
+}
+
+func (p *Player) scan(s *Statement) error {
+	if err := p.resolve(s.Op, &s.Scan); err != nil {
+		return err
+	}
+	// Header and trailer.
+	hdr, trl, end := &p.scans[HIR], &p.scans[TIR], p.endIR
+	if s.Op == SDR {
+		hdr, trl, end = &p.scans[HDR], &p.scans[TDR], p.endDR
+	}
+	parts := []*Scan{hdr, &p.scans[s.Op], trl}
+	total := 0
+	check := false
+	for _, x := range parts {
+		total += x.Len
+		check = check || x.TDO != nil
+	}
+	if total == 0 {
+		return nil
+	}
+	tdi := make([]byte, (total+7)/8)
+	var tdo, mask, in []byte
+	if check {
+		tdo = make([]byte, len(tdi))
+		mask = make([]byte, len(tdi))
+		in = make([]byte, len(tdi))
+	}
+	off := 0
+	for _, x := range parts {
+		putBits(tdi, off, x.TDI, x.Len)
+		if check && x.TDO != nil {
+			putBits(tdo, off, x.TDO, x.Len)
+			putBits(mask, off, x.Mask, x.Len)
+		}
+		off += x.Len
+	}
+	// The XSVF wait is done in RunTestIdle, then the TAP moves to the end
+	// state.
+	shiftEnd := end
+	if s.RunTest > 0 {
+		shiftEnd = jtag.RunTestIdle
+	}
+	for try := 0; ; try++ {
+		// XAPP503: while XREPEAT retries are left, the SDR stops in PauseDR so
+		// a mismatch is shifted again through Exit2-DR without updating or
+		// capturing the register.
+		retry := check && s.Op == SDR && try < s.Retry
+		e := shiftEnd
+		if retry {
+			e = jtag.PauseDR
+		}
+		var err error
+		if s.Op == SIR {
+			err = p.c.ShiftIR(tdi, in, total, e)
+		} else {
+			err = p.c.ShiftDR(tdi, in, total, e)
+		}
+		if err != nil {
+			return err
+		}
+		ok := !check || equalMasked(in, tdo, mask)
+		// XSVF uses one TCK per microsecond, and each retry waits 25% longer.
+		wait := s.RunTest * math.Pow(1.25, float64(try))
+		if !ok && retry {
+			if s.RunTest > 0 {
+				if err := p.wait(int(wait*1e6), wait); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if e != shiftEnd {
+			if err := p.c.GoTo(shiftEnd); err != nil {
+				return err
+			}
+		}
+		if s.RunTest > 0 {
+			if err := p.wait(int(wait*1e6), wait); err != nil {
+				return err
+			}
+			if err := p.c.GoTo(end); err != nil {
+				return err
+			}
+		}
+		if !ok {
+			return &MismatchError{Line: s.Line, Op: s.Op, Len: total, Got: in, Want: tdo, Mask: mask}
+		}
+		return nil
+	}
+}
+
+// wait clocks TCK in the current state and then sleeps for the remaining of
+// minTime, if any.
+func (p *Player) wait(clocks int, minTime float64) error {
+	st := p.c.State()
+	if clocks > 0 && st != jtag.ShiftDR && st != jtag.ShiftIR && st.Stable() {
+		if err := p.c.Clock(clocks); err != nil {
+			return err
+		}
+	}
+	if minTime > 0 {
+		if d := minTime - float64(clocks)/float64(p.c.Hz()); d > 0 {
+			p.Sleep(time.Duration(d * float64(time.Second)))
+		}
+	}
+	return nil
+}
+
+// putBits copies n bits of src at bit offset off in dst.
+func putBits(dst []byte, off int, src []byte, n int) {
+	for i := 0; i < n; i++ {
+		j := off + i
+		if src[i/8]>>uint(i%8)&1 != 0 {
+			dst[j/8] |= 1 << uint(j%8)
+		} else {
+			dst[j/8] &^= 1 << uint(j%8)
+		}
+	}
+}
+
+func equalMasked(got, want, mask []byte) bool {
+	for i := range got {
+		if (got[i]^want[i])&mask[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// toHex formats a LSB first bit stream as a MSB first hex string.
+func toHex(b []byte, bits int) string {
+	var s strings.Builder
+	for i := (bits+3)/4 - 1; i >= 0; i-- {
+		v := 0
+		for j := 3; j >= 0; j-- {
+			k := i*4 + j
+			v <<= 1
+			if k < bits && k/8 < len(b) && b[k/8]>>uint(k%8)&1 != 0 {
+				v |= 1
+			}
+		}
+		s.WriteByte("0123456789ABCDEF"[v])
+	}
+	return s.String()
+}
@@ -0,0 +1,494 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package svf parses Serial Vector Format (SVF) and Xilinx Serial Vector
+// Format (XSVF) files and plays them on a JTAG controller.
+//
+// Both formats are decoded into the same list of Statement, so the Player
+// doesn't need to know the origin.
+//
+// Scan data is stored LSB first, like in package jtag: bit i is
+// (b[i/8] >> (i%8)) & 1 and bit 0 is the first one shifted in on TDI.
+package svf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"periph.io/x/d2xx/jtag"
+)
+
+// Op is a statement opcode.
+type Op uint8
+
+// Supported operations. They are named after the SVF commands.
+const (
+	SIR Op = iota
+	SDR
+	HIR
+	HDR
+	TIR
+	TDR
+	ENDIR
+	ENDDR
+	RUNTEST
+	STATE
+	FREQUENCY
+	TRST
+)
+
+var opNames = []string{"SIR", "SDR", "HIR", "HDR", "TIR", "TDR", "ENDIR", "ENDDR", "RUNTEST", "STATE", "FREQUENCY", "TRST"}
+
+// String returns the SVF command name.
+func (o Op) String() string {
+	if int(o) < len(opNames) {
+		return opNames[o]
+	}
+	return "Op(" + strconv.Itoa(int(o)) + ")"
+}
+
+// TRSTMode is the argument of the TRST statement.
+type TRSTMode uint8
+
+// Valid TRSTMode values.
+const (
+	TRSTOff TRSTMode = iota
+	TRSTOn
+	TRSTZ
+	TRSTAbsent
+)
+
+// Scan is the argument of a SIR, SDR, HIR, HDR, TIR or TDR statement.
+//
+// Fields not specified in the source are nil. The Player resolves the values
+// carried over from a previous statement.
+type Scan struct {
+	// Len is the number of bits to shift.
+	Len int
+	// TDI is the value to shift in.
+	TDI []byte
+	// TDO is the expected value, if any.
+	TDO []byte
+	// Mask selects the bits of TDO to compare.
+	Mask []byte
+	// SMask selects the bits of TDI that are relevant. It is parsed but not
+	// used.
+	SMask []byte
+}
+
+// Statement is a single SVF statement or XSVF instruction.
+type Statement struct {
+	// Line is the line number of the statement in a SVF file, or the byte
+	// offset of the instruction in a XSVF file.
+	Line int
+	Op   Op
+
+	// Scan is set for SIR, SDR, HIR, HDR, TIR and TDR.
+	Scan Scan
+
+	// State is the end state for ENDIR and ENDDR, the run state for RUNTEST
+	// and the final state for STATE.
+	State jtag.State
+	// Path is the optional list of intermediate states for STATE.
+	Path []jtag.State
+	// End is the end state for RUNTEST. HasEnd is false if not specified.
+	End    jtag.State
+	HasEnd bool
+	// HasState is false when RUNTEST doesn't specify the run state.
+	HasState bool
+
+	// Count is the number of clocks for RUNTEST.
+	Count int
+	// SCK is true if RUNTEST specified the system clock instead of TCK.
+	SCK bool
+	// MinTime and MaxTime are in seconds for RUNTEST. MaxTime is 0 if not
+	// specified.
+	MinTime, MaxTime float64
+
+	// Hz is the argument of FREQUENCY. 0 means the maximum speed.
+	Hz float64
+
+	// TRST is the argument of TRST.
+	TRST TRSTMode
+
+	// Retry is the number of times a SDR with a TDO mismatch is retried. It
+	// is only set by XSVF's XREPEAT.
+	Retry int
+	// RunTest is an implicit wait in seconds in RunTestIdle after a SDR. It
+	// is only set by XSVF's XRUNTEST.
+	RunTest float64
+}
+
+// ParseSVF parses a SVF file.
+func ParseSVF(r io.Reader) ([]Statement, error) {
+	toks, err := tokenize(r)
+	if err != nil {
+		return nil, err
+	}
+	var out []Statement
+	for _, t := range toks {
+		s, err := parseStatement(t)
+		if err != nil {
+			return nil, fmt.Errorf("svf: line %d: %v", t.line, err)
+		}
+		if s != nil {
+			out = append(out, *s)
+		}
+	}
+	return out, nil
+}
+
+//
+
+// statementTokens is a statement as a list of words. Parenthesized values
+// are a single word with the parenthesis and white spaces removed.
+type statementTokens struct {
+	line  int
+	words []string
+	// hex is true for the words that were parenthesized.
+	hex []bool
+}
+
+func tokenize(r io.Reader) ([]statementTokens, error) {
+	br := bufio.NewReader(r)
+	var out []statementTokens
+	var cur statementTokens
+	var word bytes.Buffer
+	line := 1
+	inParen := false
+	parenLine := 0
+	flush := func(hex bool) {
+		if word.Len() != 0 || hex {
+			if len(cur.words) == 0 && hex {
+				cur.line = parenLine
+			}
+			cur.words = append(cur.words, strings.ToUpper(word.String()))
+			cur.hex = append(cur.hex, hex)
+			word.Reset()
+		}
+	}
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case c == '\n':
+			if !inParen {
+				flush(false)
+			}
+			line++
+		case c == '!' || (c == '/' && peek(br) == '/'):
+			if !inParen {
+				flush(false)
+			}
+			for {
+				c, err = br.ReadByte()
+				if err != nil || c == '\n' {
+					break
+				}
+			}
+			if err == nil {
+				line++
+			}
+		case inParen:
+			switch {
+			case c == ')':
+				inParen = false
+				flush(true)
+			case c == ' ' || c == '\t' || c == '\r':
+			default:
+				word.WriteByte(c)
+			}
+		case c == '(':
+			flush(false)
+			inParen = true
+			parenLine = line
+		case c == ')':
+			return nil, fmt.Errorf("svf: line %d: unexpected ')'", line)
+		case c == ';':
+			flush(false)
+			if len(cur.words) != 0 {
+				out = append(out, cur)
+			}
+			cur = statementTokens{}
+		case c == ' ' || c == '\t' || c == '\r':
+			flush(false)
+		default:
+			if word.Len() == 0 && len(cur.words) == 0 {
+				cur.line = line
+			}
+			word.WriteByte(c)
+		}
+	}
+	if inParen {
+		return nil, fmt.Errorf("svf: line %d: unterminated '('", parenLine)
+	}
+	flush(false)
+	if len(cur.words) != 0 {
+		return nil, fmt.Errorf("svf: line %d: missing ';'", cur.line)
+	}
+	return out, nil
+}
+
+func peek(br *bufio.Reader) byte {
+	b, err := br.Peek(1)
+	if err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+func parseStatement(t statementTokens) (*Statement, error) {
+	if t.hex[0] {
+		return nil, fmt.Errorf("unexpected value")
+	}
+	s := &Statement{Line: t.line}
+	args := t.words[1:]
+	hex := t.hex[1:]
+	switch t.words[0] {
+	case "SIR", "SDR", "HIR", "HDR", "TIR", "TDR":
+		for i, n := range opNames {
+			if n == t.words[0] {
+				s.Op = Op(i)
+			}
+		}
+		if err := parseScan(&s.Scan, args, hex); err != nil {
+			return nil, err
+		}
+	case "ENDIR", "ENDDR":
+		s.Op = ENDIR
+		if t.words[0] == "ENDDR" {
+			s.Op = ENDDR
+		}
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s expects one state", t.words[0])
+		}
+		st, err := parseStableState(args[0])
+		if err != nil {
+			return nil, err
+		}
+		s.State = st
+	case "STATE":
+		s.Op = STATE
+		if len(args) == 0 {
+			return nil, fmt.Errorf("STATE expects at least one state")
+		}
+		for i, a := range args {
+			st, ok := jtag.ParseState(a)
+			if !ok {
+				return nil, fmt.Errorf("invalid state %q", a)
+			}
+			if i == len(args)-1 {
+				if !st.Stable() || st == jtag.ShiftDR || st == jtag.ShiftIR {
+					return nil, fmt.Errorf("%s is not a valid end state", st)
+				}
+				s.State = st
+			} else {
+				s.Path = append(s.Path, st)
+			}
+		}
+	case "RUNTEST":
+		s.Op = RUNTEST
+		if err := parseRunTest(s, args); err != nil {
+			return nil, err
+		}
+	case "FREQUENCY":
+		s.Op = FREQUENCY
+		switch len(args) {
+		case 0:
+		case 2:
+			if args[1] != "HZ" {
+				return nil, fmt.Errorf("FREQUENCY expects HZ")
+			}
+			f, err := strconv.ParseFloat(args[0], 64)
+			if err != nil || !(f > 0 && f < 1e10) {
+				return nil, fmt.Errorf("invalid frequency %q", args[0])
+			}
+			if f < 1 {
+				// The player sets the clock in integer Hz.
+				return nil, fmt.Errorf("frequency %q is below 1Hz", args[0])
+			}
+			s.Hz = f
+		default:
+			return nil, fmt.Errorf("FREQUENCY expects a value in HZ")
+		}
+	case "TRST":
+		s.Op = TRST
+		if len(args) != 1 {
+			return nil, fmt.Errorf("TRST expects one argument")
+		}
+		switch args[0] {
+		case "ON":
+			s.TRST = TRSTOn
+		case "OFF":
+			s.TRST = TRSTOff
+		case "Z":
+			s.TRST = TRSTZ
+		case "ABSENT":
+			s.TRST = TRSTAbsent
+		default:
+			return nil, fmt.Errorf("invalid TRST mode %q", args[0])
+		}
+	case "PIO", "PIOMAP":
+		return nil, fmt.Errorf("%s is not supported", t.words[0])
+	default:
+		return nil, fmt.Errorf("unknown command %q", t.words[0])
+	}
+	return s, nil
+}
+
+// maxScanLen is the maximum number of bits in a scan, to bound the memory
+// allocated for a file.
+const maxScanLen = 1 << 20
+
+func parseScan(s *Scan, args []string, hex []bool) error {
+	if len(args) == 0 || hex[0] {
+		return fmt.Errorf("missing length")
+	}
+	l, err := strconv.ParseUint(args[0], 10, 31)
+	if err != nil {
+		return fmt.Errorf("invalid length %q", args[0])
+	}
+	if l > maxScanLen {
+		return fmt.Errorf("length %d is too large", l)
+	}
+	s.Len = int(l)
+	for i := 1; i < len(args); i += 2 {
+		if hex[i] || i+1 >= len(args) || !hex[i+1] {
+			return fmt.Errorf("expected KEYWORD (value)")
+		}
+		v, err := parseHex(args[i+1], s.Len)
+		if err != nil {
+			return err
+		}
+		switch args[i] {
+		case "TDI":
+			s.TDI = v
+		case "TDO":
+			s.TDO = v
+		case "MASK":
+			s.Mask = v
+		case "SMASK":
+			s.SMask = v
+		default:
+			return fmt.Errorf("unexpected %q", args[i])
+		}
+	}
+	return nil
+}
+
+// parseHex converts a MSB first hex string into a LSB first bit stream of n
+// bits.
+func parseHex(h string, n int) ([]byte, error) {
+	out := make([]byte, (n+7)/8)
+	bit := 0
+	for i := len(h) - 1; i >= 0; i-- {
+		v, err := strconv.ParseUint(h[i:i+1], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex value %q", h)
+		}
+		for j := 0; j < 4; j, bit = j+1, bit+1 {
+			if v>>uint(j)&1 == 0 {
+				continue
+			}
+			if bit >= n {
+				return nil, fmt.Errorf("value %q is larger than %d bits", h, n)
+			}
+			out[bit/8] |= 1 << uint(bit%8)
+		}
+	}
+	return out, nil
+}
+
+func parseStableState(a string) (jtag.State, error) {
+	st, ok := jtag.ParseState(a)
+	if !ok {
+		return 0, fmt.Errorf("invalid state %q", a)
+	}
+	switch st {
+	case jtag.TestLogicReset, jtag.RunTestIdle, jtag.PauseDR, jtag.PauseIR:
+		return st, nil
+	default:
+		return 0, fmt.Errorf("%s is not a stable state", st)
+	}
+}
+
+// parseRunTest parses:
+//
+//	RUNTEST [run_state] run_count run_clk [min_time SEC [MAXIMUM max_time SEC]] [ENDSTATE end_state]
+//	RUNTEST [run_state] min_time SEC [MAXIMUM max_time SEC] [ENDSTATE end_state]
+func parseRunTest(s *Statement, args []string) error {
+	if len(args) != 0 {
+		if st, ok := jtag.ParseState(args[0]); ok {
+			if _, err := parseStableState(args[0]); err != nil {
+				return err
+			}
+			s.State = st
+			s.HasState = true
+			args = args[1:]
+		}
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("RUNTEST expects a count or a time")
+	}
+	switch args[1] {
+	case "TCK", "SCK":
+		n, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || !(n >= 0 && n < 1<<31) {
+			return fmt.Errorf("invalid count %q", args[0])
+		}
+		s.Count = int(n)
+		s.SCK = args[1] == "SCK"
+		args = args[2:]
+		if len(args) >= 2 && args[1] == "SEC" {
+			if err := parseSec(&s.MinTime, args[0]); err != nil {
+				return err
+			}
+			args = args[2:]
+		}
+	case "SEC":
+		if err := parseSec(&s.MinTime, args[0]); err != nil {
+			return err
+		}
+		args = args[2:]
+	default:
+		return fmt.Errorf("unexpected %q", args[1])
+	}
+	if len(args) >= 3 && args[0] == "MAXIMUM" && args[2] == "SEC" {
+		if err := parseSec(&s.MaxTime, args[1]); err != nil {
+			return err
+		}
+		args = args[3:]
+	}
+	if len(args) == 2 && args[0] == "ENDSTATE" {
+		st, err := parseStableState(args[1])
+		if err != nil {
+			return err
+		}
+		s.End = st
+		s.HasEnd = true
+		args = args[2:]
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected %q", args[0])
+	}
+	return nil
+}
+
+func parseSec(d *float64, a string) error {
+	f, err := strconv.ParseFloat(a, 64)
+	if err != nil || !(f >= 0 && f < 1e6) {
+		return fmt.Errorf("invalid time %q", a)
+	}
+	*d = f
+	return nil
+}
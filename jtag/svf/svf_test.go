@@ -0,0 +1,288 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package svf_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/jtag"
+	"periph.io/x/d2xx/jtag/svf"
+)
+
+const program = `! Test program.
+TRST OFF;
+ENDIR IDLE;
+ENDDR IDLE;
+STATE RESET;
+// dev0 is in BYPASS.
+HIR 4 TDI (f);
+HDR 1 TDI (0);
+TIR 0;
+TDR 0;
+FREQUENCY 1.00E+06 HZ;
+SIR 8 TDI (09);
+SDR 32 TDI (00000000)
+	TDO (13631093) MASK (0FFFFFFF);
+SIR 8 TDI (42);
+SDR 12 TDI (ACD) TDO (234);
+SDR 12 TDO (ACD);
+RUNTEST 100 TCK ENDSTATE IDLE;
+RUNTEST IDLE 10 TCK 1.0E-3 SEC;
+STATE DRPAUSE;
+STATE IDLE;
+`
+
+func newChain() (*d2xxtest.JTAGChain, *d2xxtest.DR) {
+	reg := &d2xxtest.DR{Len: 12, Value: []byte{0x34, 0x02}}
+	return d2xxtest.NewJTAGChain(
+		&d2xxtest.TAP{IRLen: 4},
+		&d2xxtest.TAP{IRLen: 8, IDCode: 0x13631093, IDCodeIR: 0x09, Regs: map[uint64]*d2xxtest.DR{0x42: reg}},
+	), reg
+}
+
+func TestPlay(t *testing.T) {
+	stmts, err := svf.ParseSVF(strings.NewReader(program))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 18 {
+		t.Fatalf("got %d statements", len(stmts))
+	}
+	if s := stmts[10]; s.Op != svf.SDR || s.Line != 13 || s.Scan.Len != 32 || !bytes.Equal(s.Scan.Mask, []byte{0xFF, 0xFF, 0xFF, 0x0F}) {
+		t.Fatalf("%+v", s)
+	}
+	chain, reg := newChain()
+	c, err := jtag.New(chain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := svf.NewPlayer(c)
+	var slept time.Duration
+	p.Sleep = func(d time.Duration) { slept += d }
+	if err := p.Play(stmts); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reg.Value, []byte{0xCD, 0x0A}) {
+		t.Fatalf("unexpected register value %#x", reg.Value)
+	}
+	if slept < 980*time.Microsecond || slept > time.Millisecond {
+		t.Fatalf("unexpected sleep %s", slept)
+	}
+	if chain.TAPs[1].Idle < 110 {
+		t.Fatalf("unexpected idle clocks %d", chain.TAPs[1].Idle)
+	}
+	if s := c.State(); s != jtag.RunTestIdle {
+		t.Fatalf("unexpected state %s", s)
+	}
+}
+
+func TestPlay_mismatch(t *testing.T) {
+	src := "SIR 8 TDI (09);\nHIR 4 TDI (F);\nHDR 1 TDI (0);\nSIR 8 TDI (09);\nSDR 32 TDI (0) TDO (12345678);\n"
+	stmts, err := svf.ParseSVF(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, _ := newChain()
+	c, err := jtag.New(chain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = svf.NewPlayer(c).Play(stmts)
+	var m *svf.MismatchError
+	if !errors.As(err, &m) || m.Line != 5 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if s := err.Error(); s != "svf: line 5: SDR TDO mismatch: got (026C62126) want (02468ACF0) mask (1FFFFFFFE)" {
+		t.Fatal(s)
+	}
+}
+
+func TestParseSVF_errors(t *testing.T) {
+	data := []struct {
+		src, err string
+	}{
+		{"SIR 8 TDI (100);", "svf: line 1: value \"100\" is larger than 8 bits"},
+		{"SIR 8 TDI (0)", "svf: line 1: missing ';'"},
+		{"\n\nFOO;", "svf: line 3: unknown command \"FOO\""},
+		{"SDR 8 TDI (0", "svf: line 1: unterminated '('"},
+		{"ENDDR DRSHIFT;", "svf: line 1: DRSHIFT is not a stable state"},
+		{"PIOMAP (IN A);", "svf: line 1: PIOMAP is not supported"},
+		{"RUNTEST 10;", "svf: line 1: RUNTEST expects a count or a time"},
+		{"SDR 4 TDI (G);", "svf: line 1: invalid hex value \"G\""},
+		{"SDR 2147483647 TDI (0) TDO (0) MASK (0) SMASK (0);", "svf: line 1: length 2147483647 is too large"},
+		{"\nFREQUENCY 5E-1 HZ;", "svf: line 2: frequency \"5E-1\" is below 1Hz"},
+	}
+	for _, l := range data {
+		if _, err := svf.ParseSVF(strings.NewReader(l.src)); err == nil || err.Error() != l.err {
+			t.Errorf("%q: got %v, want %s", l.src, err, l.err)
+		}
+	}
+}
+
+func TestParseSVF_runtest(t *testing.T) {
+	stmts, err := svf.ParseSVF(strings.NewReader("RUNTEST DRPAUSE 1.5E-2 SEC MAXIMUM 1 SEC ENDSTATE RESET;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := stmts[0]
+	if !s.HasState || s.State != jtag.PauseDR || s.MinTime != 0.015 || s.MaxTime != 1 || !s.HasEnd || s.End != jtag.TestLogicReset {
+		t.Fatalf("%+v", s)
+	}
+}
+
+func TestPlayXSVF_runTestEndState(t *testing.T) {
+	x := []byte{
+		0x14, 0x01, // XENDDR DRPAUSE
+		0x12, 0x00, // XSTATE RESET
+		0x02, 0x0C, 0x00, 0x9F, // XSIR 12 bits: dev1 IDCODE, dev0 BYPASS
+		0x08, 0x00, 0x00, 0x00, 0x21, // XSDRSIZE 33
+		0x04, 0x00, 0x00, 0x00, 0x64, // XRUNTEST 100µs
+		0x03, 0x00, 0x00, 0x00, 0x00, 0x00, // XSDR
+		0x00, // XCOMPLETE
+	}
+	stmts, err := svf.ParseXSVF(bytes.NewReader(x))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, _ := newChain()
+	c, err := jtag.New(chain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := svf.NewPlayer(c)
+	p.Sleep = func(time.Duration) {}
+	if err := p.Play(stmts); err != nil {
+		t.Fatal(err)
+	}
+	if chain.TAPs[1].Idle < 100 {
+		t.Fatalf("waited %d TCK in RunTestIdle, want 100", chain.TAPs[1].Idle)
+	}
+	if s := c.State(); s != jtag.PauseDR {
+		t.Fatalf("unexpected state %s", s)
+	}
+}
+
+func TestPlayXSVF_retry(t *testing.T) {
+	x := []byte{
+		0x02, 0x0C, 0x04, 0x2F, // XSIR 12 bits: dev1 0x42, dev0 BYPASS
+		0x08, 0x00, 0x00, 0x00, 0x0D, // XSDRSIZE 13
+		0x07, 0x01, // XREPEAT 1
+		0x04, 0x00, 0x00, 0x00, 0x0A, // XRUNTEST 10µs
+		// XSDRTDO: dev1 ABC, dev0 1. The capture mismatches, but shifting again
+		// without leaving the DR path returns the bits shifted in.
+		0x09, 0x15, 0x79, 0x15, 0x79,
+		0x00, // XCOMPLETE
+	}
+	stmts, err := svf.ParseXSVF(bytes.NewReader(x))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, reg := newChain()
+	updates := 0
+	reg.Update = func([]byte) { updates++ }
+	c, err := jtag.New(chain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := svf.NewPlayer(c)
+	p.Sleep = func(time.Duration) {}
+	if err := p.Play(stmts); err != nil {
+		t.Fatal(err)
+	}
+	if updates != 1 || !bytes.Equal(reg.Value, []byte{0xBC, 0x0A}) {
+		t.Fatalf("%d updates, %#x", updates, reg.Value)
+	}
+	if s := c.State(); s != jtag.RunTestIdle {
+		t.Fatalf("unexpected state %s", s)
+	}
+}
+
+func TestParseXSVF(t *testing.T) {
+	x := []byte{
+		0x13, 0x00, // XENDIR IDLE
+		0x14, 0x00, // XENDDR IDLE
+		0x12, 0x00, // XSTATE RESET
+		0x16, 'h', 'i', 0x00, // XCOMMENT
+		0x02, 0x0C, 0x00, 0x9F, // XSIR 12 bits: dev1 IDCODE, dev0 BYPASS
+		0x08, 0x00, 0x00, 0x00, 0x21, // XSDRSIZE 33
+		0x01, 0x00, 0x1F, 0xFF, 0xFF, 0xFE, // XTDOMASK
+		0x07, 0x02, // XREPEAT 2
+		0x04, 0x00, 0x00, 0x00, 0x0A, // XRUNTEST 10µs
+		0x09, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x26, 0xC6, 0x21, 0x26, // XSDRTDO
+		0x03, 0x00, 0x00, 0x00, 0x00, 0x00, // XSDR, compared against the previous TDO
+		0x17, 0x01, 0x01, 0x00, 0x00, 0x03, 0xE8, // XWAIT IDLE IDLE 1ms
+		0x00, // XCOMPLETE
+	}
+	stmts, err := svf.ParseXSVF(bytes.NewReader(x))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 7 {
+		t.Fatalf("got %d statements", len(stmts))
+	}
+	if s := stmts[4]; s.Op != svf.SDR || s.Line != 32 || s.Retry != 2 || s.RunTest != 10e-6 || s.Scan.Len != 33 {
+		t.Fatalf("%+v", s)
+	}
+	if s := stmts[5]; s.Scan.TDO == nil {
+		t.Fatalf("%+v", s)
+	}
+	chain, _ := newChain()
+	c, err := jtag.New(chain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := svf.NewPlayer(c)
+	p.Sleep = func(time.Duration) {}
+	if err := p.Play(stmts); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svf.ParseXSVF(bytes.NewReader(x[:len(x)-1])); err == nil || err.Error() != "xsvf: missing XCOMPLETE" {
+		t.Fatal(err)
+	}
+	if _, err := svf.ParseXSVF(bytes.NewReader([]byte{0x0C})); err == nil || err.Error() != "xsvf: offset 0: instruction 0x0c is not supported" {
+		t.Fatal(err)
+	}
+}
+
+func FuzzParseSVF(f *testing.F) {
+	f.Add([]byte(program))
+	f.Add([]byte("SDR 64 TDI (0123456789abcdef) TDO (0) MASK (f) SMASK (1);"))
+	f.Add([]byte("RUNTEST IDLE 10 TCK 1 SEC MAXIMUM 2 SEC ENDSTATE RESET;"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		stmts, err := svf.ParseSVF(bytes.NewReader(b))
+		if err != nil {
+			return
+		}
+		for _, s := range stmts {
+			for _, v := range [][]byte{s.Scan.TDI, s.Scan.TDO, s.Scan.Mask, s.Scan.SMask} {
+				if v != nil && len(v) != (s.Scan.Len+7)/8 {
+					t.Fatalf("invalid length for %+v", s)
+				}
+			}
+		}
+	})
+}
+
+func FuzzParseXSVF(f *testing.F) {
+	f.Add([]byte{0x08, 0, 0, 0, 8, 0x09, 0xAA, 0x55, 0x00})
+	f.Add([]byte{0x02, 0x04, 0x0F, 0x17, 0x01, 0x01, 0, 0, 0, 1, 0x00})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		stmts, err := svf.ParseXSVF(bytes.NewReader(b))
+		if err != nil {
+			return
+		}
+		for _, s := range stmts {
+			if s.Scan.TDI != nil && len(s.Scan.TDI) != (s.Scan.Len+7)/8 {
+				t.Fatalf("invalid length for %+v", s)
+			}
+		}
+	})
+}
@@ -0,0 +1,278 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package svf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"periph.io/x/d2xx/jtag"
+)
+
+// XSVF instructions, as documented in Xilinx XAPP503.
+const (
+	xComplete    = 0x00
+	xTDOMask     = 0x01
+	xSIR         = 0x02
+	xSDR         = 0x03
+	xRunTest     = 0x04
+	xRepeat      = 0x07
+	xSDRSize     = 0x08
+	xSDRTDO      = 0x09
+	xSetSDRMasks = 0x0A
+	xSDRInc      = 0x0B
+	xSDRB        = 0x0C
+	xSDRC        = 0x0D
+	xSDRE        = 0x0E
+	xSDRTDOB     = 0x0F
+	xSDRTDOC     = 0x10
+	xSDRTDOE     = 0x11
+	xState       = 0x12
+	xEndIR       = 0x13
+	xEndDR       = 0x14
+	xSIR2        = 0x15
+	xComment     = 0x16
+	xWait        = 0x17
+)
+
+// ParseXSVF parses a XSVF file.
+//
+// XSDR and XSDRTDO are converted to SDR statements. Since XSDR compares TDO
+// with the value specified by the last XSDRTDO, the expected value is copied
+// over. XSDRB/C/E, XSDRTDOB/C/E, XSDRINC and XSETSDRMASKS are not supported.
+func ParseXSVF(r io.Reader) ([]Statement, error) {
+	x := xsvfReader{r: bufio.NewReader(r)}
+	var out []Statement
+	sdrSize := 0
+	var tdoMask, tdoExpected []byte
+	repeat := 0
+	runTest := -1.
+	for {
+		off := x.off
+		op, err := x.byte()
+		if err == io.EOF {
+			return nil, errors.New("xsvf: missing XCOMPLETE")
+		}
+		if err != nil {
+			return nil, err
+		}
+		wrap := func(err error) error {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("xsvf: offset %d: %v", off, err)
+		}
+		s := Statement{Line: off}
+		switch op {
+		case xComplete:
+			return out, nil
+		case xTDOMask:
+			if tdoMask, err = x.value(sdrSize); err != nil {
+				return nil, wrap(err)
+			}
+			continue
+		case xSIR, xSIR2:
+			var l int
+			if op == xSIR {
+				b, err := x.byte()
+				if err != nil {
+					return nil, wrap(err)
+				}
+				l = int(b)
+			} else {
+				v, err := x.uint(2)
+				if err != nil {
+					return nil, wrap(err)
+				}
+				l = int(v)
+			}
+			s.Op = SIR
+			s.Scan.Len = l
+			if s.Scan.TDI, err = x.value(l); err != nil {
+				return nil, wrap(err)
+			}
+			if runTest >= 0 {
+				// XAPP503: a non-zero XRUNTEST also applies after XSIR.
+				s.RunTest = runTest
+			}
+		case xSDR, xSDRTDO:
+			s.Op = SDR
+			s.Scan.Len = sdrSize
+			if s.Scan.TDI, err = x.value(sdrSize); err != nil {
+				return nil, wrap(err)
+			}
+			if op == xSDRTDO {
+				if tdoExpected, err = x.value(sdrSize); err != nil {
+					return nil, wrap(err)
+				}
+			}
+			if tdoExpected != nil {
+				s.Scan.TDO = tdoExpected
+				s.Scan.Mask = tdoMask
+			}
+			s.Retry = repeat
+			if runTest >= 0 {
+				s.RunTest = runTest
+			}
+		case xRunTest:
+			v, err := x.uint(4)
+			if err != nil {
+				return nil, wrap(err)
+			}
+			runTest = float64(v) / 1e6
+			continue
+		case xRepeat:
+			b, err := x.byte()
+			if err != nil {
+				return nil, wrap(err)
+			}
+			repeat = int(b)
+			continue
+		case xSDRSize:
+			v, err := x.uint(4)
+			if err != nil {
+				return nil, wrap(err)
+			}
+			if v > maxScanLen {
+				return nil, wrap(fmt.Errorf("XSDRSIZE %d is too large", v))
+			}
+			sdrSize = int(v)
+			tdoMask = ones(sdrSize)
+			tdoExpected = nil
+			continue
+		case xState:
+			st, err := x.state()
+			if err != nil {
+				return nil, wrap(err)
+			}
+			s.Op = STATE
+			s.State = st
+		case xEndIR, xEndDR:
+			b, err := x.byte()
+			if err != nil {
+				return nil, wrap(err)
+			}
+			if b > 1 {
+				return nil, wrap(fmt.Errorf("invalid end state %d", b))
+			}
+			s.Op = ENDIR
+			s.State = jtag.RunTestIdle
+			if b == 1 {
+				s.State = jtag.PauseIR
+			}
+			if op == xEndDR {
+				s.Op = ENDDR
+				if b == 1 {
+					s.State = jtag.PauseDR
+				}
+			}
+		case xComment:
+			for {
+				b, err := x.byte()
+				if err != nil {
+					return nil, wrap(err)
+				}
+				if b == 0 {
+					break
+				}
+			}
+			continue
+		case xWait:
+			wait, err := x.state()
+			if err != nil {
+				return nil, wrap(err)
+			}
+			end, err := x.state()
+			if err != nil {
+				return nil, wrap(err)
+			}
+			v, err := x.uint(4)
+			if err != nil {
+				return nil, wrap(err)
+			}
+			s.Op = RUNTEST
+			s.State = wait
+			s.HasState = true
+			s.End = end
+			s.HasEnd = true
+			s.MinTime = float64(v) / 1e6
+		case xSetSDRMasks, xSDRInc, xSDRB, xSDRC, xSDRE, xSDRTDOB, xSDRTDOC, xSDRTDOE:
+			return nil, wrap(fmt.Errorf("instruction %#02x is not supported", op))
+		default:
+			return nil, wrap(fmt.Errorf("unknown instruction %#02x", op))
+		}
+		out = append(out, s)
+	}
+}
+
+//
+
+type xsvfReader struct {
+	r   *bufio.Reader
+	off int
+}
+
+func (x *xsvfReader) byte() (byte, error) {
+	b, err := x.r.ReadByte()
+	if err == nil {
+		x.off++
+	}
+	return b, err
+}
+
+// uint reads a big endian integer.
+func (x *xsvfReader) uint(n int) (uint32, error) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		b, err := x.byte()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<8 | uint32(b)
+	}
+	return v, nil
+}
+
+// value reads a big endian value of bits and returns it LSB first.
+func (x *xsvfReader) value(bits int) ([]byte, error) {
+	n := (bits + 7) / 8
+	out := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b, err := x.byte()
+		if err != nil {
+			return nil, err
+		}
+		out[i] = b
+	}
+	if r := bits % 8; r != 0 {
+		out[n-1] &= byte(1<<uint(r)) - 1
+	}
+	return out, nil
+}
+
+// state reads a state. XSVF uses the same encoding as jtag.State.
+func (x *xsvfReader) state() (jtag.State, error) {
+	b, err := x.byte()
+	if err != nil {
+		return 0, err
+	}
+	if b > byte(jtag.UpdateIR) {
+		return 0, fmt.Errorf("invalid state %d", b)
+	}
+	return jtag.State(b), nil
+}
+
+func ones(bits int) []byte {
+	b := make([]byte, (bits+7)/8)
+	for i := range b {
+		b[i] = 0xFF
+	}
+	if r := bits % 8; r != 0 {
+		b[len(b)-1] = byte(1<<uint(r)) - 1
+	}
+	return b
+}
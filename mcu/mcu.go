@@ -0,0 +1,181 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package mcu drives the MCU host bus emulation mode of the FT2232C/D and
+// FT2232H, where the device acts as an 8048/8051 style bus master.
+//
+// Each access is a MPSSE command: MCURead and MCUWrite for an 8 bits address,
+// MCUReadExt and MCUWriteExt for a 16 bits address. Accesses are batched in a
+// single USB transfer where possible.
+package mcu
+
+import (
+	"fmt"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/mpsse"
+)
+
+// Opts is the configuration of a Bus.
+type Opts struct {
+	// AddressBits is 8 or 16. Defaults to 16. With 8 bits addresses, the
+	// shorter commands are used and the address high byte is left unchanged.
+	AddressBits int
+	// MaxBatch is the maximum number of accesses per USB transfer. Defaults to
+	// 4096.
+	MaxBatch int
+}
+
+// Op is a bus access for Bus.Do.
+type Op struct {
+	Addr  uint16
+	Write bool
+	// Data is the value to write, or the value read once Do returns.
+	Data byte
+}
+
+// Bus is a MCU host bus.
+//
+// It is not safe for concurrent use.
+type Bus struct {
+	c     *mpsse.Conn
+	wide  bool
+	batch int
+}
+
+// New initializes the handle in MCU host bus emulation mode.
+func New(h d2xx.Handle, opts *Opts) (*Bus, error) {
+	c := mpsse.New(h)
+	if err := c.InitMCUHost(); err != nil {
+		return nil, err
+	}
+	return NewFromConn(c, opts)
+}
+
+// NewFromConn is like New with a connection already initialized with
+// InitMCUHost.
+func NewFromConn(c *mpsse.Conn, opts *Opts) (*Bus, error) {
+	o := Opts{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.AddressBits == 0 {
+		o.AddressBits = 16
+	}
+	if o.MaxBatch == 0 {
+		o.MaxBatch = 4096
+	}
+	if o.AddressBits != 8 && o.AddressBits != 16 {
+		return nil, fmt.Errorf("mcu: invalid address width %d", o.AddressBits)
+	}
+	if o.MaxBatch < 1 {
+		return nil, fmt.Errorf("mcu: invalid batch size %d", o.MaxBatch)
+	}
+	return &Bus{c: c, wide: o.AddressBits == 16, batch: o.MaxBatch}, nil
+}
+
+// Conn returns the MPSSE connection.
+func (b *Bus) Conn() *mpsse.Conn {
+	return b.c
+}
+
+// ReadReg reads the byte at addr.
+//
+// It is not named ReadByte since that name implies io.ByteReader.
+func (b *Bus) ReadReg(addr uint16) (byte, error) {
+	ops := [1]Op{{Addr: addr}}
+	err := b.Do(ops[:])
+	return ops[0].Data, err
+}
+
+// WriteReg writes the byte at addr.
+//
+// It is not named WriteByte since that name implies io.ByteWriter.
+func (b *Bus) WriteReg(addr uint16, v byte) error {
+	return b.Do([]Op{{Addr: addr, Write: true, Data: v}})
+}
+
+// ReadBlock reads consecutive addresses starting at addr.
+func (b *Bus) ReadBlock(addr uint16, p []byte) error {
+	ops, err := b.block(addr, len(p))
+	if err != nil {
+		return err
+	}
+	err = b.Do(ops)
+	for i := range ops {
+		p[i] = ops[i].Data
+	}
+	return err
+}
+
+// WriteBlock writes consecutive addresses starting at addr.
+func (b *Bus) WriteBlock(addr uint16, p []byte) error {
+	ops, err := b.block(addr, len(p))
+	if err != nil {
+		return err
+	}
+	for i := range ops {
+		ops[i].Write = true
+		ops[i].Data = p[i]
+	}
+	return b.Do(ops)
+}
+
+// Do runs the accesses in order, MaxBatch per USB transfer.
+func (b *Bus) Do(ops []Op) error {
+	for _, op := range ops {
+		if !b.wide && op.Addr > 0xFF {
+			return fmt.Errorf("mcu: address %#x doesn't fit in 8 bits", op.Addr)
+		}
+	}
+	for len(ops) != 0 {
+		n := len(ops)
+		if n > b.batch {
+			n = b.batch
+		}
+		reads := make([][]byte, n)
+		for i, op := range ops[:n] {
+			hi, lo := byte(op.Addr>>8), byte(op.Addr)
+			switch {
+			case op.Write && b.wide:
+				b.c.Queue(mpsse.MCUWriteExt, hi, lo, op.Data)
+			case op.Write:
+				b.c.Queue(mpsse.MCUWrite, lo, op.Data)
+			case b.wide:
+				b.c.Queue(mpsse.MCUReadExt, hi, lo)
+				reads[i] = b.c.Read(1)
+			default:
+				b.c.Queue(mpsse.MCURead, lo)
+				reads[i] = b.c.Read(1)
+			}
+		}
+		if err := b.c.Flush(); err != nil {
+			return err
+		}
+		for i, r := range reads {
+			if r != nil {
+				ops[i].Data = r[0]
+			}
+		}
+		ops = ops[n:]
+	}
+	return nil
+}
+
+//
+
+func (b *Bus) block(addr uint16, n int) ([]Op, error) {
+	max := 0x10000
+	if !b.wide {
+		max = 0x100
+	}
+	if int(addr)+n > max {
+		return nil, fmt.Errorf("mcu: %d bytes at %#x is past the end of the address space", n, addr)
+	}
+	ops := make([]Op, n)
+	for i := range ops {
+		ops[i].Addr = addr + uint16(i)
+	}
+	return ops, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package mcu_test
+
+import (
+	"bytes"
+	"testing"
+
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/mcu"
+)
+
+func TestBus(t *testing.T) {
+	f := d2xxtest.NewMCUBus()
+	b, err := mcu.New(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WriteReg(0x1234, 0x5A); err != nil {
+		t.Fatal(err)
+	}
+	if f.Mem[0x1234] != 0x5A {
+		t.Fatal("write")
+	}
+	f.Mem[0xBEEF] = 0xA5
+	if v, err := b.ReadReg(0xBEEF); err != nil || v != 0xA5 {
+		t.Fatalf("%#x %v", v, err)
+	}
+
+	// A block goes in a single transfer.
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 3)
+	}
+	n := f.Transfers
+	if err := b.WriteBlock(0x8000, data); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(data))
+	if err := b.ReadBlock(0x8000, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) || f.Transfers-n != 2 {
+		t.Fatalf("%d transfers", f.Transfers-n)
+	}
+
+	ops := []mcu.Op{{Addr: 1, Write: true, Data: 7}, {Addr: 1}, {Addr: 0xBEEF}}
+	if err := b.Do(ops); err != nil {
+		t.Fatal(err)
+	}
+	if ops[1].Data != 7 || ops[2].Data != 0xA5 {
+		t.Fatalf("%v", ops)
+	}
+	if err := b.ReadBlock(0xFFFF, got[:2]); err == nil {
+		t.Fatal("past the end")
+	}
+}
+
+func TestBus_short(t *testing.T) {
+	f := d2xxtest.NewMCUBus()
+	b, err := mcu.New(f, &mcu.Opts{AddressBits: 8, MaxBatch: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("0123456789abcdefghij0123456789")
+	n := f.Transfers
+	if err := b.WriteBlock(0x10, data); err != nil {
+		t.Fatal(err)
+	}
+	if f.Transfers-n != 3 || f.Writes != len(data) {
+		t.Fatalf("%d transfers", f.Transfers-n)
+	}
+	// The high address byte is unchanged by short accesses.
+	if !bytes.Equal(f.Mem[0x10:0x10+len(data)], data) {
+		t.Fatal("write")
+	}
+	if err := b.WriteReg(0x100, 0); err == nil {
+		t.Fatal("address too large")
+	}
+	if _, err := mcu.New(f, &mcu.Opts{AddressBits: 12}); err == nil {
+		t.Fatal("invalid width")
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package mpsse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Pin is a MPSSE GPIO pin, where 0~7 is ADBUS0~7 (bank 0) and 8~15 is
+// ACBUS0~7 (bank 1).
+type Pin uint8
+
+// Pins.
+//
+// D0~D7 and C0~C7 are the short names used on some breakout boards.
+const (
+	ADBUS0 Pin = iota
+	ADBUS1
+	ADBUS2
+	ADBUS3
+	ADBUS4
+	ADBUS5
+	ADBUS6
+	ADBUS7
+	ACBUS0
+	ACBUS1
+	ACBUS2
+	ACBUS3
+	ACBUS4
+	ACBUS5
+	ACBUS6
+	ACBUS7
+	NumPins = 16
+
+	D0 = ADBUS0
+	D1 = ADBUS1
+	D2 = ADBUS2
+	D3 = ADBUS3
+	D4 = ADBUS4
+	D5 = ADBUS5
+	D6 = ADBUS6
+	D7 = ADBUS7
+	C0 = ACBUS0
+	C1 = ACBUS1
+	C2 = ACBUS2
+	C3 = ACBUS3
+	C4 = ACBUS4
+	C5 = ACBUS5
+	C6 = ACBUS6
+	C7 = ACBUS7
+)
+
+// Bank returns 0 for ADBUS and 1 for ACBUS.
+func (p Pin) Bank() int {
+	return int(p / 8)
+}
+
+// Mask returns the bit of the pin in its bank.
+func (p Pin) Mask() byte {
+	return 1 << (p % 8)
+}
+
+func (p Pin) String() string {
+	if p >= NumPins {
+		return "Pin(" + strconv.Itoa(int(p)) + ")"
+	}
+	if p < 8 {
+		return "ADBUS" + strconv.Itoa(int(p))
+	}
+	return "ACBUS" + strconv.Itoa(int(p-8))
+}
+
+// ParsePin parses a pin name, case insensitive.
+//
+// Accepted names are ADBUS0~7 and ACBUS0~7, the short D0~7 and C0~7, and the
+// AN_108 names GPIOL0~3 (ADBUS4~7) and GPIOH0~7 (ACBUS0~7).
+func ParsePin(s string) (Pin, error) {
+	u := strings.ToUpper(s)
+	for _, p := range []struct {
+		prefix string
+		base   Pin
+		n      int
+	}{
+		{"ADBUS", ADBUS0, 8},
+		{"ACBUS", ACBUS0, 8},
+		{"GPIOL", ADBUS4, 4},
+		{"GPIOH", ACBUS0, 8},
+		{"D", ADBUS0, 8},
+		{"C", ACBUS0, 8},
+	} {
+		if !strings.HasPrefix(u, p.prefix) {
+			continue
+		}
+		i, err := strconv.Atoi(u[len(p.prefix):])
+		if err != nil || i < 0 || i >= p.n {
+			break
+		}
+		return p.base + Pin(i), nil
+	}
+	return 0, fmt.Errorf("mpsse: unknown pin %q", s)
+}
+
+// GPIO keeps the shadow value and direction of the ADBUS and ACBUS pins.
+//
+// Changes are only recorded until Queue or Flush is called, so updates to
+// several pins of a bank are coalesced into a single command, and updates to
+// both banks are sent in a single USB transfer.
+//
+// The pins used by the serial engine, e.g. ADBUS0~2, are driven by the
+// shifting commands and their shadow state is only meaningful while idle.
+//
+// Like an index out of range, a pin other than ADBUS0~ACBUS7 or a bank other
+// than 0 or 1 is a programming error: the methods without an error return
+// panic, the others return an error.
+type GPIO struct {
+	c     *Conn
+	value [2]byte
+	dir   [2]byte
+	dirty [2]bool
+}
+
+// GPIO returns the GPIO shadow state of the connection.
+//
+// It is shared by all the users of the connection, so that changing a pin
+// doesn't clobber the others.
+func (c *Conn) GPIO() *GPIO {
+	return &c.gpio
+}
+
+// Out sets the pin as an output at the given level.
+func (g *GPIO) Out(p Pin, level bool) {
+	g.Set(p, level)
+	b := mustBank(p)
+	g.update(b, g.value[b], g.dir[b]|p.Mask())
+}
+
+// In sets the pin as an input.
+func (g *GPIO) In(p Pin) {
+	b := mustBank(p)
+	g.update(b, g.value[b], g.dir[b]&^p.Mask())
+}
+
+// Set changes the output level of a pin without changing its direction. The
+// level of an input is kept until it is set as an output.
+func (g *GPIO) Set(p Pin, level bool) {
+	b := mustBank(p)
+	v := g.value[b] &^ p.Mask()
+	if level {
+		v |= p.Mask()
+	}
+	g.update(b, v, g.dir[b])
+}
+
+// SetBank changes the value and direction of all the pins of a bank. A bit
+// set in dir means output.
+func (g *GPIO) SetBank(bank int, value, dir byte) {
+	mustValidBank(bank)
+	g.update(bank, value, dir)
+}
+
+// Bank returns the shadow value and direction of a bank.
+func (g *GPIO) Bank(bank int) (value, dir byte) {
+	mustValidBank(bank)
+	return g.value[bank], g.dir[bank]
+}
+
+// Level returns the shadow output level of a pin.
+func (g *GPIO) Level(p Pin) bool {
+	return g.value[mustBank(p)]&p.Mask() != 0
+}
+
+// IsOut returns true if the pin is an output.
+func (g *GPIO) IsOut(p Pin) bool {
+	return g.dir[mustBank(p)]&p.Mask() != 0
+}
+
+// Queue queues the commands for the banks changed since the last call, without
+// flushing.
+func (g *GPIO) Queue() {
+	for b := range g.dirty {
+		if g.dirty[b] {
+			g.c.SetGPIO(b, g.value[b], g.dir[b])
+		}
+	}
+}
+
+// Flush sends the pending changes.
+func (g *GPIO) Flush() error {
+	g.Queue()
+	return g.c.Flush()
+}
+
+// Write sets the output level of a pin and flushes.
+func (g *GPIO) Write(p Pin, level bool) error {
+	if p >= NumPins {
+		return fmt.Errorf("mpsse: invalid pin %s", p)
+	}
+	g.Set(p, level)
+	return g.Flush()
+}
+
+// Read returns the level of a pin. Pending changes are sent in the same
+// transfer.
+func (g *GPIO) Read(p Pin) (bool, error) {
+	if p >= NumPins {
+		return false, fmt.Errorf("mpsse: invalid pin %s", p)
+	}
+	v, err := g.ReadBank(p.Bank())
+	return v&p.Mask() != 0, err
+}
+
+// ReadBank returns the level of all the pins of a bank. Pending changes are
+// sent in the same transfer.
+func (g *GPIO) ReadBank(bank int) (byte, error) {
+	if bank != 0 && bank != 1 {
+		return 0, fmt.Errorf("mpsse: invalid bank %d", bank)
+	}
+	g.Queue()
+	b := g.c.GetGPIO(bank)
+	if err := g.c.Flush(); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+//
+
+func (g *GPIO) update(bank int, value, dir byte) {
+	if value != g.value[bank] || dir != g.dir[bank] {
+		g.value[bank] = value
+		g.dir[bank] = dir
+		g.dirty[bank] = true
+	}
+}
+
+// mustBank returns the bank of a pin and panics if the pin is invalid.
+func mustBank(p Pin) int {
+	if p >= NumPins {
+		panic(fmt.Sprintf("mpsse: invalid pin %s", p))
+	}
+	return p.Bank()
+}
+
+// mustValidBank panics if the bank is invalid.
+func mustValidBank(bank int) {
+	if bank != 0 && bank != 1 {
+		panic(fmt.Sprintf("mpsse: invalid bank %d", bank))
+	}
+}
+
+// sent records the state sent by SetGPIO.
+func (g *GPIO) sent(bank int, value, dir byte) {
+	g.value[bank] = value
+	g.dir[bank] = dir
+	g.dirty[bank] = false
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package mpsse_test
+
+import (
+	"testing"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/mpsse"
+)
+
+// counter counts the USB writes.
+type counter struct {
+	d2xx.Handle
+	writes int
+}
+
+func (c *counter) Write(b []byte) (int, d2xx.Err) {
+	c.writes++
+	return c.Handle.Write(b)
+}
+
+func TestGPIO(t *testing.T) {
+	h := &counter{Handle: d2xxtest.NewJTAGChain()}
+	c := mpsse.New(h)
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	g := c.GPIO()
+	h.writes = 0
+	g.Out(mpsse.D4, true)
+	g.Out(mpsse.D5, false)
+	g.Out(mpsse.C7, true)
+	g.In(mpsse.C0)
+	if err := g.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if h.writes != 1 {
+		t.Fatalf("expected a single transfer, got %d", h.writes)
+	}
+	if v, d := g.Bank(0); v != 0x10 || d != 0x30 {
+		t.Fatalf("unexpected ADBUS %#x %#x", v, d)
+	}
+	// Unchanged banks are not sent again.
+	if err := g.Flush(); err != nil || h.writes != 1 {
+		t.Fatal(h.writes, err)
+	}
+	// Inputs are pulled up in the simulation.
+	v, err := g.ReadBank(1)
+	if err != nil || v != 0xFF {
+		t.Fatalf("%#x, %v", v, err)
+	}
+	g.Set(mpsse.ACBUS7, false)
+	if l, err := g.Read(mpsse.ACBUS7); err != nil || l {
+		t.Fatal(l, err)
+	}
+	if err := g.Write(mpsse.ADBUS4, false); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := g.Read(mpsse.ADBUS4); err != nil || l || !g.IsOut(mpsse.ADBUS4) || g.Level(mpsse.ADBUS4) {
+		t.Fatal(l, err)
+	}
+}
+
+func TestGPIO_invalid(t *testing.T) {
+	c := mpsse.New(d2xxtest.NewJTAGChain())
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	g := c.GPIO()
+	if err := g.Write(mpsse.NumPins, true); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := g.Read(mpsse.NumPins); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := g.ReadBank(2); err == nil {
+		t.Fatal("expected error")
+	}
+	data := []func(){
+		func() { g.Out(mpsse.NumPins, true) },
+		func() { g.In(mpsse.NumPins) },
+		func() { g.Set(mpsse.NumPins, true) },
+		func() { g.Level(mpsse.NumPins) },
+		func() { g.IsOut(mpsse.NumPins) },
+		func() { g.SetBank(2, 0, 0) },
+		func() { g.SetBank(-1, 0, 0) },
+		func() { g.Bank(2) },
+	}
+	for i, f := range data {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("#%d: expected panic", i)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestParsePin(t *testing.T) {
+	data := []struct {
+		s string
+		p mpsse.Pin
+	}{
+		{"ADBUS0", mpsse.ADBUS0},
+		{"acbus7", mpsse.ACBUS7},
+		{"D3", mpsse.ADBUS3},
+		{"c2", mpsse.ACBUS2},
+		{"GPIOL0", mpsse.ADBUS4},
+		{"GPIOH7", mpsse.ACBUS7},
+	}
+	for _, l := range data {
+		p, err := mpsse.ParsePin(l.s)
+		if err != nil || p != l.p {
+			t.Errorf("%s: got %s, %v", l.s, p, err)
+		}
+	}
+	for _, s := range []string{"", "D8", "GPIOL4", "ADBUS", "X1"} {
+		if _, err := mpsse.ParsePin(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+	if s := mpsse.ACBUS3.String(); s != "ACBUS3" {
+		t.Fatal(s)
+	}
+}
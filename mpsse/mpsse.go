@@ -0,0 +1,374 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package mpsse encodes Multi-Protocol Synchronous Serial Engine commands for
+// FTDI devices opened through d2xx.
+//
+// Commands are queued in a buffer and sent in a single USB transfer on Flush.
+// Commands that read data back register a destination slice which is filled
+// once the transfer completed.
+//
+// See AN_108 "Command Processor for MPSSE and MCU Host Bus Emulation Modes"
+// for the details of the command set.
+package mpsse
+
+import (
+	"errors"
+	"fmt"
+
+	"periph.io/x/d2xx"
+)
+
+// Flags used to build a data shifting command.
+//
+// For example DataOut|DataIn|LSBFirst|WriteFalling (0x39) shifts bytes out on
+// the falling edge and samples TDO on the rising edge.
+const (
+	WriteFalling byte = 0x01 // Write TDI/DO on the falling edge
+	BitMode      byte = 0x02 // Shift bits instead of bytes
+	ReadFalling  byte = 0x04 // Sample TDO/DI on the falling edge
+	LSBFirst     byte = 0x08 // Shift least significant bit first
+	DataOut      byte = 0x10 // Write TDI/DO
+	DataIn       byte = 0x20 // Read TDO/DI
+	TMSOut       byte = 0x40 // Write TMS/CS
+)
+
+// Other commands.
+const (
+	GPIOSetLow     byte = 0x80 // Set ADBUS value and direction
+	GPIOGetLow     byte = 0x81 // Read ADBUS
+	GPIOSetHigh    byte = 0x82 // Set ACBUS value and direction
+	GPIOGetHigh    byte = 0x83 // Read ACBUS
+	LoopbackOn     byte = 0x84 // Connect TDI/DO to TDO/DI internally
+	LoopbackOff    byte = 0x85 // Disconnect the loopback
+	ClockDivisor   byte = 0x86 // Set the TCK/SK divisor
+	SendImmediate  byte = 0x87 // Flush the chip buffer to the host
+	WaitHigh       byte = 0x88 // Wait until GPIOL1 is high
+	WaitLow        byte = 0x89 // Wait until GPIOL1 is low
+	ClockDiv5Off   byte = 0x8A // Use the 60MHz master clock (H series only)
+	ClockDiv5On    byte = 0x8B // Use the 12MHz master clock (H series only)
+	ThreePhaseOn   byte = 0x8C // Enable 3 phase data clocking (H series only)
+	ThreePhaseOff  byte = 0x8D // Disable 3 phase data clocking (H series only)
+	ClockBits      byte = 0x8E // Clock 1 to 8 bits without data transfer
+	ClockBytes     byte = 0x8F // Clock 8 to 524288 bits without data transfer
+	MCURead        byte = 0x90 // MCU host: read at an 8 bits address
+	MCUReadExt     byte = 0x91 // MCU host: read at a 16 bits address
+	MCUWrite       byte = 0x92 // MCU host: write at an 8 bits address
+	MCUWriteExt    byte = 0x93 // MCU host: write at a 16 bits address
+	ClockUntilHigh byte = 0x94 // Clock until GPIOL1 is high
+	ClockUntilLow  byte = 0x95 // Clock until GPIOL1 is low
+	AdaptiveOn     byte = 0x96 // Enable adaptive clocking on GPIOL3
+	AdaptiveOff    byte = 0x97 // Disable adaptive clocking
+	OpenDrain      byte = 0x9E // Set which ADBUS/ACBUS pins are open drain (232H only)
+	BadCommand     byte = 0xFA // Reply sent by the chip on an invalid opcode
+)
+
+// Conn is a MPSSE command queue on a d2xx.Handle.
+//
+// It is not safe for concurrent use.
+type Conn struct {
+	h       d2xx.Handle
+	devType uint32
+	cmd     []byte
+	reads   [][]byte
+	n       int
+	gpio    GPIO
+}
+
+// New returns a command queue for the handle.
+//
+// The handle is not modified until Init is called.
+func New(h d2xx.Handle) *Conn {
+	c := &Conn{h: h, devType: d2xx.DeviceUnknown}
+	c.gpio.c = c
+	return c
+}
+
+// Handle returns the underlying handle.
+func (c *Conn) Handle() d2xx.Handle {
+	return c.h
+}
+
+// DevType returns the device type as found by Init.
+func (c *Conn) DevType() uint32 {
+	return c.devType
+}
+
+// HighSpeed returns true if the device has the 60MHz master clock.
+func (c *Conn) HighSpeed() bool {
+	switch c.devType {
+	case d2xx.Device2232H, d2xx.Device4232H, d2xx.Device232H:
+		return true
+	default:
+		return false
+	}
+}
+
+// Init resets the device, switches it to MPSSE mode and synchronizes the
+// command processor.
+func (c *Conn) Init() error {
+	return c.init(d2xx.BitModeMPSSE)
+}
+
+// InitMCUHost resets the device, switches it to MCU host bus emulation mode
+// and synchronizes the command processor.
+//
+// In this mode, the MCURead, MCUReadExt, MCUWrite and MCUWriteExt commands
+// drive the pins as an 8048/8051 style bus.
+func (c *Conn) InitMCUHost() error {
+	return c.init(d2xx.BitModeMCUHost)
+}
+
+// Sync sends a bogus opcode and waits for the chip to reject it.
+//
+// This confirms the command processor is in a known state and that no stale
+// data is in the receive buffer.
+func (c *Conn) Sync() error {
+	for _, op := range []byte{0xAA, 0xAB} {
+		c.Queue(op)
+		b := c.Read(2)
+		if err := c.Flush(); err != nil {
+			return err
+		}
+		if b[0] != BadCommand || b[1] != op {
+			return fmt.Errorf("mpsse: failed to synchronize; got %#x", b)
+		}
+	}
+	return nil
+}
+
+// SetClock queues the commands to set TCK/SK frequency and returns the
+// effective frequency.
+func (c *Conn) SetClock(hz uint32) (uint32, error) {
+	if hz == 0 {
+		return 0, errors.New("mpsse: invalid clock frequency")
+	}
+	base := uint32(6000000)
+	if c.HighSpeed() {
+		base = 30000000
+		if hz < (base+0xFFFF)/0x10000 {
+			// Too slow for the 60MHz clock; fall back to 12MHz.
+			base = 6000000
+			c.Queue(ClockDiv5On)
+		} else {
+			c.Queue(ClockDiv5Off)
+		}
+	}
+	div := (base+hz-1)/hz - 1
+	if div > 0xFFFF {
+		div = 0xFFFF
+	}
+	c.Queue(ClockDivisor, byte(div), byte(div>>8))
+	return base / (div + 1), nil
+}
+
+// Queue appends raw commands to the queue.
+func (c *Conn) Queue(cmd ...byte) {
+	c.cmd = append(c.cmd, cmd...)
+}
+
+// Read registers that n bytes are expected as a reply to the previously
+// queued commands.
+//
+// The returned slice is filled by the next successful Flush.
+func (c *Conn) Read(n int) []byte {
+	b := make([]byte, n)
+	c.reads = append(c.reads, b)
+	c.n += n
+	return b
+}
+
+// Pending returns the number of bytes queued and expected as a reply.
+func (c *Conn) Pending() (int, int) {
+	return len(c.cmd), c.n
+}
+
+// ShiftBytes queues a byte shifting command.
+//
+// op must not have BitMode nor TMSOut set. out is ignored unless op has DataOut
+// set. If op has DataIn set, the slice returned is filled on Flush.
+//
+// Transfers larger than 65536 bytes are split in multiple commands.
+func (c *Conn) ShiftBytes(op byte, out []byte, n int) []byte {
+	if n == 0 {
+		return nil
+	}
+	for i := 0; i < n; i += 65536 {
+		l := n - i
+		if l > 65536 {
+			l = 65536
+		}
+		c.Queue(op, byte(l-1), byte((l-1)>>8))
+		if op&DataOut != 0 {
+			c.Queue(out[i : i+l]...)
+		}
+	}
+	if op&DataIn != 0 {
+		return c.Read(n)
+	}
+	return nil
+}
+
+// ShiftBits queues a command to shift 1 to 8 bits.
+//
+// BitMode is implied. If op has DataIn set, the slice returned contains a
+// single byte filled on Flush. Use BitsIn to decode it.
+func (c *Conn) ShiftBits(op byte, out byte, n int) []byte {
+	if n == 0 {
+		return nil
+	}
+	op |= BitMode
+	c.Queue(op, byte(n-1))
+	if op&DataOut != 0 {
+		c.Queue(out)
+	}
+	if op&DataIn != 0 {
+		return c.Read(1)
+	}
+	return nil
+}
+
+// TMS queues a command to clock 1 to 7 bits on TMS, LSB first, while holding
+// TDI at tdi.
+//
+// If read is true, TDO is sampled and the slice returned contains a single
+// byte filled on Flush. Use BitsIn to decode it.
+func (c *Conn) TMS(tms byte, n int, tdi, read bool) []byte {
+	if n == 0 {
+		return nil
+	}
+	op := TMSOut | BitMode | LSBFirst | WriteFalling
+	if read {
+		op |= DataIn
+	}
+	v := tms & 0x7F
+	if tdi {
+		v |= 0x80
+	}
+	c.Queue(op, byte(n-1), v)
+	if read {
+		return c.Read(1)
+	}
+	return nil
+}
+
+// SetGPIO queues a command to set the value and direction of a bank. Bank 0
+// is ADBUS, bank 1 is ACBUS. A bit set in dir means output.
+//
+// The GPIO shadow state is updated accordingly.
+func (c *Conn) SetGPIO(bank int, value, dir byte) {
+	c.gpio.sent(bank, value, dir)
+	op := GPIOSetLow
+	if bank != 0 {
+		op = GPIOSetHigh
+	}
+	c.Queue(op, value, dir)
+}
+
+// GetGPIO queues a command to read a bank. The slice returned contains a
+// single byte filled on Flush.
+func (c *Conn) GetGPIO(bank int) []byte {
+	op := GPIOGetLow
+	if bank != 0 {
+		op = GPIOGetHigh
+	}
+	c.Queue(op)
+	return c.Read(1)
+}
+
+// Flush sends all queued commands and reads back the expected replies.
+func (c *Conn) Flush() error {
+	if len(c.cmd) == 0 {
+		return nil
+	}
+	n := c.n
+	if n != 0 {
+		c.cmd = append(c.cmd, SendImmediate)
+	}
+	cmd := c.cmd
+	reads := c.reads
+	c.cmd = c.cmd[:0]
+	c.reads = nil
+	c.n = 0
+	for len(cmd) != 0 {
+		w, e := c.h.Write(cmd)
+		if e != 0 {
+			return toErr("Write", e)
+		}
+		if w == 0 {
+			return errors.New("mpsse: write timed out")
+		}
+		cmd = cmd[w:]
+	}
+	if n == 0 {
+		return nil
+	}
+	buf := make([]byte, n)
+	for got := 0; got < n; {
+		r, e := c.h.Read(buf[got:])
+		if e != 0 {
+			return toErr("Read", e)
+		}
+		if r == 0 {
+			return fmt.Errorf("mpsse: read timed out after %d of %d bytes", got, n)
+		}
+		got += r
+	}
+	for _, r := range reads {
+		copy(r, buf)
+		buf = buf[len(r):]
+	}
+	return nil
+}
+
+// BitsIn decodes the byte returned by a n bits LSB first read command.
+//
+// The chip shifts the sampled bits from the MSB down, so the last bit read is
+// the MSB.
+func BitsIn(b byte, n int) byte {
+	return b >> uint(8-n)
+}
+
+//
+
+// init resets the device and switches it to the bit mode.
+func (c *Conn) init(mode byte) error {
+	d, _, _, e := c.h.GetDeviceInfo()
+	if e != 0 {
+		return toErr("GetDeviceInfo", e)
+	}
+	c.devType = d
+	c.cmd = c.cmd[:0]
+	c.reads = nil
+	c.n = 0
+	// All the pins are inputs after the reset.
+	c.gpio.sent(0, 0, 0)
+	c.gpio.sent(1, 0, 0)
+	if e := c.h.ResetDevice(); e != 0 {
+		return toErr("ResetDevice", e)
+	}
+	if e := c.h.SetUSBParameters(65536, 65535); e != 0 {
+		return toErr("SetUSBParameters", e)
+	}
+	if e := c.h.SetChars(0, false, 0, false); e != 0 {
+		return toErr("SetChars", e)
+	}
+	if e := c.h.SetTimeouts(5000, 5000); e != 0 {
+		return toErr("SetTimeouts", e)
+	}
+	if e := c.h.SetLatencyTimer(1); e != 0 {
+		return toErr("SetLatencyTimer", e)
+	}
+	if e := c.h.SetBitMode(0, d2xx.BitModeReset); e != 0 {
+		return toErr("SetBitMode", e)
+	}
+	if e := c.h.SetBitMode(0, mode); e != 0 {
+		return toErr("SetBitMode", e)
+	}
+	return c.Sync()
+}
+
+func toErr(op string, e d2xx.Err) error {
+	return fmt.Errorf("mpsse: %s: %s", op, e)
+}
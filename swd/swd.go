@@ -0,0 +1,319 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package swd implements the ARM Serial Wire Debug transport on top of a FTDI
+// MPSSE port.
+//
+// The usual resistor based wiring is used:
+//
+//   - ADBUS0: SWCLK
+//   - ADBUS1: SWDIO, through a ~470Ω resistor
+//   - ADBUS2: SWDIO, directly
+//
+// The host always drives ADBUS1 and the target overrides it through the
+// resistor when it drives SWDIO. This is why the host shifts zeros, which the
+// target sees as idle cycles, while reading.
+//
+// Reads complete in a single USB round trip. Writes need two, since the data
+// phase must only be sent once the target acknowledged the request.
+package swd
+
+import (
+	"errors"
+	"fmt"
+
+	"periph.io/x/d2xx"
+	"periph.io/x/d2xx/mpsse"
+)
+
+// Errors returned by transfers.
+var (
+	// ErrWait is returned when the target still answers WAIT after all the
+	// retries.
+	ErrWait = errors.New("swd: target answered WAIT")
+	// ErrFault is returned when the target answers FAULT. The sticky error
+	// flags must be cleared through the DP ABORT register.
+	ErrFault = errors.New("swd: target answered FAULT")
+	// ErrProtocol is returned when the acknowledge is invalid, usually
+	// because the target is not connected or lost synchronization. A line
+	// reset is needed.
+	ErrProtocol = errors.New("swd: protocol error")
+	// ErrParity is returned when the data read has an invalid parity.
+	ErrParity = errors.New("swd: parity error")
+)
+
+// Debug Port registers addresses.
+const (
+	DPIDR    uint8 = 0x0 // Read
+	ABORT    uint8 = 0x0 // Write
+	CTRLSTAT uint8 = 0x4
+	SELECT   uint8 = 0x8 // Write
+	RESEND   uint8 = 0x8 // Read
+	RDBUFF   uint8 = 0xC // Read
+)
+
+// Acknowledge values.
+const (
+	ackOK    = 1
+	ackWait  = 2
+	ackFault = 4
+)
+
+// Pin is a MPSSE GPIO pin.
+//
+// Since ADBUS0~2 are used by SWD, the zero value means not connected.
+type Pin = mpsse.Pin
+
+// Opts is the configuration of a Conn.
+type Opts struct {
+	// Hz is the SWCLK frequency. Defaults to 1MHz.
+	Hz uint32
+	// SRST is the active low system reset pin, usually nRESET.
+	SRST Pin
+	// Retries is the number of times a transfer is retried when the target
+	// answers WAIT. Defaults to 100.
+	Retries int
+	// LowValue, LowDir, HighValue and HighDir is the initial state of the pins
+	// not used for SWD. A bit set in the direction means output.
+	LowValue, LowDir, HighValue, HighDir byte
+}
+
+// Conn is a SWD connection through a MPSSE port.
+//
+// It is not safe for concurrent use.
+type Conn struct {
+	c       *mpsse.Conn
+	hz      uint32
+	srst    Pin
+	retries int
+}
+
+// New initializes the handle in MPSSE mode, switches the target from JTAG to
+// SWD and reads DPIDR.
+func New(h d2xx.Handle, opts *Opts) (*Conn, uint32, error) {
+	c := mpsse.New(h)
+	if err := c.Init(); err != nil {
+		return nil, 0, err
+	}
+	return NewFromConn(c, opts)
+}
+
+// NewFromConn is like New with an already initialized MPSSE connection.
+func NewFromConn(c *mpsse.Conn, opts *Opts) (*Conn, uint32, error) {
+	o := Opts{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Hz == 0 {
+		o.Hz = 1000000
+	}
+	if o.Retries == 0 {
+		o.Retries = 100
+	}
+	if o.SRST != 0 && (o.SRST < 3 || o.SRST > 15) {
+		return nil, 0, fmt.Errorf("swd: invalid pin %d", o.SRST)
+	}
+	s := &Conn{c: c, srst: o.SRST, retries: o.Retries}
+	// SWCLK and SWDIO out low, ADBUS2 in.
+	g := c.GPIO()
+	g.SetBank(0, o.LowValue&^0x07, o.LowDir&^0x07|0x03)
+	g.SetBank(1, o.HighValue, o.HighDir)
+	if o.SRST != 0 {
+		g.Out(o.SRST, true)
+	}
+	c.Queue(mpsse.LoopbackOff, mpsse.AdaptiveOff)
+	if c.HighSpeed() {
+		c.Queue(mpsse.ThreePhaseOff)
+	}
+	hz, err := c.SetClock(o.Hz)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.hz = hz
+	g.Queue()
+	if err := s.SwitchFromJTAG(); err != nil {
+		return nil, 0, err
+	}
+	id, err := s.ReadDP(DPIDR)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s, id, nil
+}
+
+// Conn returns the underlying MPSSE connection.
+func (s *Conn) Conn() *mpsse.Conn {
+	return s.c
+}
+
+// Hz returns the effective SWCLK frequency.
+func (s *Conn) Hz() uint32 {
+	return s.hz
+}
+
+// LineReset clocks more than 50 cycles with SWDIO high followed by idle
+// cycles.
+//
+// DPIDR must be read afterward before any other access.
+func (s *Conn) LineReset() error {
+	s.out([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00})
+	return s.c.Flush()
+}
+
+// SwitchFromJTAG sends the JTAG-to-SWD select sequence surrounded by line
+// resets.
+//
+// DPIDR must be read afterward before any other access.
+func (s *Conn) SwitchFromJTAG() error {
+	s.out([]byte{
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		0x9E, 0xE7,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		0x00,
+	})
+	return s.c.Flush()
+}
+
+// ReadDP reads a Debug Port register.
+func (s *Conn) ReadDP(addr uint8) (uint32, error) {
+	return s.Read(false, addr)
+}
+
+// WriteDP writes a Debug Port register.
+func (s *Conn) WriteDP(addr uint8, v uint32) error {
+	return s.Write(false, addr, v)
+}
+
+// ReadAP reads a register of the currently selected Access Port.
+//
+// Since AP reads are posted, this does the read then fetches the result from
+// RDBUFF.
+func (s *Conn) ReadAP(addr uint8) (uint32, error) {
+	if _, err := s.Read(true, addr); err != nil {
+		return 0, err
+	}
+	return s.Read(false, RDBUFF)
+}
+
+// WriteAP writes a register of the currently selected Access Port.
+func (s *Conn) WriteAP(addr uint8, v uint32) error {
+	return s.Write(true, addr, v)
+}
+
+// Read does a single read transfer, retrying on WAIT.
+//
+// For AP reads, the value returned is the result of the previous AP read.
+func (s *Conn) Read(ap bool, addr uint8) (uint32, error) {
+	for i := 0; ; i++ {
+		s.request(ap, true, addr)
+		// Turnaround, ACK, data, parity and turnaround, while shifting zeros.
+		op := mpsse.DataOut | mpsse.DataIn | mpsse.LSBFirst | mpsse.WriteFalling
+		ack := s.c.ShiftBits(op, 0, 4)
+		data := s.c.ShiftBytes(op, []byte{0, 0, 0, 0}, 4)
+		par := s.c.ShiftBits(op, 0, 2)
+		s.idle()
+		if err := s.c.Flush(); err != nil {
+			return 0, err
+		}
+		switch a := mpsse.BitsIn(ack[0], 4) >> 1; a {
+		case ackOK:
+			v := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
+			if parity(v) != mpsse.BitsIn(par[0], 2)&1 {
+				return 0, ErrParity
+			}
+			return v, nil
+		case ackWait:
+			if i >= s.retries {
+				return 0, ErrWait
+			}
+		case ackFault:
+			return 0, ErrFault
+		default:
+			return 0, ErrProtocol
+		}
+	}
+}
+
+// Write does a single write transfer, retrying on WAIT.
+func (s *Conn) Write(ap bool, addr uint8, v uint32) error {
+	for i := 0; ; i++ {
+		s.request(ap, false, addr)
+		op := mpsse.DataOut | mpsse.DataIn | mpsse.LSBFirst | mpsse.WriteFalling
+		ack := s.c.ShiftBits(op, 0, 4)
+		if err := s.c.Flush(); err != nil {
+			return err
+		}
+		a := mpsse.BitsIn(ack[0], 4) >> 1
+		if a == ackOK {
+			// Turnaround, then data and parity.
+			op := mpsse.DataOut | mpsse.LSBFirst | mpsse.WriteFalling
+			s.c.ShiftBits(op, 0, 1)
+			s.c.ShiftBytes(op, []byte{byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24)}, 4)
+			s.c.ShiftBits(op, parity(v), 1)
+			s.idle()
+			return s.c.Flush()
+		}
+		// Turnaround without a data phase.
+		s.c.ShiftBits(mpsse.DataOut|mpsse.LSBFirst|mpsse.WriteFalling, 0, 1)
+		s.idle()
+		if err := s.c.Flush(); err != nil {
+			return err
+		}
+		switch a {
+		case ackWait:
+			if i >= s.retries {
+				return ErrWait
+			}
+		case ackFault:
+			return ErrFault
+		default:
+			return ErrProtocol
+		}
+	}
+}
+
+// SRST asserts or deasserts the system reset signal.
+func (s *Conn) SRST(assert bool) error {
+	if s.srst == 0 {
+		return errors.New("swd: SRST is not connected")
+	}
+	return s.c.GPIO().Write(s.srst, !assert)
+}
+
+//
+
+// request queues a request packet.
+func (s *Conn) request(ap, read bool, addr uint8) {
+	// Start, APnDP, RnW, A[2:3], Parity, Stop, Park.
+	r := byte(1)
+	if ap {
+		r |= 1 << 1
+	}
+	if read {
+		r |= 1 << 2
+	}
+	r |= (addr >> 2 & 3) << 3
+	r |= parity(uint32(r>>1&0xF)) << 5
+	r |= 1 << 7
+	s.c.ShiftBits(mpsse.DataOut|mpsse.LSBFirst|mpsse.WriteFalling, r, 8)
+}
+
+// idle queues 8 idle cycles, which also flush the transfer in the target.
+func (s *Conn) idle() {
+	s.c.ShiftBits(mpsse.DataOut|mpsse.LSBFirst|mpsse.WriteFalling, 0, 8)
+}
+
+func (s *Conn) out(b []byte) {
+	s.c.ShiftBytes(mpsse.DataOut|mpsse.LSBFirst|mpsse.WriteFalling, b, len(b))
+}
+
+// parity returns the even parity bit of v.
+func parity(v uint32) byte {
+	v ^= v >> 16
+	v ^= v >> 8
+	v ^= v >> 4
+	v ^= v >> 2
+	v ^= v >> 1
+	return byte(v & 1)
+}
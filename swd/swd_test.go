@@ -0,0 +1,121 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package swd_test
+
+import (
+	"testing"
+
+	"periph.io/x/d2xx/d2xxtest"
+	"periph.io/x/d2xx/swd"
+)
+
+type regs map[uint8]uint32
+
+func (r regs) ReadAP(addr uint8) (uint32, bool) {
+	v, ok := r[addr]
+	return v, ok
+}
+
+func (r regs) WriteAP(addr uint8, v uint32) bool {
+	if _, ok := r[addr]; !ok {
+		return false
+	}
+	r[addr] = v
+	return true
+}
+
+func TestConn(t *testing.T) {
+	target := d2xxtest.NewSWDTarget(0x2BA01477)
+	ap := regs{0x04: 0x20000000, 0xFC: 0x24770011}
+	target.APs = map[uint8]d2xxtest.SWDAP{1: ap}
+	s, id, err := swd.New(target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 0x2BA01477 {
+		t.Fatalf("unexpected DPIDR %#x", id)
+	}
+	if err := s.WriteDP(swd.CTRLSTAT, 0x50000000); err != nil {
+		t.Fatal(err)
+	}
+	v, err := s.ReadDP(swd.CTRLSTAT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 0xF0000000 {
+		t.Fatalf("unexpected CTRL/STAT %#x", v)
+	}
+	if err := s.WriteDP(swd.SELECT, 0x010000F0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err = s.ReadAP(0x0C); err != nil || v != 0x24770011 {
+		t.Fatalf("unexpected IDR %#x: %v", v, err)
+	}
+	if err := s.WriteDP(swd.SELECT, 0x01000000); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteAP(0x04, 0xDEADBEEF); err != nil {
+		t.Fatal(err)
+	}
+	if ap[0x04] != 0xDEADBEEF {
+		t.Fatalf("unexpected AP register %#x", ap[0x04])
+	}
+
+	// WAIT is retried.
+	target.Wait = 3
+	if v, err = s.ReadAP(0x04); err != nil || v != 0xDEADBEEF {
+		t.Fatalf("unexpected read %#x: %v", v, err)
+	}
+	target.Wait = 3
+	if err := s.WriteAP(0x04, 1); err != nil || ap[0x04] != 1 {
+		t.Fatal(err)
+	}
+
+	// An AP error makes the following accesses FAULT until ABORT.
+	if err := s.WriteAP(0x08, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReadAP(0x04); err != swd.ErrFault {
+		t.Fatalf("expected FAULT, got %v", err)
+	}
+	if err := s.WriteDP(swd.ABORT, 0x1E); err != nil {
+		t.Fatal(err)
+	}
+	if v, err = s.ReadAP(0x04); err != nil || v != 1 {
+		t.Fatalf("unexpected read %#x: %v", v, err)
+	}
+
+	// A line reset keeps the target in SWD mode.
+	if err := s.LineReset(); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := s.ReadDP(swd.DPIDR); err != nil || id != 0x2BA01477 {
+		t.Fatalf("unexpected DPIDR %#x: %v", id, err)
+	}
+}
+
+func TestConn_errors(t *testing.T) {
+	target := d2xxtest.NewSWDTarget(0x2BA01477)
+	s, _, err := swd.New(target, &swd.Opts{Retries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.Wait = 10
+	if _, err := s.ReadDP(swd.DPIDR); err != swd.ErrWait {
+		t.Fatalf("expected WAIT, got %v", err)
+	}
+	target.Wait = 0
+	// The debug domain is not powered up.
+	if err := s.WriteAP(0x04, 0); err != swd.ErrFault {
+		t.Fatalf("expected FAULT, got %v", err)
+	}
+	if err := s.SRST(true); err == nil {
+		t.Fatal("SRST is not connected")
+	}
+
+	if _, _, err := swd.New(d2xxtest.NewSWDTarget(1), &swd.Opts{SRST: 2}); err == nil {
+		t.Fatal("expected invalid pin")
+	}
+}
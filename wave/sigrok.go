@@ -0,0 +1,94 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package wave
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteSigrok writes the trace as a sigrok session file (.sr), which is a zip
+// archive holding the metadata and the raw samples.
+//
+// Bits without a channel are exported with a default name so the channel
+// numbers match the bits.
+func WriteSigrok(w io.Writer, t *Trace) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	names := map[uint8]string{}
+	probes := uint8(0)
+	for _, c := range t.Channels {
+		if _, ok := names[c.Bit]; ok {
+			return fmt.Errorf("wave: channel %q: bit %d is used twice", c.Name, c.Bit)
+		}
+		names[c.Bit] = c.Name
+		if c.Bit >= probes {
+			probes = c.Bit + 1
+		}
+	}
+	unit := 1
+	if probes > 8 {
+		unit = 2
+	}
+
+	var m strings.Builder
+	m.WriteString("[global]\nsigrok version=0.5.2\n\n[device 1]\ncapturefile=logic-1\n")
+	fmt.Fprintf(&m, "total probes=%d\nsamplerate=%s\ntotal analog=0\n", probes, sigrokRate(t.Rate))
+	for i := uint8(0); i < probes; i++ {
+		n, ok := names[i]
+		if !ok {
+			n = fmt.Sprintf("D%d", i)
+		}
+		fmt.Fprintf(&m, "probe%d=%s\n", i+1, n)
+	}
+	fmt.Fprintf(&m, "unitsize=%d\n", unit)
+
+	data := make([]byte, 0, len(t.Samples)*unit)
+	for _, s := range t.Samples {
+		data = append(data, byte(s))
+		if unit == 2 {
+			data = append(data, byte(s>>8))
+		}
+	}
+
+	z := zip.NewWriter(w)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{"version", []byte("2")},
+		{"metadata", []byte(m.String())},
+		{"logic-1-1", data},
+	} {
+		fw, err := z.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(fw, bytes.NewReader(f.data)); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+//
+
+// sigrokRate formats the sample rate the way libsigrok does.
+func sigrokRate(hz uint32) string {
+	switch {
+	case hz >= 1000000000 && hz%1000000000 == 0:
+		return fmt.Sprintf("%d GHz", hz/1000000000)
+	case hz >= 1000000 && hz%1000000 == 0:
+		return fmt.Sprintf("%d MHz", hz/1000000)
+	case hz >= 1000 && hz%1000 == 0:
+		return fmt.Sprintf("%d kHz", hz/1000)
+	default:
+		return fmt.Sprintf("%d Hz", hz)
+	}
+}
@@ -0,0 +1,344 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package wave
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"periph.io/x/d2xx/mpsse"
+)
+
+// timescales are the valid VCD time units, largest first, in femtoseconds.
+var timescales = []struct {
+	name string
+	fs   uint64
+}{
+	{"1 s", 1e15}, {"100 ms", 1e14}, {"10 ms", 1e13}, {"1 ms", 1e12},
+	{"100 us", 1e11}, {"10 us", 1e10}, {"1 us", 1e9},
+	{"100 ns", 1e8}, {"10 ns", 1e7}, {"1 ns", 1e6},
+	{"100 ps", 1e5}, {"10 ps", 1e4}, {"1 ps", 1e3},
+	{"100 fs", 100}, {"10 fs", 10}, {"1 fs", 1},
+}
+
+// timescale returns the largest time unit in which the sample period is an
+// integer, and the period in this unit. If none exists, 1 fs is returned with
+// a period of 0, meaning timestamps must be rounded.
+func timescale(rate uint32) (string, uint64, uint64) {
+	for _, t := range timescales {
+		d := t.fs * uint64(rate)
+		if d <= 1e15 && 1e15%d == 0 {
+			return t.name, t.fs, 1e15 / d
+		}
+	}
+	return "1 fs", 1, 0
+}
+
+// roundDiv returns i*unit/rate rounded, or false if it overflows.
+func roundDiv(i, unit uint64, rate uint32) (uint64, bool) {
+	hi, lo := bits.Mul64(i, unit)
+	lo, c := bits.Add64(lo, uint64(rate/2), 0)
+	if hi+c >= uint64(rate) {
+		return 0, false
+	}
+	q, _ := bits.Div64(hi+c, lo, uint64(rate))
+	return q, true
+}
+
+// WriteVCD writes the trace as an IEEE 1364 Value Change Dump.
+//
+// The timescale is chosen so that each sample falls on an integer timestamp.
+// If there is none, or if the timestamps would overflow, they are rounded in
+// the finest unit in which they fit.
+func WriteVCD(w io.Writer, t *Trace) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	if len(t.Channels) > 94 {
+		return fmt.Errorf("wave: too many channels")
+	}
+	name, _, period := timescale(t.Rate)
+	n := uint64(len(t.Samples))
+	var unit uint64
+	if hi, _ := bits.Mul64(n, period); period == 0 || hi != 0 {
+		period = 0
+		for i := len(timescales) - 1; i >= 0; i-- {
+			// In 1 s, the timestamps are at most n.
+			unit = 1e15 / timescales[i].fs
+			if _, ok := roundDiv(n, unit, t.Rate); ok {
+				name = timescales[i].name
+				break
+			}
+		}
+	}
+	at := func(i int) uint64 {
+		if period != 0 {
+			return uint64(i) * period
+		}
+		q, _ := roundDiv(uint64(i), unit, t.Rate)
+		return q
+	}
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "$version periph.io/x/d2xx/wave $end\n$timescale %s $end\n$scope module logic $end\n", name)
+	for i, c := range t.Channels {
+		fmt.Fprintf(b, "$var wire 1 %c %s $end\n", '!'+i, strings.ReplaceAll(c.Name, " ", "_"))
+	}
+	b.WriteString("$upscope $end\n$enddefinitions $end\n")
+	var prev uint16
+	for i, s := range t.Samples {
+		if i == 0 {
+			b.WriteString("#0\n$dumpvars\n")
+			for j, c := range t.Channels {
+				fmt.Fprintf(b, "%d%c\n", s>>c.Bit&1, '!'+j)
+			}
+			b.WriteString("$end\n")
+		} else if d := s ^ prev; d != 0 {
+			first := true
+			for j, c := range t.Channels {
+				if d>>c.Bit&1 != 0 {
+					if first {
+						fmt.Fprintf(b, "#%d\n", at(i))
+						first = false
+					}
+					fmt.Fprintf(b, "%d%c\n", s>>c.Bit&1, '!'+j)
+				}
+			}
+		}
+		prev = s
+	}
+	// The end of the last sample.
+	fmt.Fprintf(b, "#%d\n", at(len(t.Samples)))
+	return b.Flush()
+}
+
+// ReadVCD reads a Value Change Dump and resamples it at rate.
+//
+// If rate is 0, it is derived from the timestamps. Only 1 bit variables are
+// supported, up to 16. Variables named after a pin (see mpsse.ParsePin) are
+// assigned to that bit, the others to the free bits in declaration order.
+// Unknown and high impedance values read as 0.
+func ReadVCD(r io.Reader, rate uint32) (*Trace, error) {
+	p := vcdParser{s: bufio.NewScanner(r), ids: map[string]int{}}
+	p.s.Buffer(nil, 1<<20)
+	p.s.Split(bufio.ScanWords)
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	if p.scale == 0 {
+		return nil, fmt.Errorf("wave: vcd: missing $timescale")
+	}
+	if len(p.vars) == 0 {
+		return nil, fmt.Errorf("wave: vcd: no variable")
+	}
+	t := &Trace{Rate: rate}
+	// Assign the bits.
+	var used uint16
+	bitOf := make([]uint8, len(p.vars))
+	assigned := make([]bool, len(p.vars))
+	for i, n := range p.vars {
+		if pin, err := mpsse.ParsePin(n); err == nil && used&(1<<pin) == 0 {
+			bitOf[i] = uint8(pin)
+			assigned[i] = true
+			used |= 1 << pin
+		}
+	}
+	for i := range p.vars {
+		if assigned[i] {
+			continue
+		}
+		b := uint8(0)
+		for ; b < 16 && used&(1<<b) != 0; b++ {
+		}
+		bitOf[i] = b
+		used |= 1 << b
+	}
+	for i, n := range p.vars {
+		t.Channels = append(t.Channels, Channel{Name: n, Bit: bitOf[i]})
+	}
+
+	// Sample period in femtoseconds.
+	var period uint64
+	if rate == 0 {
+		g := uint64(0)
+		for _, c := range p.changes {
+			g = gcd(g, c.t)
+		}
+		g = gcd(g, p.end)
+		if g == 0 {
+			return nil, fmt.Errorf("wave: vcd: can't derive the sample rate")
+		}
+		period = g * p.scale
+		if period > 1e15 || 1e15%period != 0 {
+			return nil, fmt.Errorf("wave: vcd: sample period of %d fs is not supported", period)
+		}
+		t.Rate = uint32(1e15 / period)
+	} else {
+		period = 1e15 / uint64(rate)
+	}
+	if hi, _ := bits.Mul64(p.end, p.scale); hi != 0 {
+		return nil, fmt.Errorf("wave: vcd: timestamp %d is too large", p.end)
+	}
+	// Timestamps are rounded to the nearest sample.
+	toSample := func(ts uint64) uint64 {
+		return (ts*p.scale + period/2) / period
+	}
+	n := toSample(p.end)
+	if l := len(p.changes); l != 0 && p.changes[l-1].t == p.end {
+		n++
+	}
+	if n > 1<<28 {
+		return nil, fmt.Errorf("wave: vcd: too many samples")
+	}
+	t.Samples = make([]uint16, n)
+	var cur uint16
+	j := uint64(0)
+	for _, c := range p.changes {
+		k := toSample(c.t)
+		for ; j < k && j < n; j++ {
+			t.Samples[j] = cur
+		}
+		b := uint16(1) << bitOf[c.v]
+		if c.level {
+			cur |= b
+		} else {
+			cur &^= b
+		}
+	}
+	for ; j < n; j++ {
+		t.Samples[j] = cur
+	}
+	return t, nil
+}
+
+//
+
+type vcdChange struct {
+	t     uint64
+	v     int
+	level bool
+}
+
+type vcdParser struct {
+	s       *bufio.Scanner
+	scale   uint64
+	vars    []string
+	ids     map[string]int
+	changes []vcdChange
+	now     uint64
+	end     uint64
+}
+
+func (p *vcdParser) next() (string, bool) {
+	if !p.s.Scan() {
+		return "", false
+	}
+	return p.s.Text(), true
+}
+
+// section returns the tokens up to $end.
+func (p *vcdParser) section(kw string) ([]string, error) {
+	var out []string
+	for {
+		t, ok := p.next()
+		if !ok {
+			return nil, fmt.Errorf("wave: vcd: unterminated %s", kw)
+		}
+		if t == "$end" {
+			return out, nil
+		}
+		out = append(out, t)
+	}
+}
+
+func (p *vcdParser) parse() error {
+	for {
+		tok, ok := p.next()
+		if !ok {
+			return p.s.Err()
+		}
+		switch {
+		case tok == "$timescale":
+			s, err := p.section(tok)
+			if err != nil {
+				return err
+			}
+			if p.scale, err = parseTimescale(strings.Join(s, "")); err != nil {
+				return err
+			}
+		case tok == "$var":
+			s, err := p.section(tok)
+			if err != nil {
+				return err
+			}
+			if len(s) < 4 {
+				return fmt.Errorf("wave: vcd: invalid $var %q", strings.Join(s, " "))
+			}
+			if s[1] != "1" {
+				// Vectors are ignored.
+				continue
+			}
+			if _, ok := p.ids[s[2]]; ok {
+				// Aliases of the same signal.
+				continue
+			}
+			if len(p.vars) == 16 {
+				return fmt.Errorf("wave: vcd: more than 16 variables")
+			}
+			p.ids[s[2]] = len(p.vars)
+			p.vars = append(p.vars, s[3])
+		case tok == "$dumpvars" || tok == "$dumpon" || tok == "$dumpoff" || tok == "$dumpall" || tok == "$end":
+			// Value changes follow.
+		case tok[0] == '$':
+			if _, err := p.section(tok); err != nil {
+				return err
+			}
+		case tok[0] == '#':
+			v, err := strconv.ParseUint(tok[1:], 10, 64)
+			if err != nil || v < p.now {
+				return fmt.Errorf("wave: vcd: invalid timestamp %q", tok)
+			}
+			p.now = v
+			p.end = v
+		case tok[0] == 'b' || tok[0] == 'B' || tok[0] == 'r' || tok[0] == 'R':
+			// Vector value; skip the identifier.
+			if _, ok := p.next(); !ok {
+				return fmt.Errorf("wave: vcd: truncated value %q", tok)
+			}
+		default:
+			var level bool
+			switch tok[0] {
+			case '1':
+				level = true
+			case '0', 'x', 'X', 'z', 'Z':
+			default:
+				return fmt.Errorf("wave: vcd: unexpected %q", tok)
+			}
+			if i, ok := p.ids[tok[1:]]; ok {
+				p.changes = append(p.changes, vcdChange{t: p.now, v: i, level: level})
+			}
+		}
+	}
+}
+
+// parseTimescale returns the unit in femtoseconds.
+func parseTimescale(s string) (uint64, error) {
+	for _, t := range timescales {
+		if strings.ReplaceAll(t.name, " ", "") == s {
+			return t.fs, nil
+		}
+	}
+	return 0, fmt.Errorf("wave: vcd: invalid timescale %q", s)
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
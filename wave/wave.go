@@ -0,0 +1,102 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package wave exports sampled pin data to waveform viewers and reads it
+// back.
+//
+// IEEE 1364 VCD files are supported by GTKWave and PulseView, sigrok session
+// files (.sr) by PulseView and sigrok-cli.
+package wave
+
+import (
+	"fmt"
+	"sort"
+
+	"periph.io/x/d2xx/mpsse"
+)
+
+// Channel names a bit of the samples.
+type Channel struct {
+	Name string
+	// Bit is the bit in the samples, 0~15. For MPSSE GPIO reads it is the
+	// mpsse.Pin number; for bit-bang captures it is the data bit.
+	Bit uint8
+}
+
+// Trace is a recording of evenly spaced samples.
+type Trace struct {
+	// Rate is the sample rate in Hz.
+	Rate uint32
+	// Channels are the bits to export.
+	Channels []Channel
+	// Samples are up to 16 channels per sample.
+	Samples []uint16
+}
+
+// FromBytes converts 8 bits samples, as returned by a bit-bang capture.
+func FromBytes(b []byte) []uint16 {
+	out := make([]uint16, len(b))
+	for i, v := range b {
+		out[i] = uint16(v)
+	}
+	return out
+}
+
+// Pattern returns the low byte of each sample, to be played back with
+// bitbang.Engine.Play.
+func (t *Trace) Pattern() []byte {
+	out := make([]byte, len(t.Samples))
+	for i, v := range t.Samples {
+		out[i] = byte(v)
+	}
+	return out
+}
+
+// Channels returns the channels of a board pin map, keyed by signal name,
+// sorted by pin.
+func Channels(pins map[string]mpsse.Pin) []Channel {
+	out := make([]Channel, 0, len(pins))
+	for n, p := range pins {
+		out = append(out, Channel{Name: n, Bit: uint8(p)})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Bit != out[j].Bit {
+			return out[i].Bit < out[j].Bit
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// DefaultChannels returns channels named after the pins, D0~D7 for n <= 8,
+// ADBUS0~ACBUS7 otherwise.
+func DefaultChannels(n int) []Channel {
+	out := make([]Channel, n)
+	for i := range out {
+		out[i].Bit = uint8(i)
+		if n <= 8 {
+			out[i].Name = fmt.Sprintf("D%d", i)
+		} else {
+			out[i].Name = mpsse.Pin(i).String()
+		}
+	}
+	return out
+}
+
+//
+
+func (t *Trace) validate() error {
+	if t.Rate == 0 {
+		return fmt.Errorf("wave: invalid sample rate 0")
+	}
+	if len(t.Channels) == 0 {
+		return fmt.Errorf("wave: no channel")
+	}
+	for _, c := range t.Channels {
+		if c.Bit > 15 {
+			return fmt.Errorf("wave: channel %q: invalid bit %d", c.Name, c.Bit)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package wave_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"periph.io/x/d2xx/mpsse"
+	"periph.io/x/d2xx/wave"
+)
+
+func TestVCD(t *testing.T) {
+	tr := &wave.Trace{
+		Rate: 1000000,
+		Channels: wave.Channels(map[string]mpsse.Pin{
+			"TCK": mpsse.ADBUS0,
+			"TDI": mpsse.ADBUS1,
+			"TDO": mpsse.ADBUS2,
+		}),
+		Samples: wave.FromBytes([]byte{0, 1, 1, 3, 7, 7, 0, 0}),
+	}
+	var b bytes.Buffer
+	if err := wave.WriteVCD(&b, tr); err != nil {
+		t.Fatal(err)
+	}
+	s := b.String()
+	for _, want := range []string{"$timescale 1 us $end", "$var wire 1 ! TCK $end", "#3\n1\"\n", "#8\n"} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("missing %q in:\n%s", want, s)
+		}
+	}
+	got, err := wave.ReadVCD(strings.NewReader(s), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Rate != tr.Rate || !reflect.DeepEqual(got.Samples, tr.Samples) {
+		t.Fatalf("%d Hz %v", got.Rate, got.Samples)
+	}
+	if !reflect.DeepEqual(got.Channels, tr.Channels) {
+		t.Fatalf("%v", got.Channels)
+	}
+	if p := got.Pattern(); !bytes.Equal(p, []byte{0, 1, 1, 3, 7, 7, 0, 0}) {
+		t.Fatalf("%v", p)
+	}
+	// Resampled at twice the rate.
+	got, err = wave.ReadVCD(strings.NewReader(s), 2000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Samples) != 16 || got.Samples[5] != 1 || got.Samples[6] != 3 {
+		t.Fatalf("%v", got.Samples)
+	}
+}
+
+func TestVCD_timescale(t *testing.T) {
+	data := []struct {
+		rate uint32
+		want string
+	}{
+		{1, "$timescale 1 s $end"},
+		{10, "$timescale 100 ms $end"},
+		{8000000, "$timescale 1 ns $end"},
+		{12000000, "$timescale 1 fs $end"},
+		{48000, "$timescale 1 fs $end"},
+		{50000, "$timescale 10 us $end"},
+		{3, "$timescale 1 fs $end"},
+	}
+	for _, l := range data {
+		tr := &wave.Trace{Rate: l.rate, Channels: wave.DefaultChannels(1), Samples: []uint16{0, 1, 0, 1}}
+		var b bytes.Buffer
+		if err := wave.WriteVCD(&b, tr); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(b.String(), l.want) {
+			t.Fatalf("%d Hz: %s", l.rate, b.String())
+		}
+		got, err := wave.ReadVCD(&b, l.rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Samples, tr.Samples) {
+			t.Fatalf("%d Hz: %v", l.rate, got.Samples)
+		}
+	}
+}
+
+func TestVCD_overflow(t *testing.T) {
+	// The timestamps in fs overflow 64 bits.
+	tr := &wave.Trace{Rate: 3, Channels: wave.DefaultChannels(1), Samples: make([]uint16, 100000)}
+	tr.Samples[99999] = 1
+	var b bytes.Buffer
+	if err := wave.WriteVCD(&b, tr); err != nil {
+		t.Fatal(err)
+	}
+	s := b.String()
+	if !strings.Contains(s, "$timescale 10 fs $end") || !strings.HasSuffix(s, "#3333333333333333333\n") {
+		t.Fatal(s[len(s)-100:])
+	}
+}
+
+func TestReadVCD(t *testing.T) {
+	// Written by another tool: unknown names, vectors and unknown values.
+	const s = `$date today $end
+$timescale 10ns $end
+$scope module top $end
+$var wire 8 # bus [7:0] $end
+$var wire 1 a clk $end
+$var reg 1 b GPIOL0 $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars
+xa
+1b
+b00000000 #
+$end
+#10
+1a
+#20
+0a
+0b
+#40
+`
+	tr, err := wave.ReadVCD(strings.NewReader(s), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []wave.Channel{{Name: "clk", Bit: 0}, {Name: "GPIOL0", Bit: 4}}
+	if tr.Rate != 10000000 || !reflect.DeepEqual(tr.Channels, want) {
+		t.Fatalf("%d %v", tr.Rate, tr.Channels)
+	}
+	if !reflect.DeepEqual(tr.Samples, []uint16{0x10, 0x11, 0, 0}) {
+		t.Fatalf("%v", tr.Samples)
+	}
+	if _, err := wave.ReadVCD(strings.NewReader("$var wire 1 a b $end\n#0\n0a\n"), 0); err == nil {
+		t.Fatal("missing timescale")
+	}
+}
+
+func TestSigrok(t *testing.T) {
+	tr := &wave.Trace{
+		Rate:     500000,
+		Channels: []wave.Channel{{Name: "SCL", Bit: 0}, {Name: "SDA", Bit: 9}},
+		Samples:  []uint16{0x201, 0x001},
+	}
+	var b bytes.Buffer
+	if err := wave.WriteSigrok(&b, tr); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, _ := io.ReadAll(r)
+		files[f.Name] = string(d)
+	}
+	if files["version"] != "2" {
+		t.Fatal(files["version"])
+	}
+	if files["logic-1-1"] != "\x01\x02\x01\x00" {
+		t.Fatalf("%q", files["logic-1-1"])
+	}
+	m := files["metadata"]
+	for _, want := range []string{"samplerate=500 kHz\n", "total probes=10\n", "probe1=SCL\n", "probe2=D1\n", "probe10=SDA\n", "unitsize=2\n"} {
+		if !strings.Contains(m, want) {
+			t.Fatalf("missing %q in:\n%s", want, m)
+		}
+	}
+}